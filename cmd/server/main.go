@@ -9,8 +9,13 @@ import (
 	"github.com/prajwalbharadwajbm/broker/internal/config"
 	"github.com/prajwalbharadwajbm/broker/internal/db"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/mailer"
 	"github.com/prajwalbharadwajbm/broker/internal/middleware"
+	"github.com/prajwalbharadwajbm/broker/internal/ratelimit"
 	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+	"github.com/prajwalbharadwajbm/broker/internal/service/corporateactions"
+	"github.com/prajwalbharadwajbm/broker/internal/service/settlement"
+	"github.com/prajwalbharadwajbm/broker/internal/tracing"
 )
 
 const VERSION = "1.0.0"
@@ -19,13 +24,21 @@ func init() {
 	config.LoadConfigs()
 	initializeGlobalLogger()
 	loadDatabaseClient()
+	loadSigningKeys()
+	loadAPIKeyEncryption()
+	loadTOTPEncryption()
+	loadRevocationStore()
+	loadMailer()
+	loadRateLimitStore()
+	loadTracing()
 	logger.Log.Info("loaded all configs")
 }
 
 func initializeGlobalLogger() {
 	env := config.AppConfigInstance.GeneralConfig.Env
 	logLevel := config.AppConfigInstance.GeneralConfig.LogLevel
-	logger.InitializeGlobalLogger(logLevel, env, VERSION+"-broker-platform")
+	logFormat := config.AppConfigInstance.GeneralConfig.LogFormat
+	logger.InitializeGlobalLogger(logLevel, logFormat, env, VERSION+"-broker-platform")
 	logger.Log.Info("loaded the global logger")
 }
 
@@ -33,15 +46,89 @@ func loadDatabaseClient() {
 	db.GetClient()
 }
 
+func loadSigningKeys() {
+	keys := config.AppConfigInstance.JWTKeys
+	err := auth.InitializeKeyRing(keys.Dir, keys.ActiveKeyID)
+	if err != nil {
+		logger.Log.Fatal("failed to load JWT signing keys", err)
+	}
+}
+
+func loadAPIKeyEncryption() {
+	err := auth.InitializeAPIKeyEncryption(config.AppConfigInstance.APIKeyEncryptionKey)
+	if err != nil {
+		logger.Log.Fatal("failed to load API key encryption key", err)
+	}
+	if !auth.APIKeysEnabled() {
+		logger.Log.Warn("API keys are disabled, set API_KEY_ENCRYPTION_KEY to enable them")
+	}
+}
+
+func loadTOTPEncryption() {
+	err := auth.InitializeTOTPEncryption(config.AppConfigInstance.TOTPEncryptionKey)
+	if err != nil {
+		logger.Log.Fatal("failed to load TOTP encryption key", err)
+	}
+	if !auth.TwoFactorEnabled() {
+		logger.Log.Warn("two-factor authentication is disabled, set TOTP_ENCRYPTION_KEY to enable it")
+		return
+	}
+
+	// secrets stored in plaintext before migration 019 are encrypted once the key is known
+	encrypted, err := auth.EncryptStoredTOTPSecrets(context.Background())
+	if err != nil {
+		logger.Log.Fatal("failed to encrypt stored TOTP secrets", err)
+	}
+	if encrypted > 0 {
+		logger.Log.Infof("encrypted %d stored TOTP secrets", encrypted)
+	}
+}
+
+func loadRevocationStore() {
+	err := auth.InitializeRevocationStore(config.AppConfigInstance.TokenRevocation.Store)
+	if err != nil {
+		logger.Log.Fatal("failed to initialize access token revocation store", err)
+	}
+}
+
+func loadMailer() {
+	err := mailer.Initialize(config.AppConfigInstance.Mailer)
+	if err != nil {
+		logger.Log.Fatal("failed to initialize mailer", err)
+	}
+}
+
+func loadRateLimitStore() {
+	err := ratelimit.Initialize(config.AppConfigInstance.RateLimits.Store)
+	if err != nil {
+		logger.Log.Fatal("failed to initialize rate limit store", err)
+	}
+}
+
+func loadTracing() {
+	err := tracing.Initialize(config.AppConfigInstance.Tracing, "broker-platform", VERSION)
+	if err != nil {
+		logger.Log.Fatal("failed to initialize tracing", err)
+	}
+}
+
 func main() {
 	// Start token cleanup service in background
 	ctx := context.Background()
-	// cleanup expired refresh tokens
+	// cleanup expired refresh tokens and access token revocations
 	go auth.StartTokenCleanupService(ctx)
+	// settle delivery trades into holdings at end of day (T+1)
+	go settlement.StartSettlementService(ctx)
+	// apply splits, bonuses and dividends on their ex-date
+	go corporateactions.StartCorporateActionsService(ctx)
 
 	router := Routes()
-	// Wrap router with recovery middleware with global recovery handler
-	handler := middleware.RecoveryMiddleware(router)
+	// Wrap router with recovery middleware with global recovery handler, inside the request id
+	// middleware so a recovered panic is logged and answered with the request id, and inside the
+	// metrics middleware so a recovered panic is counted with its 500. The tracing middleware comes
+	// first so the request id and the logs of the request can point at its trace.
+	handler := middleware.TracingMiddleware(router,
+		middleware.RequestIDMiddleware(middleware.MetricsMiddleware(router, middleware.RecoveryMiddleware(router))))
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", config.AppConfigInstance.GeneralConfig.Port),
@@ -54,6 +141,10 @@ func main() {
 	logger.Log.Infof("Starting server on port %d", config.AppConfigInstance.GeneralConfig.Port)
 	err := srv.ListenAndServe()
 	if err != nil {
+		// Fatal exits without running defers, the buffered spans are flushed first
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		tracing.Shutdown(shutdownCtx)
+		cancel()
 		logger.Log.Fatal("failed to serve http server", err)
 	}
 }
@@ -4,7 +4,11 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
 	"github.com/prajwalbharadwajbm/broker/internal/handlers"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/metrics"
 	"github.com/prajwalbharadwajbm/broker/internal/middleware"
 )
 
@@ -12,21 +16,83 @@ func Routes() *httprouter.Router {
 	router := httprouter.New()
 	// No auth required for health check endpoint
 	router.HandlerFunc(http.MethodGet, "/health", handlers.Health)
+	// Prometheus scrape endpoint, behind METRICS_TOKEN when it is set
+	router.Handler(http.MethodGet, "/metrics", metrics.Handler(config.AppConfigInstance.Metrics.Token))
+	// public keys for services verifying access tokens
+	router.HandlerFunc(http.MethodGet, "/.well-known/jwks.json", handlers.JWKS)
 
 	// user endpoints (no auth required)
-	router.HandlerFunc(http.MethodPost, "/api/v1/users/signup", handlers.Signup)
-	router.HandlerFunc(http.MethodPost, "/api/v1/users/login", handlers.Login)
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/signup", middleware.IPRateLimitMiddleware(middleware.RouteGroupSignup)(interceptor.Handle(handlers.Signup)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/login", middleware.IPRateLimitMiddleware(middleware.RouteGroupLogin)(interceptor.Handle(handlers.Login)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/login/2fa", middleware.IPRateLimitMiddleware(middleware.RouteGroupTwoFactor)(interceptor.Handle(handlers.LoginTwoFactor)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/password/reset", middleware.IPRateLimitMiddleware(middleware.RouteGroupPasswordReset)(interceptor.Handle(handlers.RequestPasswordReset)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/password/reset/confirm", middleware.IPRateLimitMiddleware(middleware.RouteGroupPasswordReset)(interceptor.Handle(handlers.ConfirmPasswordReset)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/email/verify", middleware.IPRateLimitMiddleware(middleware.RouteGroupEmailVerify)(interceptor.Handle(handlers.VerifyEmail)))
 
 	// Token refresh endpoints (no auth required)
-	router.HandlerFunc(http.MethodPost, "/api/v1/auth/refresh", handlers.RefreshToken)
-	router.HandlerFunc(http.MethodPost, "/api/v1/auth/revoke", handlers.RevokeRefreshToken) // Logout
+	router.HandlerFunc(http.MethodPost, "/api/v1/auth/refresh", middleware.IPRateLimitMiddleware(middleware.RouteGroupRefresh)(interceptor.Handle(handlers.RefreshToken)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/auth/revoke", middleware.IPRateLimitMiddleware(middleware.RouteGroupRefresh)(interceptor.Handle(handlers.RevokeRefreshToken))) // Logout
 
-	// authenticated endpoints
-	router.HandlerFunc(http.MethodPost, "/api/v1/holdings", middleware.AuthMiddleware(handlers.AddHolding))
-	router.HandlerFunc(http.MethodGet, "/api/v1/holdings", middleware.AuthMiddleware(handlers.GetHoldings))
+	// OAuth2 endpoints called by third-party apps, authenticated with the client credentials
+	router.HandlerFunc(http.MethodPost, "/api/v1/oauth/token", middleware.OAuthClientRateLimitMiddleware(handlers.OAuthToken))
+	router.HandlerFunc(http.MethodPost, "/api/v1/oauth/introspect", middleware.OAuthClientRateLimitMiddleware(handlers.OAuthIntrospect))
 
-	router.HandlerFunc(http.MethodGet, "/api/v1/orderbook", middleware.AuthMiddleware(handlers.GetOrderbook))
-	router.HandlerFunc(http.MethodGet, "/api/v1/positions", middleware.AuthMiddleware(handlers.GetPositions))
+	// account management
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/password/change", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.ChangePassword))))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/email/verify/resend", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.ResendVerificationEmail))))
+
+	// session management
+	router.HandlerFunc(http.MethodGet, "/api/v1/auth/sessions", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.GetSessions))))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/auth/sessions", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.RevokeAllSessions)))) // Log out everywhere
+	router.HandlerFunc(http.MethodDelete, "/api/v1/auth/sessions/:id", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.RevokeSession))))
+
+	// API keys, managed with a logged in session only
+	router.HandlerFunc(http.MethodPost, "/api/v1/auth/api-keys", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.CreateAPIKey))))
+	router.HandlerFunc(http.MethodGet, "/api/v1/auth/api-keys", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.GetAPIKeys))))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/auth/api-keys/:id", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.RevokeAPIKey))))
+
+	// OAuth2 consent, called by the web app for the logged in user
+	router.HandlerFunc(http.MethodGet, "/api/v1/oauth/authorize", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.GetOAuthAuthorization))))
+	router.HandlerFunc(http.MethodPost, "/api/v1/oauth/authorize", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.AuthorizeOAuthClient))))
+	router.HandlerFunc(http.MethodGet, "/api/v1/oauth/consents", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.GetOAuthConsents))))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/oauth/consents/:client_id", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.RevokeOAuthConsent))))
+
+	// two-factor authentication
+	router.HandlerFunc(http.MethodPost, "/api/v1/auth/2fa/enroll", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.EnrollTwoFactor))))
+	router.HandlerFunc(http.MethodPost, "/api/v1/auth/2fa/verify", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.VerifyTwoFactor))))
+	router.HandlerFunc(http.MethodPost, "/api/v1/auth/2fa/disable", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(interceptor.Handle(handlers.DisableTwoFactor))))
+
+	// trading endpoints, require a verified email address
+	router.HandlerFunc(http.MethodPost, "/api/v1/holdings", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(middleware.VerifiedEmailMiddleware(interceptor.Handle(handlers.AddHolding)))))
+	router.HandlerFunc(http.MethodGet, "/api/v1/holdings", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(middleware.VerifiedEmailMiddleware(interceptor.Handle(handlers.GetHoldings)))))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/holdings/:id", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(middleware.VerifiedEmailMiddleware(interceptor.Handle(handlers.UpdateHolding)))))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/holdings/:id", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(middleware.VerifiedEmailMiddleware(interceptor.Handle(handlers.DeleteHolding)))))
+
+	router.HandlerFunc(http.MethodGet, "/api/v1/orderbook", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(middleware.VerifiedEmailMiddleware(interceptor.Handle(handlers.GetOrderbook)))))
+	router.HandlerFunc(http.MethodGet, "/api/v1/positions", middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(middleware.VerifiedEmailMiddleware(interceptor.Handle(handlers.GetPositions)))))
+
+	// admin endpoints, each open to the staff roles listed
+	admin := func(handler interceptor.HandlerFunc, roles ...string) http.HandlerFunc {
+		return middleware.AuthMiddleware(middleware.UserRateLimitMiddleware(middleware.RequireRoles(roles...)(interceptor.Handle(handler))))
+	}
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/corporate-actions", admin(handlers.AddCorporateAction, models.RoleAdmin))
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/corporate-actions", admin(handlers.GetCorporateActions, models.RoleAdmin))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/oauth/clients", admin(handlers.RegisterOAuthClient, models.RoleAdmin))
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/oauth/clients", admin(handlers.GetOAuthClients, models.RoleAdmin))
+
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/users", admin(handlers.SearchUsers, models.RoleSupport, models.RoleRisk, models.RoleAdmin))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/users/:id/unlock", admin(handlers.UnlockUser, models.RoleSupport, models.RoleAdmin))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/users/:id/freeze", admin(handlers.FreezeUser, models.RoleRisk, models.RoleAdmin))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/users/:id/unfreeze", admin(handlers.UnfreezeUser, models.RoleRisk, models.RoleAdmin))
+	router.HandlerFunc(http.MethodPut, "/api/v1/admin/users/:id/role", admin(handlers.SetUserRole, models.RoleAdmin))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/users/:id/impersonate", admin(handlers.ImpersonateUser, models.RoleSupport, models.RoleAdmin))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/circuit-breaker/reset", admin(handlers.ResetCircuitBreaker, models.RoleAdmin))
+
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/audit-events", admin(handlers.SearchAuditEvents, models.RoleRisk, models.RoleAdmin))
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/audit-events/verify", admin(handlers.VerifyAuditChain, models.RoleRisk, models.RoleAdmin))
 
 	return router
 }
@@ -2,6 +2,8 @@ package config
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/prajwalbharadwajbm/broker/internal/utils"
@@ -10,13 +12,33 @@ import (
 type GeneralConfig struct {
 	Env      string
 	LogLevel string
-	Port     int
+	// LogFormat is console for local development or json for log shipping
+	LogFormat string
+	Port      int
+	// TrustedProxyHops is the number of proxies appending to X-Forwarded-For in front of the server, the
+	// client IP is taken from the header only when it is set
+	TrustedProxyHops int
 }
 
 type appConfig struct {
 	GeneralConfig GeneralConfig
 	DB            DB
 	JWTSecret     string
+	JWTKeys       JWTKeys
+	// RefreshTokenPepper keys the HMAC of stored refresh tokens, plain SHA-256 is used when empty
+	RefreshTokenPepper string
+	// APIKeyEncryptionKey is the base64 AES-256 key API key secrets are encrypted with, API keys are disabled when empty
+	APIKeyEncryptionKey string
+	// TOTPEncryptionKey is the base64 AES-256 key TOTP secrets are encrypted with, two-factor authentication is disabled when empty
+	TOTPEncryptionKey string
+	TokenRevocation   TokenRevocation
+	LoginProtection   LoginProtection
+	RateLimits        RateLimits
+	Mailer            Mailer
+	Settlement        Settlement
+	CorporateActions  CorporateActions
+	Metrics           Metrics
+	Tracing           Tracing
 }
 
 type DB struct {
@@ -27,6 +49,102 @@ type DB struct {
 	DBname   string
 }
 
+// JWTKeys holds the asymmetric keys access tokens are signed with instead of JWTSecret
+type JWTKeys struct {
+	// Dir holds one <kid>.pem file per key, HS256 with JWTSecret is used when empty
+	Dir string
+	// ActiveKeyID is the kid of the key new tokens are signed with, optional with a single private key
+	ActiveKeyID string
+}
+
+// TokenRevocation holds the configuration of the access token denylist
+type TokenRevocation struct {
+	// Store is "memory" for a single instance or "postgres" to share revocations between replicas
+	Store string
+}
+
+// LoginProtection holds the thresholds slowing down and stopping password guessing
+type LoginProtection struct {
+	// MaxFailedAttempts is the number of consecutive failed logins after which the account is locked
+	MaxFailedAttempts int
+	// LockoutDuration is how long a locked account stays locked
+	LockoutDuration time.Duration
+	// BackoffBase is the wait after the first failed login, doubling with every further failure
+	BackoffBase time.Duration
+	// BackoffMax caps the wait between failed logins
+	BackoffMax time.Duration
+	// MaxFailedAttemptsPerIP is the number of failed logins from one IP within IPWindow after
+	// which the IP is blocked from logging in until the window ends
+	MaxFailedAttemptsPerIP int
+	IPWindow               time.Duration
+}
+
+// RateLimits holds the token bucket limits of each route group
+type RateLimits struct {
+	Enabled bool
+	// Store is "memory", each instance then limits on its own
+	Store string
+	// Auth limits each group of public authentication routes (signup, login, 2fa, refresh, password reset,
+	// email verification) per client IP
+	Auth RateLimit
+	// OAuth limits the token and introspection endpoints per OAuth client
+	OAuth RateLimit
+	// API limits the authenticated routes per user
+	API RateLimit
+}
+
+// RateLimit allows Burst requests at once, refilling at PerMinute requests per minute
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// Mailer holds the configuration for sending emails to users
+type Mailer struct {
+	// Driver is "smtp" to send emails or "log" to only log them (and write them to OutboxDir) for local
+	// testing, it defaults to "log" in dev and has to be set elsewhere
+	Driver string
+	// From is the sender address of all emails
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	// OutboxDir is where the log driver writes emails as .eml files, they are only logged when empty
+	OutboxDir string
+	// AppURL is the base URL of the web app that links in emails point to
+	AppURL string
+}
+
+// Settlement holds the delivery (CNC) settlement cycle configuration
+type Settlement struct {
+	// CycleDays is the number of trading days after the trade date on which
+	// delivery trades move into holdings, 1 for T+1
+	CycleDays int
+	// RunHour is the UTC hour of the day at which the end-of-day settlement job runs
+	RunHour int
+}
+
+// CorporateActions holds the configuration for the corporate actions job
+type CorporateActions struct {
+	// RunHour is the UTC hour of the day at which actions reaching their ex-date are applied
+	RunHour int
+}
+
+// Metrics holds the configuration of the Prometheus metrics endpoint
+type Metrics struct {
+	// Token is required from scrapers as a Bearer token when set, the endpoint is open otherwise
+	Token string
+}
+
+// Tracing holds the OpenTelemetry tracing configuration
+type Tracing struct {
+	// Exporter is none, stdout for local debugging or otlp, configured by the OTEL_EXPORTER_OTLP_* variables
+	Exporter string
+	// SampleRatio is the share of new traces recorded, between 0 and 1
+	SampleRatio float64
+}
+
 func LoadConfigs() {
 	err := godotenv.Load()
 	if err != nil {
@@ -36,6 +154,13 @@ func LoadConfigs() {
 	loadGeneralCongigs()
 	loadDatabaseConfigs()
 	loadJWTConfigs()
+	loadLoginProtectionConfigs()
+	loadRateLimitConfigs()
+	loadMailerConfigs()
+	loadSettlementConfigs()
+	loadCorporateActionsConfigs()
+	loadMetricsConfigs()
+	loadTracingConfigs()
 }
 
 var AppConfigInstance appConfig
@@ -43,7 +168,14 @@ var AppConfigInstance appConfig
 func loadGeneralCongigs() {
 	AppConfigInstance.GeneralConfig.Env = utils.GetEnv("APP_DEV", "dev")
 	AppConfigInstance.GeneralConfig.LogLevel = utils.GetEnv("LOG_LEVEL", "info")
+	AppConfigInstance.GeneralConfig.LogFormat = utils.GetEnv("LOG_FORMAT", "console")
 	AppConfigInstance.GeneralConfig.Port = utils.GetEnv("PORT", 8080)
+	// TRUST_PROXY_HEADERS=true is the older setting for a single proxy
+	defaultHops := 0
+	if utils.GetEnv("TRUST_PROXY_HEADERS", false) {
+		defaultHops = 1
+	}
+	AppConfigInstance.GeneralConfig.TrustedProxyHops = utils.GetEnv("TRUSTED_PROXY_HOPS", defaultHops)
 }
 
 func loadDatabaseConfigs() {
@@ -56,4 +188,66 @@ func loadDatabaseConfigs() {
 
 func loadJWTConfigs() {
 	AppConfigInstance.JWTSecret = utils.GetEnv("JWT_SECRET", "")
+	AppConfigInstance.JWTKeys.Dir = utils.GetEnv("JWT_KEYS_DIR", "")
+	AppConfigInstance.JWTKeys.ActiveKeyID = utils.GetEnv("JWT_ACTIVE_KEY_ID", "")
+	AppConfigInstance.RefreshTokenPepper = utils.GetEnv("REFRESH_TOKEN_PEPPER", "")
+	AppConfigInstance.APIKeyEncryptionKey = utils.GetEnv("API_KEY_ENCRYPTION_KEY", "")
+	AppConfigInstance.TOTPEncryptionKey = utils.GetEnv("TOTP_ENCRYPTION_KEY", "")
+	AppConfigInstance.TokenRevocation.Store = utils.GetEnv("ACCESS_TOKEN_REVOCATION_STORE", "memory")
+}
+
+func loadLoginProtectionConfigs() {
+	AppConfigInstance.LoginProtection.MaxFailedAttempts = utils.GetEnv("LOGIN_MAX_FAILED_ATTEMPTS", 5)
+	AppConfigInstance.LoginProtection.LockoutDuration = utils.GetEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	AppConfigInstance.LoginProtection.BackoffBase = utils.GetEnv("LOGIN_BACKOFF_BASE", time.Second)
+	AppConfigInstance.LoginProtection.BackoffMax = utils.GetEnv("LOGIN_BACKOFF_MAX", time.Minute)
+	AppConfigInstance.LoginProtection.MaxFailedAttemptsPerIP = utils.GetEnv("LOGIN_MAX_FAILED_ATTEMPTS_PER_IP", 20)
+	AppConfigInstance.LoginProtection.IPWindow = utils.GetEnv("LOGIN_IP_WINDOW", 15*time.Minute)
+}
+
+func loadRateLimitConfigs() {
+	AppConfigInstance.RateLimits.Enabled = utils.GetEnv("RATE_LIMIT_ENABLED", true)
+	AppConfigInstance.RateLimits.Store = utils.GetEnv("RATE_LIMIT_STORE", "memory")
+	AppConfigInstance.RateLimits.Auth.PerMinute = utils.GetEnv("RATE_LIMIT_AUTH_PER_MINUTE", 10)
+	AppConfigInstance.RateLimits.Auth.Burst = utils.GetEnv("RATE_LIMIT_AUTH_BURST", 10)
+	AppConfigInstance.RateLimits.OAuth.PerMinute = utils.GetEnv("RATE_LIMIT_OAUTH_PER_MINUTE", 300)
+	AppConfigInstance.RateLimits.OAuth.Burst = utils.GetEnv("RATE_LIMIT_OAUTH_BURST", 60)
+	AppConfigInstance.RateLimits.API.PerMinute = utils.GetEnv("RATE_LIMIT_API_PER_MINUTE", 300)
+	AppConfigInstance.RateLimits.API.Burst = utils.GetEnv("RATE_LIMIT_API_BURST", 60)
+}
+
+func loadMailerConfigs() {
+	// outside dev the driver must be chosen, so a deployment does not silently log emails instead of sending them
+	defaultDriver := ""
+	if AppConfigInstance.GeneralConfig.Env == "dev" {
+		defaultDriver = "log"
+	}
+	AppConfigInstance.Mailer.Driver = utils.GetEnv("MAILER_DRIVER", defaultDriver)
+	AppConfigInstance.Mailer.From = utils.GetEnv("MAIL_FROM", "Broker Platform <no-reply@localhost>")
+	AppConfigInstance.Mailer.SMTPHost = utils.GetEnv("SMTP_HOST", "")
+	AppConfigInstance.Mailer.SMTPPort = utils.GetEnv("SMTP_PORT", 587)
+	AppConfigInstance.Mailer.SMTPUsername = utils.GetEnv("SMTP_USERNAME", "")
+	AppConfigInstance.Mailer.SMTPPassword = utils.GetEnv("SMTP_PASSWORD", "")
+	AppConfigInstance.Mailer.OutboxDir = utils.GetEnv("MAIL_OUTBOX_DIR", "")
+	AppConfigInstance.Mailer.AppURL = strings.TrimSuffix(utils.GetEnv("APP_URL", "http://localhost:3000"), "/")
+}
+
+func loadSettlementConfigs() {
+	AppConfigInstance.Settlement.CycleDays = utils.GetEnv("SETTLEMENT_CYCLE_DAYS", 1)
+	// 12:00 UTC is 17:30 IST, after the exchange closes for the day
+	AppConfigInstance.Settlement.RunHour = utils.GetEnv("SETTLEMENT_RUN_HOUR_UTC", 12)
+}
+
+func loadCorporateActionsConfigs() {
+	// 02:00 UTC is 07:30 IST, before the market opens on the ex-date
+	AppConfigInstance.CorporateActions.RunHour = utils.GetEnv("CORPORATE_ACTIONS_RUN_HOUR_UTC", 2)
+}
+
+func loadMetricsConfigs() {
+	AppConfigInstance.Metrics.Token = utils.GetEnv("METRICS_TOKEN", "")
+}
+
+func loadTracingConfigs() {
+	AppConfigInstance.Tracing.Exporter = utils.GetEnv("TRACING_EXPORTER", "none")
+	AppConfigInstance.Tracing.SampleRatio = utils.GetEnv("TRACING_SAMPLE_RATIO", 1.0)
 }
@@ -9,6 +9,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/prajwalbharadwajbm/broker/internal/config"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/metrics"
 )
 
 const pgConnStrFormat = "host=%s port=%d user=%s password=%s dbname=%s sslmode=disable"
@@ -37,6 +38,7 @@ func initializeClient() {
 	}
 
 	configureConnPoolParams(client)
+	metrics.RegisterDBStats(client)
 
 	// Should Ping to understand if database connection was successful
 	err = client.Ping()
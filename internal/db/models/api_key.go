@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey lets a user's programs call the API with HMAC signed requests instead of logging in.
+// The secret is shown once when the key is created and stored encrypted with a key kept outside the database.
+type APIKey struct {
+	ID     uuid.UUID `json:"id" db:"id"`
+	UserID uuid.UUID `json:"user_id" db:"user_id"`
+	KeyID  string    `json:"key_id" db:"key_id"` // public identifier sent with every request
+	Name   string    `json:"name" db:"name"`
+	// SecretCiphertext is the secret sealed by auth.EncryptAPIKeySecret
+	SecretCiphertext []byte     `json:"-" db:"secret_ciphertext"`
+	Scopes           []string   `json:"scopes" db:"scopes"`
+	IPAllowlist      []string   `json:"ip_allowlist" db:"ip_allowlist"` // IPs or CIDR ranges, empty allows any IP
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
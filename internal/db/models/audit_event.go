@@ -0,0 +1,53 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outcomes of audited actions
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// GenesisAuditHash is the prev_hash of the first audit event
+var GenesisAuditHash = strings.Repeat("0", 64)
+
+// AuditEvent is a row of the append only audit log, chained to the previous row by PrevHash
+type AuditEvent struct {
+	ID         int64           `json:"id" db:"id"`
+	OccurredAt time.Time       `json:"occurred_at" db:"occurred_at"`
+	ActorID    *uuid.UUID      `json:"actor_id,omitempty" db:"actor_id"` // who acted, staff for admin actions and impersonation
+	UserID     *uuid.UUID      `json:"user_id,omitempty" db:"user_id"`   // the account acted on
+	Action     string          `json:"action" db:"action"`
+	Resource   string          `json:"resource,omitempty" db:"resource"`
+	IP         string          `json:"ip,omitempty" db:"ip"`
+	UserAgent  string          `json:"user_agent,omitempty" db:"user_agent"`
+	RequestID  string          `json:"request_id,omitempty" db:"request_id"`
+	Outcome    string          `json:"outcome" db:"outcome"`
+	Before     json.RawMessage `json:"before,omitempty" db:"before"`
+	After      json.RawMessage `json:"after,omitempty" db:"after"`
+	PrevHash   string          `json:"prev_hash" db:"prev_hash"`
+	Hash       string          `json:"hash" db:"hash"`
+}
+
+// ComputeHash returns the SHA-256 of PrevHash and every other field but ID and Hash. OccurredAt must
+// already be truncated to the microseconds the database keeps.
+func (e *AuditEvent) ComputeHash() (string, error) {
+	fields, err := json.Marshal([]any{
+		e.OccurredAt.UTC().Format(time.RFC3339Nano), e.ActorID, e.UserID, e.Action, e.Resource,
+		e.IP, e.UserAgent, e.RequestID, e.Outcome, e.Before, e.After,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), fields...))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CorporateAction represents a split, bonus issue or cash dividend announced for a symbol
+// Ratios are expressed as RatioFrom:RatioTo, a 1:5 split turns 1 share into 5 and
+// a 1:2 bonus gives 2 bonus shares for every 1 share held
+type CorporateAction struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	Symbol           string     `json:"symbol" db:"symbol"`
+	ActionType       string     `json:"action_type" db:"action_type"`
+	RatioFrom        float64    `json:"ratio_from" db:"ratio_from"`
+	RatioTo          float64    `json:"ratio_to" db:"ratio_to"`
+	DividendPerShare float64    `json:"dividend_per_share" db:"dividend_per_share"`
+	ExDate           time.Time  `json:"ex_date" db:"ex_date"`
+	Status           string     `json:"status" db:"status"`
+	AppliedAt        *time.Time `json:"applied_at,omitempty" db:"applied_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Entitlement is a user's stake in the symbol of a corporate action, read when the action is applied.
+// The holding has moved on since the ex-date if delivery trades made on or after it have settled,
+// those are subtracted so a late run only adjusts what was held before the ex-date.
+// Holdings added through the holdings API carry no trade date and count as held before it.
+type Entitlement struct {
+	UserID       uuid.UUID
+	HoldingID    *uuid.UUID
+	Quantity     float64
+	AveragePrice float64
+	CurrentPrice float64
+	// SettledSinceExDate is the net quantity settled into the holding from delivery trades made
+	// on or after the ex-date, already at post-split terms
+	SettledSinceExDate float64
+	// UnsettledBeforeExDate is the net quantity of delivery trades made before the ex-date that
+	// have not settled yet
+	UnsettledBeforeExDate float64
+}
+
+// HeldBeforeExDate returns the part of the holding that was held before the ex-date
+func (e Entitlement) HeldBeforeExDate() float64 {
+	return max(e.Quantity-e.SettledSinceExDate, 0)
+}
+
+// EntitledQuantity returns the quantity a dividend is paid on, the holding as of the ex-date
+// with unsettled delivery buys included and unsettled sells excluded
+func (e Entitlement) EntitledQuantity() float64 {
+	return e.HeldBeforeExDate() + e.UnsettledBeforeExDate
+}
+
+// AdjustHolding returns the holding's quantity, average price and current price after a split or
+// bonus with factor. Only the quantity held before the ex-date is multiplied and the cost of the
+// holding is kept, the current price is left alone when nothing was held before the ex-date
+func (e Entitlement) AdjustHolding(factor float64) (quantity, averagePrice, currentPrice float64) {
+	held := e.HeldBeforeExDate()
+	if held == 0 {
+		return e.Quantity, e.AveragePrice, e.CurrentPrice
+	}
+
+	quantity = e.Quantity + held*(factor-1)
+	averagePrice = e.Quantity * e.AveragePrice / quantity
+	return quantity, averagePrice, e.CurrentPrice / factor
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FundsLedgerEntry represents a credit or debit to a user's funds
+// Credits are positive amounts and debits are negative amounts
+type FundsLedgerEntry struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	EntryType   string     `json:"entry_type" db:"entry_type"`
+	Amount      float64    `json:"amount" db:"amount"`
+	ReferenceID *uuid.UUID `json:"reference_id,omitempty" db:"reference_id"`
+	Description string     `json:"description" db:"description"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
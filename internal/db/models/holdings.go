@@ -18,4 +18,5 @@ type Holding struct {
 	TotalValue   float64   `json:"total_value" db:"total_value"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	T1Quantity   float64   `json:"t1_quantity" db:"-"` // net unsettled delivery quantity, derived from trades
 }
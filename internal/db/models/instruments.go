@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Instrument represents a tradable security listed on an exchange
+type Instrument struct {
+	Symbol    string    `json:"symbol" db:"symbol"`
+	Name      string    `json:"name" db:"name"`
+	Exchange  string    `json:"exchange" db:"exchange"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
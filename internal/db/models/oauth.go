@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthClient is a third-party app users can grant access to their account through OAuth2
+type OAuthClient struct {
+	ID       uuid.UUID `json:"id" db:"id"`
+	ClientID string    `json:"client_id" db:"client_id"`
+	// ClientSecretHash is the SHA-256 of the secret of a confidential client, nil for public clients
+	ClientSecretHash *string   `json:"-" db:"client_secret_hash"`
+	Name             string    `json:"name" db:"name"`
+	RedirectURIs     []string  `json:"redirect_uris" db:"redirect_uris"`
+	Scopes           []string  `json:"scopes" db:"scopes"` // the scopes the client may ask for
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+// Confidential reports whether the client authenticates with a secret
+func (c *OAuthClient) Confidential() bool {
+	return c.ClientSecretHash != nil
+}
+
+// OAuthConsent records the scopes a user granted to a client
+type OAuthConsent struct {
+	UserID     uuid.UUID  `json:"-" db:"user_id"`
+	ClientID   string     `json:"client_id" db:"client_id"`
+	ClientName string     `json:"client_name" db:"name"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	GrantedAt  time.Time  `json:"granted_at" db:"granted_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// OAuthAuthorizationCode is a single use code exchanged by the client for tokens, only its hash is stored
+type OAuthAuthorizationCode struct {
+	CodeHash      string    `db:"code_hash"`
+	ClientID      string    `db:"client_id"`
+	UserID        uuid.UUID `db:"user_id"`
+	RedirectURI   string    `db:"redirect_uri"`
+	Scopes        []string  `db:"scopes"`
+	CodeChallenge string    `db:"code_challenge"` // PKCE S256 challenge
+	// FamilyID is the refresh token family the code was exchanged for, set once it is used
+	FamilyID  *uuid.UUID `db:"family_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
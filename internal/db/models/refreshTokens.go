@@ -8,9 +8,16 @@ import (
 
 // RefreshToken represents a refresh token for registered user
 type RefreshToken struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	UserID    uuid.UUID `json:"user_id" db:"user_id"`
-	Token     string    `json:"token" db:"token"`
-	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	FamilyID  uuid.UUID  `json:"family_id" db:"family_id"` // shared by every token rotated from the same login
+	TokenHash string     `json:"-" db:"token_hash"`        // SHA-256 or HMAC of the token, the token itself is never stored
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	ClientInfo
+	// ClientID and Scopes are set for tokens issued to an OAuth client, nil for first-party logins
+	ClientID   *string   `json:"client_id,omitempty" db:"client_id"`
+	Scopes     []string  `json:"scopes,omitempty" db:"scopes"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"` // time of the login that started the family
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClientInfo describes the device a session was created or last refreshed from
+type ClientInfo struct {
+	DeviceName string `json:"device_name" db:"device_name"`
+	UserAgent  string `json:"user_agent" db:"user_agent"`
+	IPAddress  string `json:"ip_address" db:"ip_address"`
+}
+
+// Session is a login of a user on a device, i.e. a refresh token family that still has an active token.
+// Its id is the family id so it stays the same across token rotations.
+type Session struct {
+	ID uuid.UUID `json:"id" db:"family_id"`
+	ClientInfo
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Trade represents an executed trade for a user
+// CNC (delivery) trades are moved into holdings by the settlement job,
+// MIS (intraday) trades never settle into holdings
+type Trade struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	Symbol    string     `json:"symbol" db:"symbol"`
+	Side      string     `json:"side" db:"side"`
+	Product   string     `json:"product" db:"product"`
+	Quantity  float64    `json:"quantity" db:"quantity"`
+	Price     float64    `json:"price" db:"price"`
+	TradeDate time.Time  `json:"trade_date" db:"trade_date"`
+	SettledAt *time.Time `json:"settled_at,omitempty" db:"settled_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserTOTP is the two-factor authentication enrollment of a user, EnabledAt is nil
+// until the user has confirmed the secret with a first code
+type UserTOTP struct {
+	UserID uuid.UUID `json:"user_id" db:"user_id"`
+	// SecretCiphertext is the base32 RFC 6238 secret sealed by auth.EncryptTOTPSecret
+	SecretCiphertext []byte     `json:"-" db:"secret_ciphertext"`
+	EnabledAt        *time.Time `json:"enabled_at,omitempty" db:"enabled_at"`
+	LastUsedStep     *int64     `json:"-" db:"last_used_step"` // time step of the last accepted code, rejects replays
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
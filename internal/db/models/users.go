@@ -6,11 +6,28 @@ import (
 	"github.com/google/uuid"
 )
 
+// Roles of users, staff roles unlock admin endpoints and every other user trades
+const (
+	RoleTrader  = "trader"
+	RoleSupport = "support"
+	RoleRisk    = "risk"
+	RoleAdmin   = "admin"
+)
+
+// Roles lists every role a user can have
+var Roles = []string{RoleTrader, RoleSupport, RoleRisk, RoleAdmin}
+
 // User represents customer regiserted in broker platform
 type User struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	Email        string    `json:"email" db:"email"`
-	PasswordHash string    `json:"-" db:"password_hash"` // password is stored in hash using bcrypt lib
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID                  uuid.UUID  `json:"id" db:"id"`
+	Email               string     `json:"email" db:"email"`
+	PasswordHash        string     `json:"-" db:"password_hash"` // password is stored in hash using bcrypt lib
+	EmailVerified       bool       `json:"email_verified" db:"email_verified"`
+	FailedLoginAttempts int        `json:"-" db:"failed_login_attempts"` // consecutive wrong passwords since the last login or lockout
+	LastFailedLoginAt   *time.Time `json:"-" db:"last_failed_login_at"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+	Role                string     `json:"role" db:"role"`
+	FrozenAt            *time.Time `json:"frozen_at,omitempty" db:"frozen_at"` // set while risk or admin staff froze the account
+	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
 }
@@ -3,11 +3,19 @@ package db
 import (
 	"context"
 	"database/sql"
+	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/metrics"
+	"github.com/prajwalbharadwajbm/broker/internal/tracing"
 	circuit "github.com/rubyist/circuitbreaker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -23,6 +31,7 @@ func GetProtectedClient() *ProtectedDB {
 		dbCircuitBreaker = circuit.NewThresholdBreaker(5)
 
 		logger.Log.Info("Database circuit breaker initialized with threshold: 5")
+		metrics.RegisterCircuitBreakerState(dbCircuitBreaker.Tripped)
 
 		// Subscribe to circuit breaker events for monitoring
 		go func() {
@@ -30,6 +39,7 @@ func GetProtectedClient() *ProtectedDB {
 			for event := range events {
 				switch event {
 				case circuit.BreakerTripped:
+					metrics.CircuitBreakerTrips.Inc()
 					logger.Log.Error("Database circuit breaker OPENED due to failures", nil)
 				case circuit.BreakerReset:
 					logger.Log.Info("Database circuit breaker CLOSED - service recovered")
@@ -54,61 +64,246 @@ type ProtectedDB struct {
 	cb *circuit.Breaker
 }
 
+// tagQuery prefixes the query with a comment naming the request that made it, so the database's
+// statement logs and pg_stat_activity can be matched to the request's log lines. Request ids are
+// validated by the request id middleware to hold only letters, digits and . _ -
+func tagQuery(ctx context.Context, query string) string {
+	requestId, _ := ctx.Value("requestId").(string)
+	if requestId == "" {
+		return query
+	}
+	return "/* request_id=" + requestId + " */ " + query
+}
+
+// startSpan starts the span of a database call, named after the repository function calling the
+// ProtectedDB method and tagged with the circuit breaker state when the call is made
+func (p *ProtectedDB) startSpan(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	name := "db"
+	// skip startSpan and the ProtectedDB method
+	if pc, _, _, ok := runtime.Caller(2); ok {
+		name = runtime.FuncForPC(pc).Name()
+		name = name[strings.LastIndex(name, "/")+1:]
+	}
+	attributes := []attribute.KeyValue{
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperationName(operation),
+		attribute.String("db.query.name", name),
+		attribute.String("db.circuit_breaker.state", p.GetCircuitBreakerState()),
+	}
+	if query != "" {
+		attributes = append(attributes, semconv.DBQueryText(query))
+	}
+	return tracing.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+}
+
+// observe records the latency and outcome of a database call for the metrics endpoint and ends its span
+func observe(span trace.Span, operation string, start time.Time, err error) {
+	metrics.DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.DBQueryErrors.WithLabelValues(operation).Inc()
+	}
+	endSpan(span, err)
+}
+
+// endSpan ends the span of a database call, recording its error
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 // ExecContext executes a query with circuit breaker protection
 func (p *ProtectedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	var result sql.Result
 
+	ctx, span := p.startSpan(ctx, "exec", query)
+	start := time.Now()
 	err := p.cb.Call(func() error {
 		var err error
-		result, err = p.db.ExecContext(ctx, query, args...)
+		result, err = p.db.ExecContext(ctx, tagQuery(ctx, query), args...)
 		return err
 	}, 5*time.Second) // 5 second timeout
+	observe(span, "exec", start, err)
 
 	if err == circuit.ErrBreakerOpen {
-		logger.Log.Error("Database operation blocked - circuit breaker is OPEN", err)
+		logger.FromContext(ctx).Error("Database operation blocked - circuit breaker is OPEN", err)
 		return nil, err
 	}
 
 	return result, err
 }
 
-// QueryContext executes a query with circuit breaker protection
-func (p *ProtectedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+// Rows are the result of ProtectedDB.QueryContext, the query's span and latency cover reading
+// the rows and end when they are closed
+type Rows struct {
+	*sql.Rows
+	finish func(err error)
+	once   sync.Once
+}
+
+// Close closes the rows and ends the query's span, recording any error met while iterating
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() {
+		r.finish(r.Rows.Err())
+	})
+	return err
+}
+
+// QueryContext executes a query with circuit breaker protection, the rows must be closed
+func (p *ProtectedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
 	var rows *sql.Rows
 
+	ctx, span := p.startSpan(ctx, "query", query)
+	start := time.Now()
 	err := p.cb.Call(func() error {
 		var err error
-		rows, err = p.db.QueryContext(ctx, query, args...)
+		rows, err = p.db.QueryContext(ctx, tagQuery(ctx, query), args...)
 		return err
 	}, 5*time.Second) // 5 second timeout
+	if err != nil {
+		observe(span, "query", start, err)
+	}
 
 	if err == circuit.ErrBreakerOpen {
-		logger.Log.Error("Database query blocked - circuit breaker is OPEN", err)
+		logger.FromContext(ctx).Error("Database query blocked - circuit breaker is OPEN", err)
+		return nil, err
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	return rows, err
+	return &Rows{Rows: rows, finish: func(err error) { observe(span, "query", start, err) }}, nil
 }
 
 // QueryRowContext executes a single row query with circuit breaker protection
 func (p *ProtectedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) (*sql.Row, error) {
 	var row *sql.Row
 
+	ctx, span := p.startSpan(ctx, "query_row", query)
+	start := time.Now()
 	err := p.cb.Call(func() error {
-		row = p.db.QueryRowContext(ctx, query, args...)
+		row = p.db.QueryRowContext(ctx, tagQuery(ctx, query), args...)
 		// Note: QueryRow doesn't return an error until Scan() is called
 		// The circuit breaker will handle connection-level errors
 		return nil
 	}, 5*time.Second) // 5 second timeout
+	// the query has run by now, Err reports its failure without waiting for Scan
+	if err == nil && row != nil {
+		observe(span, "query_row", start, row.Err())
+	} else {
+		observe(span, "query_row", start, err)
+	}
 
 	if err == circuit.ErrBreakerOpen {
-		logger.Log.Error("Database query row blocked - circuit breaker is OPEN", err)
+		logger.FromContext(ctx).Error("Database query row blocked - circuit breaker is OPEN", err)
 		return nil, err
 	}
 
 	return row, nil
 }
 
+// Tx is a transaction started by ProtectedDB.BeginTx, its queries are tagged with the request id
+// like those made through ProtectedDB and their latency is recorded under the tx_ operations, as they
+// bypass the circuit breaker. The transaction has a span of its own from BeginTx to Commit
+// or Rollback, parent to the spans of its statements, so time spent waiting on locks and committing
+// is attributed to it
+type Tx struct {
+	*sql.Tx
+	p    *ProtectedDB
+	span trace.Span
+	once sync.Once
+}
+
+// statementContext returns ctx with the transaction's span as the parent of a statement's span
+func (tx *Tx) statementContext(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(ctx, tx.span)
+}
+
+// ExecContext executes a query within the transaction
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := tx.p.startSpan(tx.statementContext(ctx), "exec", query)
+	start := time.Now()
+	result, err := tx.Tx.ExecContext(ctx, tagQuery(ctx, query), args...)
+	observe(span, "tx_exec", start, err)
+	return result, err
+}
+
+// QueryContext executes a query returning rows within the transaction, the rows must be closed
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	ctx, span := tx.p.startSpan(tx.statementContext(ctx), "query", query)
+	start := time.Now()
+	rows, err := tx.Tx.QueryContext(ctx, tagQuery(ctx, query), args...)
+	if err != nil {
+		observe(span, "tx_query", start, err)
+		return nil, err
+	}
+	return &Rows{Rows: rows, finish: func(err error) { observe(span, "tx_query", start, err) }}, nil
+}
+
+// QueryRowContext executes a query returning at most one row within the transaction
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := tx.p.startSpan(tx.statementContext(ctx), "query_row", query)
+	start := time.Now()
+	row := tx.Tx.QueryRowContext(ctx, tagQuery(ctx, query), args...)
+	observe(span, "tx_query_row", start, row.Err())
+	return row
+}
+
+// Commit commits the transaction and ends its span
+func (tx *Tx) Commit() error {
+	_, span := tx.p.startSpan(trace.ContextWithSpan(context.Background(), tx.span), "commit", "")
+	start := time.Now()
+	err := tx.Tx.Commit()
+	observe(span, "commit", start, err)
+	tx.end(err)
+	return err
+}
+
+// Rollback rolls the transaction back and ends its span. A deferred Rollback after Commit leaves
+// the span as Commit ended it
+func (tx *Tx) Rollback() error {
+	err := tx.Tx.Rollback()
+	tx.end(err)
+	return err
+}
+
+// end ends the transaction's span once
+func (tx *Tx) end(err error) {
+	tx.once.Do(func() {
+		endSpan(tx.span, err)
+	})
+}
+
+// BeginTx starts a transaction with circuit breaker protection
+func (p *ProtectedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	var tx *sql.Tx
+
+	txCtx, txSpan := p.startSpan(ctx, "transaction", "")
+	ctx, span := p.startSpan(txCtx, "begin", "")
+	start := time.Now()
+	err := p.cb.Call(func() error {
+		var err error
+		tx, err = p.db.BeginTx(ctx, opts)
+		return err
+	}, 5*time.Second) // 5 second timeout
+	observe(span, "begin", start, err)
+
+	if err == circuit.ErrBreakerOpen {
+		logger.FromContext(ctx).Error("Database transaction blocked - circuit breaker is OPEN", err)
+		endSpan(txSpan, err)
+		return nil, err
+	}
+	if err != nil {
+		endSpan(txSpan, err)
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, p: p, span: txSpan}, nil
+}
+
 // Ping tests database connectivity with circuit breaker protection
 func (p *ProtectedDB) Ping() error {
 	return p.cb.Call(func() error {
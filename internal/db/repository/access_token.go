@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+// RevokeAccessToken adds the jti of an access token to the denylist until the token expires
+func RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO revoked_access_tokens (jti, expires_at) VALUES ($1, $2) 
+			  ON CONFLICT (jti) DO NOTHING`
+	_, err := db.ExecContext(dbCtx, query, jti, expiresAt)
+
+	if err == circuit.ErrBreakerOpen {
+		logger.FromContext(ctx).Error("Revoke access token blocked by circuit breaker", err)
+		return errors.New("authentication service temporarily unavailable")
+	}
+
+	return err
+}
+
+// RevokeUserAccessTokens denies every access token of the user issued at or before the given time,
+// the entry is kept until expiresAt when all those tokens have expired
+func RevokeUserAccessTokens(ctx context.Context, userID string, before, expiresAt time.Time) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO user_access_token_revocations (user_id, revoked_before, expires_at) VALUES ($1, $2, $3) 
+			  ON CONFLICT (user_id) DO UPDATE SET 
+			      revoked_before = GREATEST(user_access_token_revocations.revoked_before, EXCLUDED.revoked_before),
+			      expires_at = GREATEST(user_access_token_revocations.expires_at, EXCLUDED.expires_at)`
+	_, err := db.ExecContext(dbCtx, query, userID, before, expiresAt)
+
+	if err == circuit.ErrBreakerOpen {
+		logger.FromContext(ctx).Error("Revoke user access tokens blocked by circuit breaker", err)
+		return errors.New("authentication service temporarily unavailable")
+	}
+
+	return err
+}
+
+// IsAccessTokenRevoked reports whether the access token is on the denylist by its jti or
+// was issued before its user's tokens were revoked
+func IsAccessTokenRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $1 AND expires_at > NOW()) 
+			      OR EXISTS (SELECT 1 FROM user_access_token_revocations WHERE user_id = $2 AND revoked_before >= $3)`
+	row, err := db.QueryRowContext(dbCtx, query, jti, userID, issuedAt)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Access token revocation check blocked by circuit breaker", err)
+			return false, errors.New("authentication service temporarily unavailable")
+		}
+		return false, err
+	}
+
+	var revoked bool
+	if err := row.Scan(&revoked); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+// CleanupExpiredAccessTokenRevocations removes denylist entries whose tokens have all expired
+func CleanupExpiredAccessTokenRevocations(ctx context.Context) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(dbCtx, `DELETE FROM revoked_access_tokens WHERE expires_at <= NOW()`)
+	if err == nil {
+		_, err = db.ExecContext(dbCtx, `DELETE FROM user_access_token_revocations WHERE expires_at <= NOW()`)
+	}
+
+	if err == circuit.ErrBreakerOpen {
+		logger.FromContext(ctx).Error("Cleanup access token revocations blocked by circuit breaker", err)
+		return errors.New("authentication service temporarily unavailable")
+	}
+
+	return err
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+// ErrAPIKeyNotFound is returned when an API key does not exist, belongs to another user or was revoked
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// CreateAPIKey stores a new API key and returns it with its generated id and creation time
+func CreateAPIKey(ctx context.Context, key models.APIKey) (*models.APIKey, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO api_keys (user_id, key_id, name, secret_ciphertext, scopes, ip_allowlist, expires_at) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+	row, err := db.QueryRowContext(dbCtx, query, key.UserID, key.KeyID, key.Name, key.SecretCiphertext,
+		pq.Array(key.Scopes), pq.Array(key.IPAllowlist), key.ExpiresAt)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("API key creation blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	if err := row.Scan(&key.ID, &key.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeyByKeyID returns the active (not revoked) API key with the public key id, expired keys included.
+// Keys of frozen accounts are not found.
+func GetAPIKeyByKeyID(ctx context.Context, keyID string) (*models.APIKey, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT k.id, k.user_id, k.key_id, k.name, k.secret_ciphertext, k.scopes, k.ip_allowlist, k.expires_at, k.last_used_at, k.created_at 
+			  FROM api_keys k JOIN users u ON u.id = k.user_id 
+			  WHERE k.key_id = $1 AND k.revoked_at IS NULL AND u.frozen_at IS NULL`
+	row, err := db.QueryRowContext(dbCtx, query, keyID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("API key lookup blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	var key models.APIKey
+	err = row.Scan(&key.ID, &key.UserID, &key.KeyID, &key.Name, &key.SecretCiphertext, pq.Array(&key.Scopes),
+		pq.Array(&key.IPAllowlist), &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// GetUserAPIKeys lists the active (not revoked) API keys of the user, newest first
+func GetUserAPIKeys(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT id, user_id, key_id, name, scopes, ip_allowlist, expires_at, last_used_at, created_at 
+			  FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`
+	rows, err := db.QueryContext(dbCtx, query, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("API key listing blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(&key.ID, &key.UserID, &key.KeyID, &key.Name, pq.Array(&key.Scopes),
+			pq.Array(&key.IPAllowlist), &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes an API key of the user, returns ErrAPIKeyNotFound if the user has no such active key
+func RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := db.ExecContext(dbCtx, query, id, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("API key revocation blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records that the API key was just used
+func TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`
+	_, err := db.ExecContext(dbCtx, query, id)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("API key update blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+	return nil
+}
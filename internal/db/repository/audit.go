@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+// auditChainLock is the advisory lock key serializing appends to the audit hash chain
+const auditChainLock = 4640201
+
+// auditEventColumns are the columns scanned by scanAuditEvent
+const auditEventColumns = `id, occurred_at, actor_id, user_id, action, resource, ip, user_agent, request_id, outcome, 
+						   before, after, prev_hash, hash`
+
+// AuditEventFilter narrows an audit event search, zero fields match every event
+type AuditEventFilter struct {
+	UserID  *uuid.UUID
+	ActorID *uuid.UUID
+	Action  string
+	From    *time.Time
+	To      *time.Time
+}
+
+// AppendAuditEvent chains the event to the last one and stores it, setting its ID, PrevHash and Hash.
+// Appends are serialized so every event is chained to the one stored right before it.
+func AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Audit event append blocked by circuit breaker", err)
+			return errors.New("database service temporarily unavailable")
+		}
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(dbCtx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock); err != nil {
+		return err
+	}
+
+	event.PrevHash = models.GenesisAuditHash
+	err = tx.QueryRowContext(dbCtx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&event.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	event.Hash, err = event.ComputeHash()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO audit_events (occurred_at, actor_id, user_id, action, resource, ip, user_agent, request_id, 
+			  outcome, before, after, prev_hash, hash) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`
+	err = tx.QueryRowContext(dbCtx, query, event.OccurredAt, event.ActorID, event.UserID, event.Action, event.Resource,
+		event.IP, event.UserAgent, event.RequestID, event.Outcome, nullJSON(event.Before), nullJSON(event.After),
+		event.PrevHash, event.Hash).Scan(&event.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// nullJSON stores an absent payload as NULL
+func nullJSON(payload []byte) any {
+	if payload == nil {
+		return nil
+	}
+	return string(payload)
+}
+
+// SearchAuditEvents returns the audit events matching the filter, newest first
+func SearchAuditEvents(ctx context.Context, filter AuditEventFilter, limit, offset int) ([]models.AuditEvent, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events 
+			  WHERE ($1::UUID IS NULL OR user_id = $1) 
+			  AND ($2::UUID IS NULL OR actor_id = $2) 
+			  AND ($3 = '' OR action = $3) 
+			  AND ($4::TIMESTAMPTZ IS NULL OR occurred_at >= $4) 
+			  AND ($5::TIMESTAMPTZ IS NULL OR occurred_at < $5) 
+			  ORDER BY id DESC LIMIT $6 OFFSET $7`
+	rows, err := db.QueryContext(dbCtx, query, filter.UserID, filter.ActorID, filter.Action, filter.From, filter.To, limit, offset)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Audit event search blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAuditEvents(rows)
+}
+
+// GetAuditEventsAfter returns up to limit audit events with an id above afterID in chain order
+func GetAuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]models.AuditEvent, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE id > $1 ORDER BY id LIMIT $2`
+	rows, err := db.QueryContext(dbCtx, query, afterID, limit)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Audit chain read blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAuditEvents(rows)
+}
+
+func scanAuditEvents(rows *db.Rows) ([]models.AuditEvent, error) {
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var before, after []byte
+		err := rows.Scan(&event.ID, &event.OccurredAt, &event.ActorID, &event.UserID, &event.Action, &event.Resource,
+			&event.IP, &event.UserAgent, &event.RequestID, &event.Outcome, &before, &after, &event.PrevHash, &event.Hash)
+		if err != nil {
+			return nil, err
+		}
+		event.Before, event.After = before, after
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+// ErrCorporateActionAlreadyApplied is returned when an action was applied by another run
+var ErrCorporateActionAlreadyApplied = errors.New("corporate action already applied")
+
+// CreateCorporateAction stores a new pending corporate action
+func CreateCorporateAction(ctx context.Context, action models.CorporateAction) (*models.CorporateAction, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO corporate_actions (symbol, action_type, ratio_from, ratio_to, dividend_per_share, ex_date) 
+			  VALUES ($1, $2, $3, $4, $5, $6) 
+			  RETURNING id, status, created_at`
+
+	row, err := db.QueryRowContext(dbCtx, query, action.Symbol, action.ActionType, action.RatioFrom,
+		action.RatioTo, action.DividendPerShare, action.ExDate)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Create corporate action blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	err = row.Scan(&action.ID, &action.Status, &action.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &action, nil
+}
+
+// GetCorporateActions retrieves all corporate actions, latest ex-date first
+func GetCorporateActions(ctx context.Context) ([]models.CorporateAction, error) {
+	query := `SELECT id, symbol, action_type, ratio_from, ratio_to, dividend_per_share, ex_date, status, applied_at, created_at 
+			  FROM corporate_actions 
+			  ORDER BY ex_date DESC, created_at DESC`
+	return queryCorporateActions(ctx, query)
+}
+
+// GetDueCorporateActions retrieves pending corporate actions whose ex-date has been reached
+func GetDueCorporateActions(ctx context.Context) ([]models.CorporateAction, error) {
+	query := `SELECT id, symbol, action_type, ratio_from, ratio_to, dividend_per_share, ex_date, status, applied_at, created_at 
+			  FROM corporate_actions 
+			  WHERE status = 'PENDING' AND ex_date <= CURRENT_DATE
+			  ORDER BY ex_date, created_at`
+	return queryCorporateActions(ctx, query)
+}
+
+func queryCorporateActions(ctx context.Context, query string) ([]models.CorporateAction, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(dbCtx, query)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Corporate actions lookup blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []models.CorporateAction{}
+
+	for rows.Next() {
+		var action models.CorporateAction
+		err := rows.Scan(&action.ID, &action.Symbol, &action.ActionType, &action.RatioFrom, &action.RatioTo,
+			&action.DividendPerShare, &action.ExDate, &action.Status, &action.AppliedAt, &action.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// ApplyCorporateAction applies a corporate action within a single transaction.
+// Entitlement is taken as of the ex-date, so a late run does not adjust what was bought after it.
+// Splits and bonuses multiply the quantity held before the ex-date by factor while keeping the cost
+// of the holding, and multiply quantities and divide prices by factor on positions and orderbook
+// entries opened before the ex-date and on delivery trades made before it that have not settled
+// yet, so they settle at post-split terms. Dividends credit quantity * dividend_per_share to the
+// funds ledger for the quantity held before the ex-date, unsettled delivery buys included and
+// unsettled sells excluded.
+func ApplyCorporateAction(ctx context.Context, action models.CorporateAction, factor float64) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			return errors.New("database service temporarily unavailable")
+		}
+		return err
+	}
+	defer tx.Rollback()
+
+	// Mark the action applied first so concurrent runs cannot apply it twice
+	query := `UPDATE corporate_actions SET status = 'APPLIED', applied_at = NOW() WHERE id = $1 AND status = 'PENDING'`
+	result, err := tx.ExecContext(dbCtx, query, action.ID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrCorporateActionAlreadyApplied
+	}
+
+	entitlements, err := corporateActionEntitlements(dbCtx, tx, action)
+	if err != nil {
+		return err
+	}
+
+	switch action.ActionType {
+	case "SPLIT", "BONUS":
+		query = `UPDATE holdings 
+				 SET quantity = $2,
+				     average_price = $3,
+				     current_price = $4,
+				     total_value = $2 * $4,
+				     updated_at = NOW()
+				 WHERE id = $1`
+		for _, entitlement := range entitlements {
+			if entitlement.HoldingID == nil {
+				continue
+			}
+			quantity, averagePrice, currentPrice := entitlement.AdjustHolding(factor)
+			if _, err = tx.ExecContext(dbCtx, query, *entitlement.HoldingID, quantity, averagePrice, currentPrice); err != nil {
+				return err
+			}
+		}
+
+		// positions and orders opened from the ex-date on are already at post-split prices
+		query = `UPDATE positions 
+				 SET quantity = quantity * $2,
+				     entry_price = entry_price / $2,
+				     current_price = current_price / $2,
+				     updated_at = NOW()
+				 WHERE symbol = $1 AND created_at < $3`
+		if _, err = tx.ExecContext(dbCtx, query, action.Symbol, factor, action.ExDate); err != nil {
+			return err
+		}
+
+		query = `UPDATE orderbook 
+				 SET quantity = quantity * $2,
+				     price = price / $2,
+				     updated_at = NOW()
+				 WHERE symbol = $1 AND created_at < $3`
+		if _, err = tx.ExecContext(dbCtx, query, action.Symbol, factor, action.ExDate); err != nil {
+			return err
+		}
+
+		// trades from the ex-date on are already at post-split prices
+		query = `UPDATE trades 
+				 SET quantity = quantity * $2,
+				     price = price / $2
+				 WHERE symbol = $1 AND product = 'CNC' AND settled_at IS NULL AND trade_date < $3`
+		if _, err = tx.ExecContext(dbCtx, query, action.Symbol, factor, action.ExDate); err != nil {
+			return err
+		}
+	case "DIVIDEND":
+		query = `INSERT INTO funds_ledger (user_id, entry_type, amount, reference_id, description) 
+				 VALUES ($1, 'DIVIDEND', $2, $3, $4)`
+		for _, entitlement := range entitlements {
+			quantity := entitlement.EntitledQuantity()
+			if quantity <= 0 {
+				continue
+			}
+			if _, err = tx.ExecContext(dbCtx, query, entitlement.UserID, quantity*action.DividendPerShare, action.ID, "Dividend for "+action.Symbol); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// corporateActionEntitlements locks the holdings of the action's symbol and reads each user's
+// holding along with the net delivery trades that settled since the ex-date and those made
+// before it that are still unsettled
+func corporateActionEntitlements(ctx context.Context, tx *db.Tx, action models.CorporateAction) ([]models.Entitlement, error) {
+	query := `SELECT id FROM holdings WHERE symbol = $1 FOR UPDATE`
+	if _, err := tx.ExecContext(ctx, query, action.Symbol); err != nil {
+		return nil, err
+	}
+
+	query = `WITH net AS (
+				 SELECT user_id,
+				        SUM(CASE WHEN settled_at IS NOT NULL AND trade_date >= $2 THEN signed ELSE 0 END) AS settled_since,
+				        SUM(CASE WHEN settled_at IS NULL AND trade_date < $2 THEN signed ELSE 0 END) AS unsettled_before
+				 FROM (
+				     SELECT user_id, settled_at, trade_date,
+				            CASE WHEN side = 'BUY' THEN quantity ELSE -quantity END AS signed
+				     FROM trades
+				     WHERE symbol = $1 AND product = 'CNC' AND (trade_date >= $2 OR settled_at IS NULL)
+				 ) t
+				 GROUP BY user_id
+			 )
+			 SELECT COALESCE(h.user_id, n.user_id), h.id,
+			        COALESCE(h.quantity, 0), COALESCE(h.average_price, 0), COALESCE(h.current_price, 0),
+			        COALESCE(n.settled_since, 0), COALESCE(n.unsettled_before, 0)
+			 FROM (SELECT * FROM holdings WHERE symbol = $1) h
+			 FULL OUTER JOIN net n ON n.user_id = h.user_id`
+	rows, err := tx.QueryContext(ctx, query, action.Symbol, action.ExDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entitlements []models.Entitlement
+	for rows.Next() {
+		var entitlement models.Entitlement
+		err := rows.Scan(
+			&entitlement.UserID,
+			&entitlement.HoldingID,
+			&entitlement.Quantity,
+			&entitlement.AveragePrice,
+			&entitlement.CurrentPrice,
+			&entitlement.SettledSinceExDate,
+			&entitlement.UnsettledBeforeExDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entitlements = append(entitlements, entitlement)
+	}
+
+	return entitlements, rows.Err()
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"time"
 
@@ -12,17 +13,33 @@ import (
 	circuit "github.com/rubyist/circuitbreaker"
 )
 
+var (
+	// ErrHoldingNotFound is returned when no holding with the id exists for the user
+	ErrHoldingNotFound = errors.New("holding not found")
+	// ErrInsufficientHoldings is returned when a sell is larger than the holding quantity
+	ErrInsufficientHoldings = errors.New("insufficient holding quantity")
+)
+
+// HoldingUpdate holds the optional fields of a partial holding update, nil fields are left unchanged
+type HoldingUpdate struct {
+	Quantity     *float64
+	AveragePrice *float64
+	CurrentPrice *float64
+	SellQuantity *float64
+}
+
 func GetHoldings(ctx context.Context, userId uuid.UUID) ([]models.Holding, error) {
 	db := db.GetProtectedClient()
 
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	query := `SELECT * FROM holdings WHERE user_id=$1`
+	query := `SELECT id, user_id, symbol, quantity, average_price, current_price, total_value, created_at, updated_at 
+			  FROM holdings WHERE user_id=$1`
 	rows, err := db.QueryContext(dbCtx, query, userId)
 	if err != nil {
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("Holdings lookup blocked by circuit breaker", err)
+			logger.FromContext(ctx).Error("Holdings lookup blocked by circuit breaker", err)
 			return nil, errors.New("database service temporarily unavailable")
 		}
 		return nil, err
@@ -43,21 +60,163 @@ func GetHoldings(ctx context.Context, userId uuid.UUID) ([]models.Holding, error
 	return holdings, nil
 }
 
-func AddHolding(ctx context.Context, holding models.Holding) error {
+// GetHolding returns a holding owned by the user, or ErrHoldingNotFound
+func GetHolding(ctx context.Context, id, userID uuid.UUID) (*models.Holding, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT id, user_id, symbol, quantity, average_price, current_price, total_value, created_at, updated_at 
+			  FROM holdings WHERE id = $1 AND user_id = $2`
+	row, err := db.QueryRowContext(dbCtx, query, id, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Holdings lookup blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	var holding models.Holding
+	err = row.Scan(&holding.ID, &holding.UserID, &holding.Symbol, &holding.Quantity, &holding.AveragePrice, &holding.CurrentPrice, &holding.TotalValue, &holding.CreatedAt, &holding.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrHoldingNotFound
+		}
+		return nil, err
+	}
+
+	return &holding, nil
+}
+
+// AddHolding adds a lot to the user's holding of the symbol. A second lot of an existing
+// symbol is merged into the same row with a recomputed weighted average price.
+// total_value is always derived as quantity * current_price.
+func AddHolding(ctx context.Context, holding models.Holding) (*models.Holding, error) {
 	db := db.GetProtectedClient()
 
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	query := `INSERT INTO holdings (user_id, symbol, quantity, average_price, current_price, total_value) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := db.ExecContext(dbCtx, query, holding.UserID, holding.Symbol, holding.Quantity, holding.AveragePrice, holding.CurrentPrice, holding.TotalValue)
+	query := `INSERT INTO holdings (user_id, symbol, quantity, average_price, current_price, total_value) 
+			  VALUES ($1, $2, $3, $4, $5, $3::numeric * $5::numeric) 
+			  ON CONFLICT (user_id, symbol) DO UPDATE SET 
+			      average_price = (holdings.quantity * holdings.average_price + EXCLUDED.quantity * EXCLUDED.average_price) / (holdings.quantity + EXCLUDED.quantity),
+			      quantity = holdings.quantity + EXCLUDED.quantity,
+			      current_price = EXCLUDED.current_price,
+			      total_value = (holdings.quantity + EXCLUDED.quantity) * EXCLUDED.current_price,
+			      updated_at = NOW() 
+			  RETURNING id, user_id, symbol, quantity, average_price, current_price, total_value, created_at, updated_at`
+	row, err := db.QueryRowContext(dbCtx, query, holding.UserID, holding.Symbol, holding.Quantity, holding.AveragePrice, holding.CurrentPrice)
 	if err != nil {
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("Holdings lookup blocked by circuit breaker", err)
+			logger.FromContext(ctx).Error("Holdings lookup blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	var saved models.Holding
+	err = row.Scan(&saved.ID, &saved.UserID, &saved.Symbol, &saved.Quantity, &saved.AveragePrice, &saved.CurrentPrice, &saved.TotalValue, &saved.CreatedAt, &saved.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+// UpdateHolding applies a partial update to a holding owned by the user.
+// A sell that brings the quantity to zero removes the holding.
+func UpdateHolding(ctx context.Context, id, userID uuid.UUID, update HoldingUpdate) (*models.Holding, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Holdings update blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var holding models.Holding
+	query := `SELECT id, user_id, symbol, quantity, average_price, current_price, total_value, created_at, updated_at 
+			  FROM holdings WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	err = tx.QueryRowContext(dbCtx, query, id, userID).Scan(&holding.ID, &holding.UserID, &holding.Symbol, &holding.Quantity,
+		&holding.AveragePrice, &holding.CurrentPrice, &holding.TotalValue, &holding.CreatedAt, &holding.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrHoldingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Quantity != nil {
+		holding.Quantity = *update.Quantity
+	}
+	if update.AveragePrice != nil {
+		holding.AveragePrice = *update.AveragePrice
+	}
+	if update.CurrentPrice != nil {
+		holding.CurrentPrice = *update.CurrentPrice
+	}
+	if update.SellQuantity != nil {
+		if *update.SellQuantity > holding.Quantity {
+			return nil, ErrInsufficientHoldings
+		}
+		holding.Quantity -= *update.SellQuantity
+	}
+	holding.TotalValue = holding.Quantity * holding.CurrentPrice
+
+	if holding.Quantity == 0 {
+		if _, err = tx.ExecContext(dbCtx, `DELETE FROM holdings WHERE id = $1`, holding.ID); err != nil {
+			return nil, err
+		}
+		return &holding, tx.Commit()
+	}
+
+	query = `UPDATE holdings 
+			 SET quantity = $2, average_price = $3, current_price = $4, total_value = $5, updated_at = NOW() 
+			 WHERE id = $1 
+			 RETURNING updated_at`
+	err = tx.QueryRowContext(dbCtx, query, holding.ID, holding.Quantity, holding.AveragePrice,
+		holding.CurrentPrice, holding.TotalValue).Scan(&holding.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &holding, tx.Commit()
+}
+
+// DeleteHolding removes a holding owned by the user
+func DeleteHolding(ctx context.Context, id, userID uuid.UUID) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM holdings WHERE id = $1 AND user_id = $2`
+	result, err := db.ExecContext(dbCtx, query, id, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Holdings delete blocked by circuit breaker", err)
 			return errors.New("database service temporarily unavailable")
 		}
 		return err
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrHoldingNotFound
+	}
+
 	return nil
 }
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+// InstrumentExists reports whether the symbol is a listed instrument
+func InstrumentExists(ctx context.Context, symbol string) (bool, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM instruments WHERE symbol = $1)`
+	row, err := db.QueryRowContext(dbCtx, query, symbol)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Instrument lookup blocked by circuit breaker", err)
+			return false, errors.New("database service temporarily unavailable")
+		}
+		return false, err
+	}
+
+	if err = row.Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
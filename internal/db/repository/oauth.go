@@ -0,0 +1,348 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+var (
+	// ErrOAuthClientNotFound is returned when no OAuth client has the client id
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	// ErrOAuthConsentNotFound is returned when the user has no active consent for the client
+	ErrOAuthConsentNotFound = errors.New("oauth consent not found")
+	// ErrAuthorizationCodeInvalid is returned when an authorization code does not exist or has expired
+	ErrAuthorizationCodeInvalid = errors.New("authorization code invalid")
+	// ErrAuthorizationCodeReused is returned when an authorization code is exchanged a second time.
+	// The tokens issued for its first exchange have been revoked by then.
+	ErrAuthorizationCodeReused = errors.New("authorization code reused")
+)
+
+// CreateOAuthClient registers an OAuth client and returns it with its generated id and creation time
+func CreateOAuthClient(ctx context.Context, client models.OAuthClient) (*models.OAuthClient, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO oauth_clients (client_id, client_secret_hash, name, redirect_uris, scopes) 
+			  VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	row, err := db.QueryRowContext(dbCtx, query, client.ClientID, client.ClientSecretHash, client.Name,
+		pq.Array(client.RedirectURIs), pq.Array(client.Scopes))
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("OAuth client registration blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	if err := row.Scan(&client.ID, &client.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// GetOAuthClient returns the OAuth client with the public client id
+func GetOAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT id, client_id, client_secret_hash, name, redirect_uris, scopes, created_at 
+			  FROM oauth_clients WHERE client_id = $1`
+	row, err := db.QueryRowContext(dbCtx, query, clientID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("OAuth client lookup blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	var client models.OAuthClient
+	err = row.Scan(&client.ID, &client.ClientID, &client.ClientSecretHash, &client.Name,
+		pq.Array(&client.RedirectURIs), pq.Array(&client.Scopes), &client.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// GetOAuthClients lists every registered OAuth client, newest first
+func GetOAuthClients(ctx context.Context) ([]models.OAuthClient, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT id, client_id, client_secret_hash, name, redirect_uris, scopes, created_at 
+			  FROM oauth_clients ORDER BY created_at DESC`
+	rows, err := db.QueryContext(dbCtx, query)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("OAuth client listing blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []models.OAuthClient{}
+	for rows.Next() {
+		var client models.OAuthClient
+		err := rows.Scan(&client.ID, &client.ClientID, &client.ClientSecretHash, &client.Name,
+			pq.Array(&client.RedirectURIs), pq.Array(&client.Scopes), &client.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+// SaveOAuthConsent records that the user granted the scopes to the client, replacing an earlier or revoked consent
+func SaveOAuthConsent(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO oauth_consents (user_id, client_id, scopes) VALUES ($1, $2, $3) 
+			  ON CONFLICT (user_id, client_id) 
+			  DO UPDATE SET scopes = EXCLUDED.scopes, granted_at = NOW(), revoked_at = NULL`
+	_, err := db.ExecContext(dbCtx, query, userID, clientID, pq.Array(scopes))
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("OAuth consent update blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+	return nil
+}
+
+// GetOAuthConsent returns the active consent of the user for the client
+func GetOAuthConsent(ctx context.Context, userID uuid.UUID, clientID string) (*models.OAuthConsent, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT oc.user_id, oc.client_id, c.name, oc.scopes, oc.granted_at 
+			  FROM oauth_consents oc JOIN oauth_clients c ON c.client_id = oc.client_id 
+			  WHERE oc.user_id = $1 AND oc.client_id = $2 AND oc.revoked_at IS NULL`
+	row, err := db.QueryRowContext(dbCtx, query, userID, clientID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("OAuth consent lookup blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	var consent models.OAuthConsent
+	err = row.Scan(&consent.UserID, &consent.ClientID, &consent.ClientName, pq.Array(&consent.Scopes), &consent.GrantedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOAuthConsentNotFound
+		}
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+// GetUserOAuthConsents lists the apps the user granted access to, including revoked consents, newest first
+func GetUserOAuthConsents(ctx context.Context, userID uuid.UUID) ([]models.OAuthConsent, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT oc.user_id, oc.client_id, c.name, oc.scopes, oc.granted_at, oc.revoked_at 
+			  FROM oauth_consents oc JOIN oauth_clients c ON c.client_id = oc.client_id 
+			  WHERE oc.user_id = $1 ORDER BY oc.granted_at DESC`
+	rows, err := db.QueryContext(dbCtx, query, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("OAuth consent listing blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := []models.OAuthConsent{}
+	for rows.Next() {
+		var consent models.OAuthConsent
+		err := rows.Scan(&consent.UserID, &consent.ClientID, &consent.ClientName, pq.Array(&consent.Scopes),
+			&consent.GrantedAt, &consent.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, rows.Err()
+}
+
+// RevokeOAuthConsent revokes the consent of the user for the client along with the refresh tokens issued to
+// the client, returns ErrOAuthConsentNotFound if the user has no active consent for it
+func RevokeOAuthConsent(ctx context.Context, userID uuid.UUID, clientID string) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("OAuth consent revocation blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE oauth_consents SET revoked_at = NOW() WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL`
+	result, err := tx.ExecContext(dbCtx, query, userID, clientID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrOAuthConsentNotFound
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL`
+	if _, err := tx.ExecContext(dbCtx, query, userID, clientID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateAuthorizationCode stores the hash of an authorization code
+func CreateAuthorizationCode(ctx context.Context, code models.OAuthAuthorizationCode) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := db.ExecContext(dbCtx, query, code.CodeHash, code.ClientID, code.UserID, code.RedirectURI,
+		pq.Array(code.Scopes), code.CodeChallenge, code.ExpiresAt)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Authorization code creation blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+	return nil
+}
+
+// UseAuthorizationCode marks the code as used for the refresh token family familyID and returns it, so a code
+// is only ever exchanged once. The code is locked while matches checks the exchange request against it, a code
+// that does not match is left untouched and reported as ErrAuthorizationCodeInvalid. Presenting a used code in
+// a matching request revokes the family of its first exchange and returns ErrAuthorizationCodeReused. Codes of
+// frozen accounts are invalid.
+func UseAuthorizationCode(ctx context.Context, codeHash string, familyID uuid.UUID, matches func(*models.OAuthAuthorizationCode) bool) (*models.OAuthAuthorizationCode, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Authorization code exchange blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var code models.OAuthAuthorizationCode
+	query := `SELECT code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, expires_at, used_at 
+			  FROM oauth_authorization_codes c WHERE code_hash = $1 AND expires_at > NOW() 
+			  AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = c.user_id AND u.frozen_at IS NOT NULL) 
+			  FOR UPDATE`
+	err = tx.QueryRowContext(dbCtx, query, codeHash).Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI,
+		pq.Array(&code.Scopes), &code.CodeChallenge, &code.FamilyID, &code.ExpiresAt, &code.UsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAuthorizationCodeInvalid
+		}
+		return nil, err
+	}
+
+	// checked before the reuse below, so a stolen code without the client's redirect URI and PKCE verifier
+	// can neither be exchanged nor revoke the tokens it was exchanged for
+	if !matches(&code) {
+		return nil, ErrAuthorizationCodeInvalid
+	}
+
+	if code.UsedAt != nil {
+		if code.FamilyID != nil {
+			query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+			if _, err := tx.ExecContext(dbCtx, query, *code.FamilyID); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &code, ErrAuthorizationCodeReused
+	}
+
+	query = `UPDATE oauth_authorization_codes SET used_at = NOW(), family_id = $2 WHERE code_hash = $1`
+	if _, err := tx.ExecContext(dbCtx, query, codeHash, familyID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	code.FamilyID = &familyID
+	return &code, nil
+}
+
+// CleanupExpiredAuthorizationCodes removes authorization codes that expired over a day ago, used codes are kept
+// that long so a late replay is still recognised
+func CleanupExpiredAuthorizationCodes(ctx context.Context) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM oauth_authorization_codes WHERE expires_at < NOW() - INTERVAL '1 day'`
+	_, err := db.ExecContext(dbCtx, query)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Authorization code cleanup blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+	return nil
+}
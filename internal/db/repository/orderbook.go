@@ -27,7 +27,7 @@ func GetOrderbookEntries(ctx context.Context) ([]models.OrderbookEntry, error) {
 	rows, err := db.QueryContext(dbCtx, query)
 	if err != nil {
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("Orderbook lookup blocked by circuit breaker", err)
+			logger.FromContext(ctx).Error("Orderbook lookup blocked by circuit breaker", err)
 			return nil, errors.New("database service temporarily unavailable")
 		}
 		return nil, err
@@ -69,7 +69,7 @@ func GetOrderbookEntriesBySymbol(ctx context.Context, symbol string) ([]models.O
 	rows, err := db.QueryContext(dbCtx, query, symbol)
 	if err != nil {
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("Orderbook lookup blocked by circuit breaker", err)
+			logger.FromContext(ctx).Error("Orderbook lookup blocked by circuit breaker", err)
 			return nil, errors.New("database service temporarily unavailable")
 		}
 		return nil, err
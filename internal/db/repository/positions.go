@@ -26,7 +26,7 @@ func GetUserPositions(ctx context.Context, userID uuid.UUID) ([]models.Position,
 	rows, err := db.QueryContext(dbCtx, query, userID)
 	if err != nil {
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("Positions lookup blocked by circuit breaker", err)
+			logger.FromContext(ctx).Error("Positions lookup blocked by circuit breaker", err)
 			return nil, errors.New("database service temporarily unavailable")
 		}
 		return nil, err
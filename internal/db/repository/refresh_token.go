@@ -7,33 +7,68 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
 	"github.com/prajwalbharadwajbm/broker/internal/db"
 	"github.com/prajwalbharadwajbm/broker/internal/db/models"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
 	circuit "github.com/rubyist/circuitbreaker"
 )
 
-// CreateRefreshToken stores a new refresh token in the database
-func CreateRefreshToken(ctx context.Context, userID uuid.UUID, token string, expiresAt time.Time) (*models.RefreshToken, error) {
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+// while its family still has an active token. The whole family has been revoked by then.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// hashRefreshToken returns the value stored for a refresh token, the raw token never reaches the database
+func hashRefreshToken(token string) string {
+	return utils.HashToken(token, config.AppConfigInstance.RefreshTokenPepper)
+}
+
+// ErrSessionNotFound is returned when a session does not exist, has expired or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateRefreshToken stores the hash of a new refresh token in the database. Every login starts a new
+// family and tokens issued by rotation stay in the family of the token they replace.
+func CreateRefreshToken(ctx context.Context, userID, familyID uuid.UUID, token string, expiresAt time.Time, client models.ClientInfo) (*models.RefreshToken, error) {
+	return createRefreshToken(ctx, &models.RefreshToken{
+		UserID:     userID,
+		FamilyID:   familyID,
+		TokenHash:  hashRefreshToken(token),
+		ExpiresAt:  expiresAt,
+		ClientInfo: client,
+	})
+}
+
+// CreateOAuthRefreshToken stores the hash of a refresh token issued to an OAuth client for the scopes the user granted,
+// starting a new family
+func CreateOAuthRefreshToken(ctx context.Context, userID, familyID uuid.UUID, clientID string, scopes []string, token string, expiresAt time.Time, client models.ClientInfo) (*models.RefreshToken, error) {
+	return createRefreshToken(ctx, &models.RefreshToken{
+		UserID:     userID,
+		FamilyID:   familyID,
+		TokenHash:  hashRefreshToken(token),
+		ExpiresAt:  expiresAt,
+		ClientInfo: client,
+		ClientID:   &clientID,
+		Scopes:     scopes,
+	})
+}
+
+func createRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) (*models.RefreshToken, error) {
 	db := db.GetProtectedClient()
 
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	refreshToken := &models.RefreshToken{
-		UserID:    userID,
-		Token:     token,
-		ExpiresAt: expiresAt,
-	}
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, device_name, user_agent, ip_address, client_id, scopes) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 
-	query := `INSERT INTO refresh_tokens (user_id, token, expires_at) 
-			  VALUES ($1, $2, $3)`
-
-	_, err := db.ExecContext(dbCtx, query, refreshToken.UserID,
-		refreshToken.Token, refreshToken.ExpiresAt)
+	_, err := db.ExecContext(dbCtx, query, refreshToken.UserID, refreshToken.FamilyID, refreshToken.TokenHash,
+		refreshToken.ExpiresAt, refreshToken.DeviceName, refreshToken.UserAgent, refreshToken.IPAddress,
+		refreshToken.ClientID, scopesArray(refreshToken.Scopes))
 	if err != nil {
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("Create refresh token blocked by circuit breaker", err)
+			logger.FromContext(ctx).Error("Create refresh token blocked by circuit breaker", err)
 			return nil, errors.New("authentication service temporarily unavailable")
 		}
 		return nil, err
@@ -42,8 +77,16 @@ func CreateRefreshToken(ctx context.Context, userID uuid.UUID, token string, exp
 	return refreshToken, nil
 }
 
-// ValidateRefreshToken retrieves and validates a refresh token by its token value
-// Returns nil if token is not found or expired
+// scopesArray stores nil scopes, those of first-party tokens, as NULL
+func scopesArray(scopes []string) interface{} {
+	if scopes == nil {
+		return nil
+	}
+	return pq.Array(scopes)
+}
+
+// ValidateRefreshToken retrieves and validates a refresh token by the hash of its token value
+// Returns nil if token is not found, expired or revoked
 func ValidateRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
 	db := db.GetProtectedClient()
 
@@ -52,23 +95,27 @@ func ValidateRefreshToken(ctx context.Context, token string) (*models.RefreshTok
 
 	var refreshToken models.RefreshToken
 
-	query := `SELECT user_id, token, expires_at 
+	query := `SELECT id, user_id, family_id, token_hash, expires_at, client_id, scopes 
 			  FROM refresh_tokens 
-			  WHERE token = $1 AND expires_at > NOW() AT TIME ZONE 'UTC'`
+			  WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW() AT TIME ZONE 'UTC'`
 
-	row, err := db.QueryRowContext(dbCtx, query, token)
+	row, err := db.QueryRowContext(dbCtx, query, hashRefreshToken(token))
 	if err != nil {
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("Validate refresh token blocked by circuit breaker", err)
+			logger.FromContext(ctx).Error("Validate refresh token blocked by circuit breaker", err)
 			return nil, errors.New("authentication service temporarily unavailable")
 		}
 		return nil, err
 	}
 
 	err = row.Scan(
+		&refreshToken.ID,
 		&refreshToken.UserID,
-		&refreshToken.Token,
+		&refreshToken.FamilyID,
+		&refreshToken.TokenHash,
 		&refreshToken.ExpiresAt,
+		&refreshToken.ClientID,
+		pq.Array(&refreshToken.Scopes),
 	)
 
 	if err != nil {
@@ -81,43 +128,202 @@ func ValidateRefreshToken(ctx context.Context, token string) (*models.RefreshTok
 	return &refreshToken, nil
 }
 
-// RevokeRefreshToken deletes a refresh token from the database
+// RotateRefreshToken revokes the presented token and issues newToken in the same family.
+// The new token keeps the session's creation time, device name, OAuth client and scopes and records client
+// as last used from. clientID is the OAuth client the token must have been issued to, nil for first-party tokens.
+// Returns nil if the token is not found, expired or issued to another client. Presenting a token that was already
+// rotated revokes every active token of its family and returns ErrRefreshTokenReused,
+// a replay of a token whose family is fully revoked (e.g. after logout) is just invalid.
+func RotateRefreshToken(ctx context.Context, token, newToken string, clientID *string, expiresAt time.Time, client models.ClientInfo) (*models.RefreshToken, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Rotate refresh token blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current models.RefreshToken
+	query := `SELECT id, user_id, family_id, revoked_at, device_name, client_id, scopes, created_at 
+			  FROM refresh_tokens 
+			  WHERE token_hash = $1 AND client_id IS NOT DISTINCT FROM $2 AND expires_at > NOW() AT TIME ZONE 'UTC' 
+			  FOR UPDATE`
+	err = tx.QueryRowContext(dbCtx, query, hashRefreshToken(token), clientID).
+		Scan(&current.ID, &current.UserID, &current.FamilyID, &current.RevokedAt, &current.DeviceName,
+			&current.ClientID, pq.Array(&current.Scopes), &current.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Token not found or expired
+		}
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+		result, err := tx.ExecContext(dbCtx, query, current.FamilyID)
+		if err != nil {
+			return nil, err
+		}
+		revoked, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if revoked == 0 {
+			return nil, nil
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &current, ErrRefreshTokenReused
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = $1`
+	if _, err := tx.ExecContext(dbCtx, query, current.ID); err != nil {
+		return nil, err
+	}
+
+	if client.DeviceName == "" {
+		client.DeviceName = current.DeviceName
+	}
+	rotated := &models.RefreshToken{
+		UserID:     current.UserID,
+		FamilyID:   current.FamilyID,
+		TokenHash:  hashRefreshToken(newToken),
+		ExpiresAt:  expiresAt,
+		ClientInfo: client,
+		ClientID:   current.ClientID,
+		Scopes:     current.Scopes,
+		CreatedAt:  current.CreatedAt,
+	}
+	query = `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, device_name, user_agent, ip_address, client_id, scopes, created_at, last_used_at) 
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW()) 
+			 RETURNING id, last_used_at`
+	err = tx.QueryRowContext(dbCtx, query, rotated.UserID, rotated.FamilyID, rotated.TokenHash, rotated.ExpiresAt,
+		client.DeviceName, client.UserAgent, client.IPAddress, rotated.ClientID, scopesArray(rotated.Scopes), rotated.CreatedAt).
+		Scan(&rotated.ID, &rotated.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+// RevokeRefreshToken revokes a refresh token along with the rest of its family
 func RevokeRefreshToken(ctx context.Context, token string) error {
 	db := db.GetProtectedClient()
 
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	query := `DELETE FROM refresh_tokens WHERE token = $1`
-	_, err := db.ExecContext(dbCtx, query, token)
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() 
+			  WHERE revoked_at IS NULL 
+			    AND family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1)`
+	_, err := db.ExecContext(dbCtx, query, hashRefreshToken(token))
 
 	if err == circuit.ErrBreakerOpen {
-		logger.Log.Error("Revoke refresh token blocked by circuit breaker", err)
+		logger.FromContext(ctx).Error("Revoke refresh token blocked by circuit breaker", err)
 		return errors.New("authentication service temporarily unavailable")
 	}
 
 	return err
 }
 
-// RevokeAllUserRefreshTokens deletes all refresh tokens for a specific user
+// GetActiveSessions returns the sessions of a user, one per token family with an active refresh token,
+// most recently used first. Grants to OAuth clients are not sessions, they are managed as consents.
+func GetActiveSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT family_id, device_name, user_agent, ip_address, created_at, last_used_at, expires_at 
+			  FROM refresh_tokens 
+			  WHERE user_id = $1 AND client_id IS NULL AND revoked_at IS NULL AND expires_at > NOW() AT TIME ZONE 'UTC' 
+			  ORDER BY last_used_at DESC`
+	rows, err := db.QueryContext(dbCtx, query, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Sessions lookup blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.DeviceName, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes the refresh tokens of one session of the user,
+// returns ErrSessionNotFound if the user has no such active session
+func RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() 
+			  WHERE user_id = $1 AND family_id = $2 AND client_id IS NULL AND revoked_at IS NULL AND expires_at > NOW() AT TIME ZONE 'UTC'`
+	result, err := db.ExecContext(dbCtx, query, userID, sessionID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Revoke session blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeAllUserRefreshTokens revokes all refresh tokens for a specific user
 func RevokeAllUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
 	db := db.GetProtectedClient()
 
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
 	_, err := db.ExecContext(dbCtx, query, userID)
 
 	if err == circuit.ErrBreakerOpen {
-		logger.Log.Error("Revoke all user refresh tokens blocked by circuit breaker", err)
+		logger.FromContext(ctx).Error("Revoke all user refresh tokens blocked by circuit breaker", err)
 		return errors.New("authentication service temporarily unavailable")
 	}
 
 	return err
 }
 
-// CleanupExpiredTokens removes all expired refresh tokens
+// CleanupExpiredTokens removes all expired refresh tokens, revoked tokens are kept
+// until they expire so that a replay is still recognised as reuse
 func CleanupExpiredTokens(ctx context.Context) error {
 	db := db.GetProtectedClient()
 
@@ -128,7 +334,7 @@ func CleanupExpiredTokens(ctx context.Context) error {
 	_, err := db.ExecContext(dbCtx, query)
 
 	if err == circuit.ErrBreakerOpen {
-		logger.Log.Error("Cleanup expired tokens blocked by circuit breaker", err)
+		logger.FromContext(ctx).Error("Cleanup expired tokens blocked by circuit breaker", err)
 		return errors.New("authentication service temporarily unavailable")
 	}
 
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+var (
+	// ErrTOTPNotFound is returned when the user has not enrolled in two-factor authentication
+	ErrTOTPNotFound = errors.New("totp not enrolled")
+	// ErrTOTPAlreadyEnabled is returned when enrolling or confirming while two-factor authentication is already on
+	ErrTOTPAlreadyEnabled = errors.New("totp already enabled")
+)
+
+// GetTOTP returns the two-factor enrollment of the user, pending or enabled
+func GetTOTP(ctx context.Context, userID uuid.UUID) (*models.UserTOTP, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT user_id, secret_ciphertext, enabled_at, last_used_step, created_at FROM user_totp WHERE user_id = $1`
+	row, err := db.QueryRowContext(dbCtx, query, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("TOTP lookup blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	var totp models.UserTOTP
+	err = row.Scan(&totp.UserID, &totp.SecretCiphertext, &totp.EnabledAt, &totp.LastUsedStep, &totp.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTOTPNotFound
+		}
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+// SavePendingTOTP stores a new encrypted secret awaiting confirmation, replacing an earlier unconfirmed one.
+// Returns ErrTOTPAlreadyEnabled if two-factor authentication is already on.
+func SavePendingTOTP(ctx context.Context, userID uuid.UUID, secretCiphertext []byte) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO user_totp (user_id, secret_ciphertext) VALUES ($1, $2) 
+			  ON CONFLICT (user_id) DO UPDATE SET secret_ciphertext = EXCLUDED.secret_ciphertext, secret = NULL, 
+			  last_used_step = NULL, created_at = NOW() 
+			  WHERE user_totp.enabled_at IS NULL`
+	result, err := db.ExecContext(dbCtx, query, userID, secretCiphertext)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("TOTP enrollment blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+// GetPlaintextTOTPSecrets returns the secrets stored unencrypted before migration 019 by user id
+func GetPlaintextTOTPSecrets(ctx context.Context) (map[uuid.UUID]string, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	query := `SELECT user_id, secret FROM user_totp WHERE secret IS NOT NULL`
+	rows, err := db.QueryContext(dbCtx, query)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("TOTP secret lookup blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	secrets := make(map[uuid.UUID]string)
+	for rows.Next() {
+		var userID uuid.UUID
+		var secret string
+		if err := rows.Scan(&userID, &secret); err != nil {
+			return nil, err
+		}
+		secrets[userID] = secret
+	}
+
+	return secrets, rows.Err()
+}
+
+// StoreEncryptedTOTPSecret replaces the plaintext secret of the user with its ciphertext,
+// unless the secret was changed in the meantime
+func StoreEncryptedTOTPSecret(ctx context.Context, userID uuid.UUID, secret string, secretCiphertext []byte) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE user_totp SET secret_ciphertext = $3, secret = NULL WHERE user_id = $1 AND secret = $2`
+	_, err := db.ExecContext(dbCtx, query, userID, secret, secretCiphertext)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("TOTP secret encryption blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// EnableTOTP turns on a pending enrollment once its first code (of time step step) was verified
+// and replaces the user's backup codes with the given hashes
+func EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, backupCodeHashes []string) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("TOTP enable blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE user_totp SET enabled_at = NOW(), last_used_step = $2 WHERE user_id = $1 AND enabled_at IS NULL`
+	result, err := tx.ExecContext(dbCtx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	if _, err := tx.ExecContext(dbCtx, `DELETE FROM totp_backup_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range backupCodeHashes {
+		query = `INSERT INTO totp_backup_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, err := tx.ExecContext(dbCtx, query, userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of an accepted code, returns false if a code of
+// this or a later step was already used so a code cannot be replayed
+func UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE user_totp SET last_used_step = $2 
+			  WHERE user_id = $1 AND enabled_at IS NOT NULL AND (last_used_step IS NULL OR last_used_step < $2)`
+	result, err := db.ExecContext(dbCtx, query, userID, step)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("TOTP verification blocked by circuit breaker", err)
+			return false, errors.New("authentication service temporarily unavailable")
+		}
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// UseBackupCode marks an unused backup code of the user as used, returns false if there is none
+func UseBackupCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE totp_backup_codes SET used_at = NOW() 
+			  WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := db.ExecContext(dbCtx, query, userID, codeHash)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Backup code verification blocked by circuit breaker", err)
+			return false, errors.New("authentication service temporarily unavailable")
+		}
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// DeleteTOTP turns off two-factor authentication for the user and removes the backup codes
+func DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("TOTP disable blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(dbCtx, `DELETE FROM totp_backup_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(dbCtx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
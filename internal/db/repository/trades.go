@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+// GetUnsettledDeliveryTrades retrieves all CNC trades executed before today that are not yet settled
+func GetUnsettledDeliveryTrades(ctx context.Context) ([]models.Trade, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT id, user_id, symbol, side, product, quantity, price, trade_date, settled_at, created_at 
+			  FROM trades 
+			  WHERE product = 'CNC' AND settled_at IS NULL AND trade_date < CURRENT_DATE
+			  ORDER BY trade_date, created_at`
+
+	rows, err := db.QueryContext(dbCtx, query)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Unsettled trades lookup blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []models.Trade
+
+	for rows.Next() {
+		var trade models.Trade
+		err := rows.Scan(&trade.ID, &trade.UserID, &trade.Symbol, &trade.Side, &trade.Product,
+			&trade.Quantity, &trade.Price, &trade.TradeDate, &trade.SettledAt, &trade.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, trade)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+// GetUnsettledDeliveryQuantities returns the net unsettled CNC quantity per symbol for a user
+// Buys count as positive and sells as negative quantity
+func GetUnsettledDeliveryQuantities(ctx context.Context, userID uuid.UUID) (map[string]float64, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT symbol, SUM(CASE WHEN side = 'BUY' THEN quantity ELSE -quantity END) 
+			  FROM trades 
+			  WHERE user_id = $1 AND product = 'CNC' AND settled_at IS NULL
+			  GROUP BY symbol`
+
+	rows, err := db.QueryContext(dbCtx, query, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Unsettled quantities lookup blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[string]float64)
+
+	for rows.Next() {
+		var symbol string
+		var quantity float64
+		if err := rows.Scan(&symbol, &quantity); err != nil {
+			return nil, err
+		}
+		quantities[symbol] = quantity
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return quantities, nil
+}
+
+// SettleDeliveryTrades moves a net delivery obligation into the user's holding and marks
+// the underlying trades as settled, all within a single transaction.
+// A positive netQuantity is a buy at buyPrice and recomputes the weighted average price,
+// a negative netQuantity is a sell and reduces the holding quantity.
+func SettleDeliveryTrades(ctx context.Context, userID uuid.UUID, symbol string, netQuantity, buyPrice float64, tradeIDs []uuid.UUID) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			return errors.New("database service temporarily unavailable")
+		}
+		return err
+	}
+	defer tx.Rollback()
+
+	var holdingID uuid.UUID
+	query := `SELECT id FROM holdings WHERE user_id = $1 AND symbol = $2 ORDER BY created_at LIMIT 1 FOR UPDATE`
+	err = tx.QueryRowContext(dbCtx, query, userID, symbol).Scan(&holdingID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	holdingExists := err == nil
+
+	switch {
+	case netQuantity > 0 && holdingExists:
+		query = `UPDATE holdings 
+				 SET average_price = (quantity * average_price + $2 * $3) / (quantity + $2),
+				     quantity = quantity + $2,
+				     total_value = (quantity + $2) * current_price,
+				     updated_at = NOW()
+				 WHERE id = $1`
+		if _, err = tx.ExecContext(dbCtx, query, holdingID, netQuantity, buyPrice); err != nil {
+			return err
+		}
+	case netQuantity > 0:
+		query = `INSERT INTO holdings (user_id, symbol, quantity, average_price, current_price, total_value) 
+				 VALUES ($1, $2, $3, $4, $4, $3::numeric * $4::numeric)`
+		if _, err = tx.ExecContext(dbCtx, query, userID, symbol, netQuantity, buyPrice); err != nil {
+			return err
+		}
+	case netQuantity < 0:
+		if !holdingExists {
+			return ErrInsufficientHoldings
+		}
+		var remaining float64
+		query = `UPDATE holdings 
+				 SET quantity = quantity - $2,
+				     total_value = (quantity - $2) * current_price,
+				     updated_at = NOW()
+				 WHERE id = $1 AND quantity >= $2
+				 RETURNING quantity`
+		err = tx.QueryRowContext(dbCtx, query, holdingID, -netQuantity).Scan(&remaining)
+		if err == sql.ErrNoRows {
+			return ErrInsufficientHoldings
+		}
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			if _, err = tx.ExecContext(dbCtx, `DELETE FROM holdings WHERE id = $1`, holdingID); err != nil {
+				return err
+			}
+		}
+	}
+
+	ids := make([]string, len(tradeIDs))
+	for i, id := range tradeIDs {
+		ids[i] = id.String()
+	}
+	query = `UPDATE trades SET settled_at = NOW() WHERE id = ANY($1::uuid[])`
+	if _, err = tx.ExecContext(dbCtx, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
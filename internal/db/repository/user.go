@@ -4,19 +4,25 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
 	circuit "github.com/rubyist/circuitbreaker"
 )
 
+// ErrUserNotFound is returned when no user exists with the email or id
+var ErrUserNotFound = errors.New("user not found")
+
 // AddUser demonstrates using circuit breaker for user creation
 func AddUser(ctx context.Context, email string, hashedPassword []byte) (string, error) {
 	dbClient := db.GetProtectedClient()
 
 	// Log circuit breaker state for monitoring
-	logger.Log.Infof("Database circuit breaker state: %s, failures: %d",
+	logger.FromContext(ctx).Infof("Database circuit breaker state: %s, failures: %d",
 		dbClient.GetCircuitBreakerState(), dbClient.GetFailures())
 
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -29,7 +35,7 @@ func AddUser(ctx context.Context, email string, hashedPassword []byte) (string,
 	if err != nil {
 		// Handle circuit breaker specific errors
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("User creation blocked by circuit breaker", err)
+			logger.FromContext(ctx).Error("User creation blocked by circuit breaker", err)
 			return "", errors.New("database service temporarily unavailable")
 		}
 		return "", err
@@ -43,34 +49,283 @@ func AddUser(ctx context.Context, email string, hashedPassword []byte) (string,
 	return userId, nil
 }
 
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, email, password_hash, email_verified, failed_login_attempts, last_failed_login_at, 
+					 locked_until, role, frozen_at, created_at, updated_at`
+
+// scanUser scans the userColumns of a *sql.Row or *db.Rows
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.EmailVerified, &user.FailedLoginAttempts,
+		&user.LastFailedLoginAt, &user.LockedUntil, &user.Role, &user.FrozenAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
 // GetUserByEmail demonstrates using circuit breaker for user lookup
-func GetUserByEmail(ctx context.Context, email string) (string, []byte, error) {
+func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	dbClient := db.GetProtectedClient()
 
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	var userId string
-	var hashedPassword []byte
-
-	query := `SELECT id, password_hash FROM users WHERE email = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
 	row, err := dbClient.QueryRowContext(dbCtx, query, email)
 	if err != nil {
 		// Handle circuit breaker specific errors
 		if err == circuit.ErrBreakerOpen {
-			logger.Log.Error("User lookup blocked by circuit breaker", err)
-			return "", nil, errors.New("database service temporarily unavailable")
+			logger.FromContext(ctx).Error("User lookup blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	return scanUser(row)
+}
+
+// GetUserByID returns the user with the id, or ErrUserNotFound
+func GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	dbClient := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	row, err := dbClient.QueryRowContext(dbCtx, query, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("User lookup blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	return scanUser(row)
+}
+
+// UpdatePassword replaces the password hash of the user
+func UpdatePassword(ctx context.Context, userID uuid.UUID, hashedPassword []byte) error {
+	dbClient := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`
+	result, err := dbClient.ExecContext(dbCtx, query, userID, hashedPassword)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Password update blocked by circuit breaker", err)
+			return errors.New("database service temporarily unavailable")
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address
+func IsEmailVerified(ctx context.Context, userID uuid.UUID) (bool, error) {
+	dbClient := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT email_verified FROM users WHERE id = $1`
+	row, err := dbClient.QueryRowContext(dbCtx, query, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Email verification lookup blocked by circuit breaker", err)
+			return false, errors.New("database service temporarily unavailable")
+		}
+		return false, err
+	}
+
+	var verified bool
+	err = row.Scan(&verified)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, ErrUserNotFound
+		}
+		return false, err
+	}
+
+	return verified, nil
+}
+
+// RecordFailedLogin counts a wrong password for the user. Reaching maxAttempts locks the account
+// for lockout and starts the count over, the lock expiry is returned when this failure locked it.
+func RecordFailedLogin(ctx context.Context, userID uuid.UUID, maxAttempts int, lockout time.Duration) (*time.Time, error) {
+	dbClient := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// the right hand sides see the row before the update
+	query := `UPDATE users SET 
+			  failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $2 THEN 0 ELSE failed_login_attempts + 1 END,
+			  last_failed_login_at = NOW(),
+			  locked_until = CASE WHEN failed_login_attempts + 1 >= $2 THEN NOW() + $3 * INTERVAL '1 second' ELSE locked_until END
+			  WHERE id = $1 
+			  RETURNING failed_login_attempts = 0, locked_until`
+	row, err := dbClient.QueryRowContext(dbCtx, query, userID, maxAttempts, lockout.Seconds())
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Failed login tracking blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
 		}
-		return "", nil, err
+		return nil, err
 	}
 
-	err = row.Scan(&userId, &hashedPassword)
+	var locked bool
+	var lockedUntil *time.Time
+	err = row.Scan(&locked, &lockedUntil)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
-		return "", nil, err
+		return nil, err
+	}
+	if !locked {
+		return nil, nil
 	}
+	return lockedUntil, nil
+}
+
+// ClearFailedLogins clears the failed login count and any lock of the user, after a successful
+// login or when an admin unlocks the account
+func ClearFailedLogins(ctx context.Context, userID uuid.UUID) error {
+	dbClient := db.GetProtectedClient()
 
-	return userId, hashedPassword, nil
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = $1`
+	result, err := dbClient.ExecContext(dbCtx, query, userID)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("User unlock blocked by circuit breaker", err)
+			return errors.New("database service temporarily unavailable")
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UserFilter narrows a user search, zero fields match every user
+type UserFilter struct {
+	// Email matches any part of the email address, case insensitively
+	Email  string
+	Role   string
+	Frozen *bool
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers returns the users matching the filter, newest first
+func SearchUsers(ctx context.Context, filter UserFilter, limit, offset int) ([]models.User, error) {
+	dbClient := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users 
+			  WHERE ($1 = '' OR email ILIKE '%' || $1 || '%') 
+			  AND ($2 = '' OR role = $2) 
+			  AND ($3::BOOLEAN IS NULL OR (frozen_at IS NOT NULL) = $3) 
+			  ORDER BY created_at DESC LIMIT $4 OFFSET $5`
+	rows, err := dbClient.QueryContext(dbCtx, query, likeEscaper.Replace(filter.Email), filter.Role, filter.Frozen, limit, offset)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("User search blocked by circuit breaker", err)
+			return nil, errors.New("database service temporarily unavailable")
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// SetUserRole changes the role of the user
+func SetUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	dbClient := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1`
+	return execUserUpdate(dbCtx, dbClient, "Role change", query, userID, role)
+}
+
+// FreezeUser freezes the account of the user, freezing a frozen account keeps its original frozen_at
+func FreezeUser(ctx context.Context, userID uuid.UUID) error {
+	dbClient := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET frozen_at = COALESCE(frozen_at, NOW()), updated_at = NOW() WHERE id = $1`
+	return execUserUpdate(dbCtx, dbClient, "Account freeze", query, userID)
+}
+
+// UnfreezeUser lifts the freeze of the user's account
+func UnfreezeUser(ctx context.Context, userID uuid.UUID) error {
+	dbClient := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET frozen_at = NULL, updated_at = NOW() WHERE id = $1`
+	return execUserUpdate(dbCtx, dbClient, "Account unfreeze", query, userID)
+}
+
+// execUserUpdate runs an update of a single user, returns ErrUserNotFound if no user has the id
+func execUserUpdate(ctx context.Context, dbClient *db.ProtectedDB, operation, query string, userID uuid.UUID, args ...any) error {
+	result, err := dbClient.ExecContext(ctx, query, append([]any{userID}, args...)...)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error(operation+" blocked by circuit breaker", err)
+			return errors.New("database service temporarily unavailable")
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
 }
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	circuit "github.com/rubyist/circuitbreaker"
+)
+
+// Purposes of the single use tokens mailed to users
+const (
+	PurposePasswordReset     = "PASSWORD_RESET"
+	PurposeEmailVerification = "EMAIL_VERIFICATION"
+)
+
+// ErrUserTokenInvalid is returned when a mailed token does not exist, has expired or was already used
+var ErrUserTokenInvalid = errors.New("invalid or expired token")
+
+// CreateUserToken stores the hash of a new token for the purpose, invalidating
+// the user's earlier unused tokens of the same purpose
+func CreateUserToken(ctx context.Context, userID uuid.UUID, purpose, tokenHash string, expiresAt time.Time) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("User token creation blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+	if _, err := tx.ExecContext(dbCtx, query, userID, purpose); err != nil {
+		return err
+	}
+
+	query = `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(dbCtx, query, userID, purpose, tokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUserTokenOwner returns the user a valid token of the purpose was issued to, without using it up
+func GetUserTokenOwner(ctx context.Context, purpose, tokenHash string) (uuid.UUID, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT user_id FROM user_tokens 
+			  WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()`
+	row, err := db.QueryRowContext(dbCtx, query, tokenHash, purpose)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("User token lookup blocked by circuit breaker", err)
+			return uuid.Nil, errors.New("authentication service temporarily unavailable")
+		}
+		return uuid.Nil, err
+	}
+
+	var userID uuid.UUID
+	err = row.Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, ErrUserTokenInvalid
+		}
+		return uuid.Nil, err
+	}
+
+	return userID, nil
+}
+
+// ResetPassword uses up a password reset token and sets the password of its user in one transaction,
+// so a token can only ever set one password. Any lockout of the account is lifted. Returns the user id, or ErrUserTokenInvalid.
+func ResetPassword(ctx context.Context, tokenHash string, passwordHash []byte) (uuid.UUID, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Password reset blocked by circuit breaker", err)
+			return uuid.Nil, errors.New("authentication service temporarily unavailable")
+		}
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	query := `UPDATE user_tokens SET used_at = NOW() 
+			  WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW() 
+			  RETURNING user_id`
+	err = tx.QueryRowContext(dbCtx, query, tokenHash, PurposePasswordReset).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, ErrUserTokenInvalid
+		}
+		return uuid.Nil, err
+	}
+
+	// proving ownership of the email also lifts a lockout
+	query = `UPDATE users SET password_hash = $2, failed_login_attempts = 0, locked_until = NULL, updated_at = NOW() 
+			 WHERE id = $1`
+	if _, err := tx.ExecContext(dbCtx, query, userID, passwordHash); err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// VerifyEmail uses up an email verification token and marks the email of its user as verified
+// in one transaction. Returns the user id, or ErrUserTokenInvalid.
+func VerifyEmail(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(dbCtx, nil)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("Email verification blocked by circuit breaker", err)
+			return uuid.Nil, errors.New("authentication service temporarily unavailable")
+		}
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	query := `UPDATE user_tokens SET used_at = NOW() 
+			  WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW() 
+			  RETURNING user_id`
+	err = tx.QueryRowContext(dbCtx, query, tokenHash, PurposeEmailVerification).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, ErrUserTokenInvalid
+		}
+		return uuid.Nil, err
+	}
+
+	query = `UPDATE users SET email_verified = TRUE, updated_at = NOW() WHERE id = $1`
+	if _, err := tx.ExecContext(dbCtx, query, userID); err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// GetLastUserTokenTime returns when the user was last issued a token of the purpose, nil if never
+func GetLastUserTokenTime(ctx context.Context, userID uuid.UUID, purpose string) (*time.Time, error) {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT MAX(created_at) FROM user_tokens WHERE user_id = $1 AND purpose = $2`
+	row, err := db.QueryRowContext(dbCtx, query, userID, purpose)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("User token lookup blocked by circuit breaker", err)
+			return nil, errors.New("authentication service temporarily unavailable")
+		}
+		return nil, err
+	}
+
+	var createdAt *time.Time
+	if err := row.Scan(&createdAt); err != nil {
+		return nil, err
+	}
+	return createdAt, nil
+}
+
+// CleanupExpiredUserTokens removes tokens that can no longer be used
+func CleanupExpiredUserTokens(ctx context.Context) error {
+	db := db.GetProtectedClient()
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM user_tokens WHERE expires_at < NOW()`
+	_, err := db.ExecContext(dbCtx, query)
+	if err != nil {
+		if err == circuit.ErrBreakerOpen {
+			logger.FromContext(ctx).Error("User token cleanup blocked by circuit breaker", err)
+			return errors.New("authentication service temporarily unavailable")
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package dtos
+
+// SearchUsers filters the user search of the admin API, read from the query string
+type SearchUsers struct {
+	// Email matches any part of the email address
+	Email  string `json:"email"`
+	Role   string `json:"role" validate:"oneof=trader support risk admin"`
+	Frozen string `json:"frozen" validate:"oneof=true false"`
+}
+
+// FreezeUser freezes a user's account, the reason is kept in the logs
+type FreezeUser struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// SetUserRole changes the role of a user
+type SetUserRole struct {
+	Role string `json:"role" validate:"required,oneof=trader support risk admin"`
+}
+
+// ImpersonateUser asks for a read-only token to see a user's account, the reason is kept in the logs
+type ImpersonateUser struct {
+	Reason string `json:"reason" validate:"required"`
+}
@@ -0,0 +1,13 @@
+package dtos
+
+import "time"
+
+// CreateAPIKey creates an API key for the logged in user
+type CreateAPIKey struct {
+	Name   string   `json:"name" validate:"required"`
+	Scopes []string `json:"scopes" validate:"required,oneof=read trade funds"`
+	// IPAllowlist holds IP addresses or CIDR ranges the key may be used from, any IP when empty
+	IPAllowlist []string `json:"ip_allowlist" validate:"ipnet"`
+	// ExpiresAt is optional, the key does not expire when nil
+	ExpiresAt *time.Time `json:"expires_at" validate:"future"`
+}
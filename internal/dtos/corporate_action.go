@@ -0,0 +1,11 @@
+package dtos
+
+// this struct is used to fetch a corporate action announcement from request body
+type CorporateAction struct {
+	Symbol           string  `json:"symbol" validate:"required,symbol"`
+	ActionType       string  `json:"action_type" validate:"required,oneof=SPLIT BONUS DIVIDEND"`
+	RatioFrom        float64 `json:"ratio_from" validate:"required_if=ActionType SPLIT BONUS,positive,maxprecision=8"`
+	RatioTo          float64 `json:"ratio_to" validate:"required_if=ActionType SPLIT BONUS,positive,maxprecision=8"`
+	DividendPerShare float64 `json:"dividend_per_share" validate:"required_if=ActionType DIVIDEND,positive,maxprecision=8"`
+	ExDate           string  `json:"ex_date" validate:"required,date"` // YYYY-MM-DD
+}
@@ -0,0 +1,20 @@
+package dtos
+
+// this struct is used to fetch a new holding lot from request body
+// total_value is derived on the server from quantity * current_price
+type AddHolding struct {
+	Symbol       string  `json:"symbol" validate:"required,symbol"`
+	Quantity     float64 `json:"quantity" validate:"required,positive,maxprecision=8"`
+	AveragePrice float64 `json:"average_price" validate:"required,positive,maxprecision=8"`
+	CurrentPrice float64 `json:"current_price" validate:"required,positive,maxprecision=8"`
+}
+
+// this struct is used to fetch a partial holding update from request body
+// only the fields present in the request are updated, sell_quantity reduces
+// the quantity while keeping the average price
+type UpdateHolding struct {
+	Quantity     *float64 `json:"quantity" validate:"positive,maxprecision=8"`
+	AveragePrice *float64 `json:"average_price" validate:"positive,maxprecision=8"`
+	CurrentPrice *float64 `json:"current_price" validate:"positive,maxprecision=8"`
+	SellQuantity *float64 `json:"sell_quantity" validate:"positive,maxprecision=8"`
+}
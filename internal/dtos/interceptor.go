@@ -1,7 +1,22 @@
 package dtos
 
 type InterceptorResponse struct {
-	ErrorMessage string `json:"error_message"`
-	ErrorCode    string `json:"error_code"`
-	Data         any    `json:"data,omitempty"`
+	ErrorMessage string       `json:"error_message"`
+	ErrorCode    string       `json:"error_code"`
+	Data         any          `json:"data,omitempty"`
+	Details      []FieldError `json:"details,omitempty"`
+	DocsURL      string       `json:"docs_url,omitempty"`
+	// RequestID is quoted by clients reporting an error so support can find the request's log lines
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ProblemDetails is an RFC 7807 error document, sent when the client accepts application/problem+json
+type ProblemDetails struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
 }
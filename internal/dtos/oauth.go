@@ -0,0 +1,27 @@
+package dtos
+
+// RegisterOAuthClient registers a third-party app. Confidential (server side) clients get a secret,
+// public clients (mobile and single page apps) rely on PKCE alone.
+type RegisterOAuthClient struct {
+	Name         string   `json:"name" validate:"required"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,redirecturi"`
+	Scopes       []string `json:"scopes" validate:"required,oneof=holdings:read positions:read orders:write"`
+	Confidential bool     `json:"confidential"`
+}
+
+// OAuthAuthorize is an OAuth2 authorization request (RFC 6749 section 4.1.1) with a PKCE challenge (RFC 7636)
+type OAuthAuthorize struct {
+	ResponseType        string `json:"response_type" validate:"required,oneof=code"`
+	ClientID            string `json:"client_id" validate:"required"`
+	RedirectURI         string `json:"redirect_uri" validate:"required"`
+	Scope               string `json:"scope" validate:"required"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge" validate:"required"`
+	CodeChallengeMethod string `json:"code_challenge_method" validate:"required,oneof=S256"`
+}
+
+// OAuthConsent is the user's answer to an authorization request
+type OAuthConsent struct {
+	OAuthAuthorize
+	Approve bool `json:"approve"`
+}
@@ -0,0 +1,18 @@
+package dtos
+
+// ChangePassword replaces the password of the logged in user
+type ChangePassword struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,password"`
+}
+
+// PasswordResetRequest asks for a password reset email
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// PasswordResetConfirm sets a new password with the token from the reset email
+type PasswordResetConfirm struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,password"`
+}
@@ -0,0 +1,19 @@
+package dtos
+
+// TwoFactorCode confirms a two-factor enrollment
+type TwoFactorCode struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// LoginTwoFactor completes a login with the challenge token from the password step
+// and a TOTP or backup code
+type LoginTwoFactor struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+// DisableTwoFactor re-authenticates the user before two-factor authentication is turned off
+type DisableTwoFactor struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
@@ -2,6 +2,11 @@ package dtos
 
 // this struct is used to fetch user data from request body
 type User struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,password=Email"`
+}
+
+// VerifyEmail confirms the email address with the token from the verification email
+type VerifyEmail struct {
+	Token string `json:"token" validate:"required"`
 }
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
+	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// SearchUsers lists the users matching the email, role and frozen filters of the query string, newest
+// first and paged with limit and offset
+func SearchUsers(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	search := dtos.SearchUsers{
+		Email:  query.Get("email"),
+		Role:   query.Get("role"),
+		Frozen: query.Get("frozen"),
+	}
+	if err := validateRequest(r, search); err != nil {
+		return err
+	}
+
+	limit, offset, err := pageFromQuery(query)
+	if err != nil {
+		return err
+	}
+
+	filter := repository.UserFilter{Email: search.Email, Role: search.Role}
+	if search.Frozen != "" {
+		frozen := search.Frozen == "true"
+		filter.Frozen = &frozen
+	}
+
+	users, err := repository.SearchUsers(r.Context(), filter, limit, offset)
+	if err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to search users: %w", err))
+	}
+
+	interceptor.SendSuccessResponse(w, r, users, http.StatusOK)
+	return nil
+}
+
+// UnlockUser lifts a lockout after failed logins and clears the user's failed login count
+func UnlockUser(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := uuid.Parse(httprouter.ParamsFromContext(ctx).ByName("id"))
+	if err != nil {
+		return interceptor.ErrUserNotFound
+	}
+
+	err = repository.ClearFailedLogins(ctx, userUUID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return interceptor.ErrUserNotFound
+	}
+	if err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to unlock user: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionUserUnlock, UserID: userUUID.String()})
+	adminId, _ := ctx.Value("userId").(string)
+	logger.FromContext(ctx).Infof("Admin %s unlocked user: %s", adminId, userUUID)
+	interceptor.SendSuccessResponse(w, r, "User unlocked successfully", http.StatusOK)
+	return nil
+}
+
+// FreezeUser freezes a user's account and logs them out everywhere. A frozen account cannot log in,
+// refresh tokens or use its API keys until it is unfrozen.
+func FreezeUser(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := uuid.Parse(httprouter.ParamsFromContext(ctx).ByName("id"))
+	if err != nil {
+		return interceptor.ErrUserNotFound
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.FreezeUser](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	err = repository.FreezeUser(ctx, userUUID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return interceptor.ErrUserNotFound
+	}
+	if err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to freeze user: %w", err))
+	}
+	if err := auth.RevokeUserCredentials(ctx, userUUID); err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to log out frozen user: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionUserFreeze, UserID: userUUID.String(),
+		After: map[string]string{"reason": truncate(requestData.Reason, 500)}})
+	staffId, _ := ctx.Value("userId").(string)
+	logger.FromContext(ctx).Infof("Security event: %s froze the account of user %s, reason: %s", staffId, userUUID, truncate(requestData.Reason, 500))
+	interceptor.SendSuccessResponse(w, r, "User frozen successfully", http.StatusOK)
+	return nil
+}
+
+// UnfreezeUser lifts the freeze of a user's account, the user logs in again to get new tokens
+func UnfreezeUser(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := uuid.Parse(httprouter.ParamsFromContext(ctx).ByName("id"))
+	if err != nil {
+		return interceptor.ErrUserNotFound
+	}
+
+	err = repository.UnfreezeUser(ctx, userUUID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return interceptor.ErrUserNotFound
+	}
+	if err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to unfreeze user: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionUserUnfreeze, UserID: userUUID.String()})
+	staffId, _ := ctx.Value("userId").(string)
+	logger.FromContext(ctx).Infof("Security event: %s unfroze the account of user %s", staffId, userUUID)
+	interceptor.SendSuccessResponse(w, r, "User unfrozen successfully", http.StatusOK)
+	return nil
+}
+
+// SetUserRole changes the role of a user and revokes their access tokens, so the new role applies from
+// their next token refresh. Admins cannot change their own role, which keeps at least one admin around.
+func SetUserRole(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := uuid.Parse(httprouter.ParamsFromContext(ctx).ByName("id"))
+	if err != nil {
+		return interceptor.ErrUserNotFound
+	}
+
+	adminUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+	if userUUID == adminUUID {
+		return interceptor.ErrAccessDenied
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.SetUserRole](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	user, err := repository.GetUserByID(ctx, userUUID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return interceptor.ErrUserNotFound
+	}
+	if err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to fetch user: %w", err))
+	}
+
+	err = repository.SetUserRole(ctx, userUUID, requestData.Role)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return interceptor.ErrUserNotFound
+	}
+	if err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to set user role: %w", err))
+	}
+	if err := auth.RevokeUserAccessTokens(ctx, userUUID.String()); err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to revoke access tokens: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionUserRole, UserID: userUUID.String(),
+		Before: map[string]string{"role": user.Role}, After: map[string]string{"role": requestData.Role}})
+	logger.FromContext(ctx).Infof("Security event: admin %s set the role of user %s to %s", adminUUID, userUUID, requestData.Role)
+	interceptor.SendSuccessResponse(w, r, "User role updated successfully", http.StatusOK)
+	return nil
+}
+
+// ImpersonateUser issues a short-lived, read-only access token for the user so support staff see exactly what
+// the customer sees. Requests made with it are audit logged with both identities.
+func ImpersonateUser(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := uuid.Parse(httprouter.ParamsFromContext(ctx).ByName("id"))
+	if err != nil {
+		return interceptor.ErrUserNotFound
+	}
+
+	staffUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.ImpersonateUser](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	_, err = repository.GetUserByID(ctx, userUUID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return interceptor.ErrUserNotFound
+	}
+	if err != nil {
+		return interceptor.ErrUserManagement.Wrap(fmt.Errorf("failed to fetch user: %w", err))
+	}
+
+	accessToken, err := auth.GenerateImpersonationToken(userUUID.String(), staffUUID.String())
+	if err != nil {
+		return interceptor.ErrTokenGeneration.Wrap(fmt.Errorf("failed to generate impersonation token: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionImpersonate, UserID: userUUID.String(),
+		After: map[string]string{"reason": truncate(requestData.Reason, 500)}})
+	logger.FromContext(ctx).Infof("Security event: %s started impersonating user %s, reason: %s", staffUUID, userUUID, truncate(requestData.Reason, 500))
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(auth.ImpersonationTokenTTL.Seconds()),
+		"user_id":      userUUID.String(),
+		"read_only":    true,
+	}
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
+	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// CreateAPIKey creates an API key for the user and returns its secret, which is only shown this once
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.CreateAPIKey](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	keyID, secret, err := auth.GenerateAPIKey()
+	if err != nil {
+		return interceptor.ErrAPIKeys.Wrap(fmt.Errorf("failed to generate api key: %w", err))
+	}
+	sealedSecret, err := auth.EncryptAPIKeySecret(keyID, secret)
+	if err != nil {
+		return interceptor.ErrAPIKeys.Wrap(fmt.Errorf("failed to encrypt api key secret: %w", err))
+	}
+
+	scopes := slices.Clone(requestData.Scopes)
+	slices.Sort(scopes)
+	ipAllowlist := requestData.IPAllowlist
+	if ipAllowlist == nil {
+		ipAllowlist = []string{}
+	}
+
+	key, err := repository.CreateAPIKey(ctx, models.APIKey{
+		UserID:           userUUID,
+		KeyID:            keyID,
+		Name:             truncate(requestData.Name, 100),
+		SecretCiphertext: sealedSecret,
+		Scopes:           slices.Compact(scopes),
+		IPAllowlist:      ipAllowlist,
+		ExpiresAt:        requestData.ExpiresAt,
+	})
+	if err != nil {
+		return interceptor.ErrAPIKeys.Wrap(fmt.Errorf("failed to create api key: %w", err))
+	}
+
+	response := map[string]interface{}{
+		"api_key": key,
+		"secret":  secret,
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionAPIKeyCreate, Resource: key.ID.String(), After: key})
+	logger.FromContext(ctx).Infof("Created API key %s with scopes %v for user: %s", key.KeyID, key.Scopes, userUUID)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusCreated)
+	return nil
+}
+
+// GetAPIKeys lists the active API keys of the user, without their secrets
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	keys, err := repository.GetUserAPIKeys(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrAPIKeys.Wrap(fmt.Errorf("failed to get api keys: %w", err))
+	}
+
+	interceptor.SendSuccessResponse(w, r, keys, http.StatusOK)
+	return nil
+}
+
+// RevokeAPIKey revokes an API key of the user, requests signed with it fail from then on
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(httprouter.ParamsFromContext(ctx).ByName("id"))
+	if err != nil {
+		return interceptor.ErrAPIKeyNotFound
+	}
+
+	err = repository.RevokeAPIKey(ctx, userUUID, id)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return interceptor.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return interceptor.ErrAPIKeys.Wrap(fmt.Errorf("failed to revoke api key: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionAPIKeyRevoke, Resource: id.String()})
+	logger.FromContext(ctx).Infof("Successfully revoked API key %s for user: %s", id, userUUID)
+	interceptor.SendSuccessResponse(w, r, "API key revoked successfully", http.StatusOK)
+	return nil
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
+)
+
+// ResetCircuitBreaker closes the database circuit breaker after an outage was fixed, instead of waiting
+// for its back-off to let a trial request through
+func ResetCircuitBreaker(w http.ResponseWriter, r *http.Request) error {
+	dbClient := db.GetProtectedClient()
+	previousState := dbClient.GetCircuitBreakerState()
+	dbClient.Reset()
+
+	audit.Record(r, audit.Event{Action: audit.ActionCircuitBreakerReset,
+		Before: map[string]string{"state": previousState}, After: map[string]string{"state": dbClient.GetCircuitBreakerState()}})
+	adminId, _ := r.Context().Value("userId").(string)
+	logger.FromContext(r.Context()).Infof("Admin %s reset the database circuit breaker, it was %s", adminId, previousState)
+
+	response := map[string]interface{}{
+		"previous_state": previousState,
+		"state":          dbClient.GetCircuitBreakerState(),
+	}
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// AddCorporateAction announces a split, bonus or dividend to be applied on its ex-date
+func AddCorporateAction(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.CorporateAction](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	// already validated above
+	exDate, _ := time.Parse(time.DateOnly, requestData.ExDate)
+
+	action, err := repository.CreateCorporateAction(ctx, models.CorporateAction{
+		Symbol:           requestData.Symbol,
+		ActionType:       requestData.ActionType,
+		RatioFrom:        requestData.RatioFrom,
+		RatioTo:          requestData.RatioTo,
+		DividendPerShare: requestData.DividendPerShare,
+		ExDate:           exDate,
+	})
+	if err != nil {
+		return interceptor.ErrCorporateAction.Wrap(fmt.Errorf("failed to create corporate action: %w", err))
+	}
+
+	logger.FromContext(ctx).Infof("Corporate action %s created for symbol: %s", action.ID, action.Symbol)
+	interceptor.SendSuccessResponse(w, r, action, http.StatusCreated)
+	return nil
+}
+
+// GetCorporateActions lists all corporate actions with their status
+func GetCorporateActions(w http.ResponseWriter, r *http.Request) error {
+	actions, err := repository.GetCorporateActions(r.Context())
+	if err != nil {
+		return interceptor.ErrCorporateAction.Wrap(fmt.Errorf("failed to get corporate actions: %w", err))
+	}
+
+	interceptor.SendSuccessResponse(w, r, actions, http.StatusOK)
+	return nil
+}
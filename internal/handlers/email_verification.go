@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/mailer"
+	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// VerifyEmail confirms the user's email address with the token from the verification email
+func VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.VerifyEmail](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	userUUID, err := repository.VerifyEmail(ctx, auth.HashUserToken(requestData.Token))
+	if errors.Is(err, repository.ErrUserTokenInvalid) {
+		return interceptor.ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return interceptor.ErrEmailVerification.Wrap(fmt.Errorf("failed to verify email: %w", err))
+	}
+
+	logger.FromContext(ctx).Infof("Verified email of user: %s", userUUID)
+	interceptor.SendSuccessResponse(w, r, "Email verified successfully", http.StatusOK)
+	return nil
+}
+
+// ResendVerificationEmail sends a new verification link to the logged in user,
+// at most once per auth.VerificationResendInterval
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	user, err := repository.GetUserByID(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrEmailVerification.Wrap(fmt.Errorf("failed to get user: %w", err))
+	}
+	if user.EmailVerified {
+		return interceptor.ErrEmailAlreadyVerified
+	}
+
+	wait, err := auth.VerificationResendWait(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrEmailVerification.Wrap(fmt.Errorf("failed to get last verification email: %w", err))
+	}
+	if wait > 0 {
+		interceptor.SetRetryAfter(w, wait)
+		return interceptor.ErrTooManyRequests
+	}
+
+	if err := sendVerificationEmail(ctx, userUUID, user.Email); err != nil {
+		return interceptor.ErrEmailVerification.Wrap(err)
+	}
+
+	interceptor.SendSuccessResponse(w, r, "Verification email sent", http.StatusOK)
+	return nil
+}
+
+// sendVerificationEmail issues a new verification token and mails its link to the user
+func sendVerificationEmail(ctx context.Context, userUUID uuid.UUID, email string) error {
+	token, err := auth.IssueEmailVerificationToken(ctx, userUUID)
+	if err != nil {
+		return fmt.Errorf("failed to issue email verification token: %w", err)
+	}
+
+	link := config.AppConfigInstance.Mailer.AppURL + "/verify-email?token=" + url.QueryEscape(token)
+	sendEmail(ctx, mailer.VerifyEmailEmail(email, link, auth.EmailVerificationTTL))
+
+	logger.FromContext(ctx).Infof("Issued email verification token for user: %s", userUUID)
+	return nil
+}
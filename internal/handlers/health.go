@@ -23,7 +23,7 @@ func Health(w http.ResponseWriter, r *http.Request) {
 	dbError := dbClient.Ping()
 	if dbError != nil {
 		dbStatus = "unhealthy"
-		logger.Log.Error("Health check: database ping failed", dbError)
+		logger.FromContext(r.Context()).Error("Health check: database ping failed", dbError)
 	}
 
 	envelope := map[string]interface{}{
@@ -43,7 +43,7 @@ func Health(w http.ResponseWriter, r *http.Request) {
 
 	healthObj, err := json.Marshal(envelope)
 	if err != nil {
-		logger.Log.Error("failed to marshal health check response", err)
+		logger.FromContext(r.Context()).Error("failed to marshal health check response", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
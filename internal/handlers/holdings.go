@@ -1,63 +1,200 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
 	"github.com/prajwalbharadwajbm/broker/internal/db/models"
 	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
 	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/metrics"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
 	"github.com/prajwalbharadwajbm/broker/internal/utils"
 )
 
-func GetHoldings(w http.ResponseWriter, r *http.Request) {
+func GetHoldings(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	userId := ctx.Value("userId").(string)
-	userUUID, err := uuid.Parse(userId)
+	userUUID, err := userIDFromRequest(r)
 	if err != nil {
-		logger.Log.Error("failed to parse user ID", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	holdings, err := repository.GetHoldings(ctx, userUUID)
 	if err != nil {
-		logger.Log.Error("failed to get holdings", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrHoldings.Wrap(fmt.Errorf("failed to get holdings: %w", err))
 	}
 
-	interceptor.SendSuccessResponse(w, holdings, http.StatusOK)
+	// Delivery trades awaiting settlement are reported as T1 quantity
+	t1Quantities, err := repository.GetUnsettledDeliveryQuantities(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrHoldings.Wrap(fmt.Errorf("failed to get unsettled delivery quantities: %w", err))
+	}
+
+	interceptor.SendSuccessResponse(w, r, mergeT1Quantities(holdings, t1Quantities, userUUID), http.StatusOK)
+	return nil
+}
+
+// mergeT1Quantities sets the T1 quantity on each holding, symbols bought but
+// not yet settled are returned as holdings with zero settled quantity
+func mergeT1Quantities(holdings []models.Holding, t1Quantities map[string]float64, userUUID uuid.UUID) []models.Holding {
+	for i := range holdings {
+		if quantity, ok := t1Quantities[holdings[i].Symbol]; ok {
+			holdings[i].T1Quantity = quantity
+			delete(t1Quantities, holdings[i].Symbol)
+		}
+	}
+
+	for symbol, quantity := range t1Quantities {
+		holdings = append(holdings, models.Holding{
+			UserID:     userUUID,
+			Symbol:     symbol,
+			T1Quantity: quantity,
+		})
+	}
+
+	return holdings
+}
+
+func AddHolding(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.AddHolding](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	holding, err := repository.AddHolding(ctx, models.Holding{
+		UserID:       userUUID,
+		Symbol:       requestData.Symbol,
+		Quantity:     requestData.Quantity,
+		AveragePrice: requestData.AveragePrice,
+		CurrentPrice: requestData.CurrentPrice,
+	})
+	if err != nil {
+		return interceptor.ErrHoldings.Wrap(fmt.Errorf("failed to add holding: %w", err))
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionHoldingAdd, Resource: holding.ID.String(),
+		After: map[string]interface{}{"lot": requestData, "holding": holding}})
+	metrics.HoldingChanges.WithLabelValues(metrics.ChangeAdd).Inc()
+
+	interceptor.SendSuccessResponse(w, r, holding, http.StatusOK)
+	return nil
+}
+
+// UpdateHolding partially updates a holding owned by the user, including partial sells
+func UpdateHolding(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, holdingID, err := parseHoldingRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.UpdateHolding](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	// read for the audit log, the update itself checks ownership again
+	before, err := repository.GetHolding(ctx, holdingID, userUUID)
+	if errors.Is(err, repository.ErrHoldingNotFound) {
+		return interceptor.ErrHoldingNotFound
+	}
+	if err != nil {
+		return interceptor.ErrHoldings.Wrap(fmt.Errorf("failed to get holding: %w", err))
+	}
+
+	action := audit.ActionHoldingUpdate
+	if requestData.SellQuantity != nil {
+		action = audit.ActionHoldingSell
+	}
+
+	holding, err := repository.UpdateHolding(ctx, holdingID, userUUID, repository.HoldingUpdate{
+		Quantity:     requestData.Quantity,
+		AveragePrice: requestData.AveragePrice,
+		CurrentPrice: requestData.CurrentPrice,
+		SellQuantity: requestData.SellQuantity,
+	})
+	switch {
+	case errors.Is(err, repository.ErrHoldingNotFound):
+		return interceptor.ErrHoldingNotFound
+	case errors.Is(err, repository.ErrInsufficientHoldings):
+		audit.Record(r, audit.Event{Action: action, Resource: holdingID.String(), Before: before, Err: interceptor.ErrInsufficientHolding})
+		return interceptor.ErrInsufficientHolding
+	case err != nil:
+		return interceptor.ErrHoldings.Wrap(fmt.Errorf("failed to update holding: %w", err))
+	}
+	audit.Record(r, audit.Event{Action: action, Resource: holdingID.String(), Before: before, After: holding})
+	if requestData.SellQuantity != nil {
+		metrics.HoldingChanges.WithLabelValues(metrics.ChangeReduce).Inc()
+	}
+
+	logger.FromContext(ctx).Infof("Successfully updated holding %s for user: %s", holdingID, userUUID)
+	interceptor.SendSuccessResponse(w, r, holding, http.StatusOK)
+	return nil
 }
 
-func AddHolding(w http.ResponseWriter, r *http.Request) {
+// DeleteHolding removes a holding owned by the user
+func DeleteHolding(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	userId := ctx.Value("userId").(string)
-	userUUID, err := uuid.Parse(userId)
+	userUUID, holdingID, err := parseHoldingRequest(r)
 	if err != nil {
-		logger.Log.Error("failed to parse user ID", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	holding, err := utils.FetchDataFromRequestBody[models.Holding](r)
+	before, err := repository.GetHolding(ctx, holdingID, userUUID)
+	if errors.Is(err, repository.ErrHoldingNotFound) {
+		return interceptor.ErrHoldingNotFound
+	}
 	if err != nil {
-		logger.Log.Error("failed to fetch holding from request body", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrHoldings.Wrap(fmt.Errorf("failed to get holding: %w", err))
 	}
 
-	holding.UserID = userUUID
+	err = repository.DeleteHolding(ctx, holdingID, userUUID)
+	if errors.Is(err, repository.ErrHoldingNotFound) {
+		return interceptor.ErrHoldingNotFound
+	}
+	if err != nil {
+		return interceptor.ErrHoldings.Wrap(fmt.Errorf("failed to delete holding: %w", err))
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionHoldingDelete, Resource: holdingID.String(), Before: before})
+
+	logger.FromContext(ctx).Infof("Successfully deleted holding %s for user: %s", holdingID, userUUID)
+	interceptor.SendSuccessResponse(w, r, "Holding deleted successfully", http.StatusOK)
+	return nil
+}
+
+// parseHoldingRequest reads the user id set by the auth middleware and the holding id route param
+func parseHoldingRequest(r *http.Request) (uuid.UUID, uuid.UUID, error) {
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
 
-	err = repository.AddHolding(ctx, holding)
+	holdingID, err := uuid.Parse(httprouter.ParamsFromContext(r.Context()).ByName("id"))
 	if err != nil {
-		logger.Log.Error("failed to add holding", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return uuid.Nil, uuid.Nil, interceptor.ErrHoldingNotFound
 	}
 
-	interceptor.SendSuccessResponse(w, "Holding added successfully", http.StatusOK)
+	return userUUID, holdingID, nil
 }
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+)
+
+// JWKS publishes the public keys access tokens are verified with, including retired
+// keys whose tokens have not expired yet. It is served as a bare JWK Set (RFC 7517)
+// rather than in the response envelope so standard JWT libraries can consume it.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	jwks, err := json.Marshal(auth.JWKS())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("failed to marshal jwks response", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// verifiers may cache keys briefly, a new key must be published before it becomes active
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jwks)
+}
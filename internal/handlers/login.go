@@ -5,66 +5,154 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
 	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
 	"github.com/prajwalbharadwajbm/broker/internal/dtos"
 	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/mailer"
+	"github.com/prajwalbharadwajbm/broker/internal/metrics"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
 	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
 	"github.com/prajwalbharadwajbm/broker/internal/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Login(w http.ResponseWriter, r *http.Request) {
+// Login checks the user's password and responds with a token pair, or with a
+// challenge token when two-factor authentication is enabled
+func Login(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	userData, err := utils.FetchDataFromRequestBody[dtos.User](r)
 	if err != nil {
-		logger.Log.Error("unable to fetch request body", err)
-		interceptor.SendErrorResponse(w, "BPB001", http.StatusBadRequest)
-		return
+		return interceptor.ErrBadRequest.Wrap(err)
 	}
 
-	authenticated, userId, err := authenticateUser(ctx, userData)
+	user, err := authenticateUser(w, r, userData)
 	if err != nil {
-		logger.Log.Error("authentication error", err)
-		interceptor.SendErrorResponse(w, "BPB006", http.StatusInternalServerError)
-		return
-	}
-	if !authenticated {
-		logger.Log.Info("invalid username or password")
-		if errors.Is(err, errors.New("user not found")) {
-			interceptor.SendErrorResponse(w, "BPB007", http.StatusNotFound)
-		} else {
-			interceptor.SendErrorResponse(w, "BPB008", http.StatusUnauthorized)
+		audit.Record(r, audit.Event{Action: audit.ActionLogin, Resource: userData.Email, Err: err})
+		metrics.Logins.WithLabelValues(metrics.ResultFailure).Inc()
+		return err
+	}
+	userUUID := user.ID
+	userId := userUUID.String()
+
+	// users with two-factor authentication get a challenge to complete with a code instead of tokens
+	totp, err := repository.GetTOTP(ctx, userUUID)
+	if err != nil && !errors.Is(err, repository.ErrTOTPNotFound) {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to get two-factor enrollment: %w", err))
+	}
+	if totp != nil && totp.EnabledAt != nil {
+		challengeToken, err := auth.GenerateChallengeToken(userId)
+		if err != nil {
+			return interceptor.ErrTokenGeneration.Wrap(fmt.Errorf("failed to generate challenge token: %w", err))
+		}
+		response := map[string]interface{}{
+			"mfa_required":    true,
+			"challenge_token": challengeToken,
+			"expires_in":      int(auth.ChallengeTokenTTL.Seconds()),
 		}
-		return
+		logger.FromContext(ctx).Infof("Password accepted, awaiting two-factor code for user_id: %s", userId)
+		interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+		return nil
 	}
 
-	// Generate both access and refresh tokens
-	tokenPair, err := auth.GenerateTokenPair(userId)
+	return issueTokens(w, r, user)
+}
+
+// LoginTwoFactor completes a two-factor login with the challenge token and a TOTP or backup code
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.LoginTwoFactor](r)
 	if err != nil {
-		logger.Log.Error("failed to generate token pair", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
 	}
 
+	challenge, err := auth.ValidateChallengeToken(ctx, requestData.ChallengeToken)
+	if err != nil {
+		return interceptor.ErrInvalidChallengeToken.Wrap(err)
+	}
+	userId := challenge.Subject
 	userUUID, err := uuid.Parse(userId)
 	if err != nil {
-		logger.Log.Error("failed to parse user ID", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrInvalidChallengeToken.Wrap(err)
+	}
+
+	user, err := repository.GetUserByID(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrAuthentication.Wrap(fmt.Errorf("unable to fetch user: %w", err))
+	}
+	// wrong codes count towards the lockout like wrong passwords, so codes cannot be guessed while locked
+	now := time.Now()
+	if err := loginWaitError(w, user, now); err != nil {
+		return err
+	}
+
+	verified, err := auth.VerifySecondFactor(ctx, userUUID, requestData.Code)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		// two-factor authentication was turned off after the password step
+		return interceptor.ErrInvalidChallengeToken.Wrap(err)
+	}
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to verify two-factor code: %w", err))
+	}
+	if !verified {
+		if err := auth.RecordChallengeFailure(ctx, challenge, now); err != nil {
+			return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to record wrong two-factor code: %w", err))
+		}
+		err := recordFailedSecondFactor(w, r, user, now)
+		audit.Record(r, audit.Event{Action: audit.ActionLoginTwoFactor, UserID: userId, Err: err})
+		metrics.Logins.WithLabelValues(metrics.ResultFailure).Inc()
+		return err
+	}
+
+	// a challenge completes a single login
+	if err := auth.ConsumeChallenge(ctx, challenge); err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to revoke challenge token: %w", err))
+	}
+	if err := clearFailedLogins(ctx, user); err != nil {
+		return err
+	}
+
+	// the account may have been frozen since the password step
+	if user.FrozenAt != nil {
+		audit.Record(r, audit.Event{Action: audit.ActionLoginTwoFactor, UserID: userId, Err: interceptor.ErrAccountFrozen})
+		metrics.Logins.WithLabelValues(metrics.ResultFailure).Inc()
+		return interceptor.ErrAccountFrozen
+	}
+
+	return issueTokens(w, r, user)
+}
+
+// issueTokens starts a new session for an authenticated user and responds with its token pair
+func issueTokens(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	ctx := r.Context()
+	userUUID := user.ID
+	userId := userUUID.String()
+
+	// Generate both access and refresh tokens
+	tokenPair, err := auth.GenerateTokenPair(userId, user.Role)
+	if err != nil {
+		return interceptor.ErrTokenGeneration.Wrap(fmt.Errorf("failed to generate token pair: %w", err))
 	}
 
-	// Store refresh token in database
+	// Store refresh token in database, each login starts a new token family
 	refreshTokenExpiry := auth.GetRefreshTokenExpiration()
-	_, err = repository.CreateRefreshToken(ctx, userUUID, tokenPair.RefreshToken, refreshTokenExpiry)
+	familyID := uuid.New()
+	_, err = repository.CreateRefreshToken(ctx, userUUID, familyID, tokenPair.RefreshToken, refreshTokenExpiry, clientInfoFromRequest(r))
 	if err != nil {
-		logger.Log.Error("failed to store refresh token", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrRefreshTokenProcessing.Wrap(fmt.Errorf("failed to store refresh token: %w", err))
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionLogin, UserID: userId, Resource: familyID.String()})
+	metrics.Logins.WithLabelValues(metrics.ResultSuccess).Inc()
 
 	response := map[string]interface{}{
 		"access_token":  tokenPair.AccessToken,
@@ -73,21 +161,105 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		"expires_in":    900, // access token expires in 15 minutes in seconds
 		"user_id":       userId,
 	}
-	logger.Log.Infof("Successfully logged in user_id: %s", userId)
-	interceptor.SendSuccessResponse(w, response, http.StatusOK)
+	logger.FromContext(ctx).Infof("Successfully logged in user_id: %s", userId)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
 }
 
-func authenticateUser(ctx context.Context, userData dtos.User) (bool, string, error) {
-	userId, hashedPassword, err := repository.GetUserByEmail(ctx, userData.Email)
+// authenticateUser checks the password of a login, refusing attempts from blocked IPs, during the
+// back-off after failed attempts and while the account is locked. Wrong passwords count towards
+// the IP and account limits, locking the account and notifying the user once the limit is reached.
+func authenticateUser(w http.ResponseWriter, r *http.Request, userData dtos.User) (*models.User, error) {
+	ctx := r.Context()
+	now := time.Now()
+
+	ip := utils.ClientIP(r, config.AppConfigInstance.GeneralConfig.TrustedProxyHops)
+	if wait := auth.LoginIPWait(ip, now); wait > 0 {
+		logger.FromContext(ctx).Infof("Login blocked for IP %s after too many failed attempts", ip)
+		interceptor.SetRetryAfter(w, wait)
+		return nil, interceptor.ErrTooManyRequests
+	}
+
+	user, err := repository.GetUserByEmail(ctx, userData.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		auth.RecordLoginIPFailure(ip, now)
+		// unknown email and wrong password get the same response to avoid user enumeration
+		return nil, interceptor.ErrInvalidCredentials
+	}
 	if err != nil {
-		return false, "", fmt.Errorf("unable to fetch user by email: %w", err)
+		return nil, interceptor.ErrAuthentication.Wrap(fmt.Errorf("unable to fetch user by email: %w", err))
+	}
+
+	if err := loginWaitError(w, user, now); err != nil {
+		return nil, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(userData.Password)) != nil {
+		auth.RecordLoginIPFailure(ip, now)
+		lockedUntil, err := auth.RecordFailedLogin(ctx, user.ID)
+		if err != nil {
+			return nil, interceptor.ErrAuthentication.Wrap(fmt.Errorf("unable to record failed login: %w", err))
+		}
+		if lockedUntil != nil {
+			logger.FromContext(ctx).Infof("Security event: account of user %s locked until %s after repeated failed logins from IP %s",
+				user.ID, lockedUntil.Format(time.RFC3339), ip)
+			sendEmail(ctx, mailer.AccountLockedEmail(user.Email, *lockedUntil))
+			interceptor.SetRetryAfter(w, lockedUntil.Sub(now))
+			return nil, interceptor.ErrAccountLocked
+		}
+		return nil, interceptor.ErrInvalidCredentials
+	}
+
+	// only reported after the right password, so the account state does not leak to anyone guessing
+	if user.FrozenAt != nil {
+		logger.FromContext(ctx).Infof("Login refused for frozen account of user_id: %s", user.ID)
+		return nil, interceptor.ErrAccountFrozen
+	}
+
+	if err := clearFailedLogins(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// loginWaitError returns the error for a user who has to wait before the next password or
+// two-factor attempt, with Retry-After set, or nil when the attempt may go ahead
+func loginWaitError(w http.ResponseWriter, user *models.User, now time.Time) error {
+	wait, locked := auth.LoginWait(user, now)
+	if wait <= 0 {
+		return nil
 	}
-	if userId == "" {
-		return false, "", nil
+	interceptor.SetRetryAfter(w, wait)
+	if locked {
+		return interceptor.ErrAccountLocked
 	}
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(userData.Password))
+	return interceptor.ErrTooManyRequests
+}
+
+// recordFailedSecondFactor counts a wrong two-factor code against the account like a wrong password
+// and returns the error to respond with
+func recordFailedSecondFactor(w http.ResponseWriter, r *http.Request, user *models.User, now time.Time) error {
+	lockedUntil, err := auth.RecordFailedLogin(r.Context(), user.ID)
 	if err != nil {
-		return false, "", nil
+		return interceptor.ErrAuthentication.Wrap(fmt.Errorf("unable to record failed two-factor code: %w", err))
+	}
+	if lockedUntil != nil {
+		logger.FromContext(r.Context()).Infof("Security event: account of user %s locked until %s after repeated wrong two-factor codes",
+			user.ID, lockedUntil.Format(time.RFC3339))
+		sendEmail(r.Context(), mailer.AccountLockedEmail(user.Email, *lockedUntil))
+		interceptor.SetRetryAfter(w, lockedUntil.Sub(now))
+		return interceptor.ErrAccountLocked
+	}
+	return interceptor.ErrInvalidTwoFactorCode
+}
+
+// clearFailedLogins resets the failure count and lock of a user who completed an authentication step
+func clearFailedLogins(ctx context.Context, user *models.User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	if err := repository.ClearFailedLogins(ctx, user.ID); err != nil {
+		return interceptor.ErrAuthentication.Wrap(fmt.Errorf("unable to clear failed logins: %w", err))
 	}
-	return true, userId, nil
+	return nil
 }
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
+	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// RegisterOAuthClient registers a third-party app and returns its client id, and the secret of a
+// confidential client which is only shown this once
+func RegisterOAuthClient(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.RegisterOAuthClient](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	clientID, secret, err := auth.GenerateOAuthClientCredentials(requestData.Confidential)
+	if err != nil {
+		return interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to generate client credentials: %w", err))
+	}
+
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		Name:         truncate(requestData.Name, 100),
+		RedirectURIs: requestData.RedirectURIs,
+		Scopes:       auth.ParseScope(auth.FormatScope(requestData.Scopes)),
+	}
+	if secret != "" {
+		secretHash := auth.HashClientSecret(secret)
+		client.ClientSecretHash = &secretHash
+	}
+
+	registered, err := repository.CreateOAuthClient(ctx, client)
+	if err != nil {
+		return interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to register oauth client: %w", err))
+	}
+
+	response := map[string]interface{}{
+		"client":        registered,
+		"client_secret": secret,
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionOAuthClientCreate, Resource: registered.ClientID, After: registered})
+	logger.FromContext(ctx).Infof("Registered OAuth client %s (%s) with scopes %v", registered.ClientID, registered.Name, registered.Scopes)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusCreated)
+	return nil
+}
+
+// GetOAuthClients lists the registered third-party apps
+func GetOAuthClients(w http.ResponseWriter, r *http.Request) error {
+	clients, err := repository.GetOAuthClients(r.Context())
+	if err != nil {
+		return interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to get oauth clients: %w", err))
+	}
+
+	interceptor.SendSuccessResponse(w, r, clients, http.StatusOK)
+	return nil
+}
+
+// GetOAuthAuthorization checks an authorization request from the query string and returns what the web app
+// shows on the consent screen. consented is true when the user already granted every requested scope.
+func GetOAuthAuthorization(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	client, scopes, err := authorizationRequest(r, dtos.OAuthAuthorize{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	})
+	if err != nil {
+		return err
+	}
+
+	consented := false
+	consent, err := repository.GetOAuthConsent(ctx, userUUID, client.ClientID)
+	if err != nil && !errors.Is(err, repository.ErrOAuthConsentNotFound) {
+		return interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to get oauth consent: %w", err))
+	}
+	if consent != nil {
+		consented = !slices.ContainsFunc(scopes, func(scope string) bool {
+			return !slices.Contains(consent.Scopes, scope)
+		})
+	}
+
+	response := map[string]interface{}{
+		"client": map[string]string{
+			"client_id": client.ClientID,
+			"name":      client.Name,
+		},
+		"scopes":    scopes,
+		"consented": consented,
+	}
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
+}
+
+// AuthorizeOAuthClient records the user's answer to an authorization request and returns the redirect_to
+// URL the web app sends the browser to: the client's redirect URI with an authorization code when approved,
+// or with error=access_denied when denied
+func AuthorizeOAuthClient(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.OAuthConsent](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	client, scopes, err := authorizationRequest(r, requestData.OAuthAuthorize)
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	if requestData.State != "" {
+		params.Set("state", requestData.State)
+	}
+
+	if !requestData.Approve {
+		params.Set("error", "access_denied")
+		interceptor.SendSuccessResponse(w, r, map[string]string{"redirect_to": withQuery(requestData.RedirectURI, params)}, http.StatusOK)
+		return nil
+	}
+
+	err = repository.SaveOAuthConsent(ctx, userUUID, client.ClientID, scopes)
+	if err != nil {
+		return interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to save oauth consent: %w", err))
+	}
+
+	code, err := auth.IssueAuthorizationCode(ctx, client, userUUID, requestData.RedirectURI, scopes, requestData.CodeChallenge)
+	if err != nil {
+		return interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to issue authorization code: %w", err))
+	}
+	params.Set("code", code)
+
+	logger.FromContext(ctx).Infof("User %s granted OAuth client %s scopes %v", userUUID, client.ClientID, scopes)
+	interceptor.SendSuccessResponse(w, r, map[string]string{"redirect_to": withQuery(requestData.RedirectURI, params)}, http.StatusOK)
+	return nil
+}
+
+// authorizationRequest validates an authorization request against the registered client and returns
+// the client with the requested scopes
+func authorizationRequest(r *http.Request, request dtos.OAuthAuthorize) (*models.OAuthClient, []string, error) {
+	if err := validateRequest(r, request); err != nil {
+		return nil, nil, err
+	}
+
+	client, err := repository.GetOAuthClient(r.Context(), request.ClientID)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, nil, interceptor.ErrInvalidOAuthRequest.Wrap(err)
+	}
+	if err != nil {
+		return nil, nil, interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to get oauth client: %w", err))
+	}
+
+	// redirect URIs are matched exactly so codes are never sent anywhere the client did not register
+	if !slices.Contains(client.RedirectURIs, request.RedirectURI) {
+		return nil, nil, interceptor.ErrInvalidOAuthRequest.Wrap(fmt.Errorf("redirect uri %q not registered for client %s", request.RedirectURI, client.ClientID))
+	}
+
+	scopes, err := auth.RequestedScopes(client, request.Scope)
+	if err != nil {
+		return nil, nil, interceptor.ErrInvalidOAuthRequest.Wrap(err)
+	}
+	return client, scopes, nil
+}
+
+// withQuery adds params to the query string of a registered redirect URI, keeping its own parameters
+func withQuery(redirectURI string, params url.Values) string {
+	uri, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := uri.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	uri.RawQuery = query.Encode()
+	return uri.String()
+}
+
+// OAuthToken is the OAuth2 token endpoint, exchanging an authorization code or a refresh token for tokens.
+// Like the JWKS endpoint it speaks the standard protocol (RFC 6749 sections 5.1 and 5.2), form encoded
+// requests and bare JSON responses, so OAuth client libraries can use it.
+func OAuthToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	client, ok := oauthClientFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var tokens *auth.OAuthTokens
+	var err error
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		tokens, err = auth.ExchangeAuthorizationCode(ctx, client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"), clientInfoFromRequest(r))
+	case "refresh_token":
+		tokens, err = auth.RefreshOAuthTokens(ctx, client, r.PostForm.Get("refresh_token"), clientInfoFromRequest(r))
+	default:
+		writeOAuthError(w, r, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidGrant) {
+		audit.Record(r, audit.Event{Action: audit.ActionOAuthToken, Resource: client.ClientID, Err: err})
+		writeOAuthError(w, r, http.StatusBadRequest, "invalid_grant", "the code or refresh token is invalid, expired or was issued to another client")
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error(fmt.Sprintf("failed to issue oauth tokens for client %s", client.ClientID), err)
+		writeOAuthError(w, r, http.StatusInternalServerError, "server_error", "unable to issue tokens")
+		return
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionOAuthToken, UserID: tokens.UserID, Resource: client.ClientID,
+		After: map[string]string{"grant_type": r.PostForm.Get("grant_type"), "scope": tokens.Scope}})
+	logger.FromContext(ctx).Infof("Issued OAuth tokens to client %s for scopes %q", client.ClientID, tokens.Scope)
+	writeOAuthJSON(w, r, http.StatusOK, tokens)
+}
+
+// OAuthIntrospect is the token introspection endpoint (RFC 7662) for confidential clients, reporting whether
+// a token the client holds is still active
+func OAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	client, ok := oauthClientFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !client.Confidential() {
+		writeOAuthError(w, r, http.StatusUnauthorized, "invalid_client", "only confidential clients can introspect tokens")
+		return
+	}
+
+	introspection, err := auth.IntrospectToken(r.Context(), client, r.PostForm.Get("token"))
+	if err != nil {
+		logger.FromContext(r.Context()).Error(fmt.Sprintf("failed to introspect token for client %s", client.ClientID), err)
+		writeOAuthError(w, r, http.StatusInternalServerError, "server_error", "unable to introspect token")
+		return
+	}
+
+	writeOAuthJSON(w, r, http.StatusOK, introspection)
+}
+
+// oauthClientFromRequest parses the form body and authenticates the client with HTTP Basic authentication or
+// the client_id and client_secret form parameters, writing the error response when it fails
+func oauthClientFromRequest(w http.ResponseWriter, r *http.Request) (*models.OAuthClient, bool) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, r, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return nil, false
+	}
+
+	clientID, clientSecret, basic := r.BasicAuth()
+	if !basic {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := auth.AuthenticateOAuthClient(r.Context(), clientID, clientSecret)
+	if errors.Is(err, auth.ErrInvalidClient) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		writeOAuthError(w, r, http.StatusUnauthorized, "invalid_client", "unknown client or wrong client secret")
+		return nil, false
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("failed to authenticate oauth client", err)
+		writeOAuthError(w, r, http.StatusInternalServerError, "server_error", "unable to authenticate client")
+		return nil, false
+	}
+	return client, true
+}
+
+// writeOAuthError writes an OAuth error response (RFC 6749 section 5.2)
+func writeOAuthError(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	writeOAuthJSON(w, r, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeOAuthJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	response, err := json.Marshal(body)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("failed to marshal oauth response", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// responses carry tokens, RFC 6749 section 5.1 forbids caching them
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// GetOAuthConsents lists the third-party apps the user granted access to, including revoked ones
+func GetOAuthConsents(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	consents, err := repository.GetUserOAuthConsents(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to get oauth consents: %w", err))
+	}
+
+	interceptor.SendSuccessResponse(w, r, consents, http.StatusOK)
+	return nil
+}
+
+// RevokeOAuthConsent revokes the access of a third-party app: its refresh and access tokens stop working at once,
+// access tokens being refused by the auth middleware once the consent is gone
+func RevokeOAuthConsent(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	clientID := httprouter.ParamsFromContext(ctx).ByName("client_id")
+	err = repository.RevokeOAuthConsent(ctx, userUUID, clientID)
+	if errors.Is(err, repository.ErrOAuthConsentNotFound) {
+		return interceptor.ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return interceptor.ErrOAuth.Wrap(fmt.Errorf("failed to revoke oauth consent: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionOAuthConsentRevoke, Resource: clientID})
+	logger.FromContext(ctx).Infof("User %s revoked the access of OAuth client %s", userUUID, clientID)
+	interceptor.SendSuccessResponse(w, r, "App access revoked successfully", http.StatusOK)
+	return nil
+}
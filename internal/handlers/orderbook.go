@@ -1,14 +1,14 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 
-	"github.com/google/uuid"
 	"github.com/prajwalbharadwajbm/broker/internal/db/models"
 	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
 	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
-	orderbook "github.com/prajwalbharadwajbm/broker/internal/service/PNL"
+	orderbook "github.com/prajwalbharadwajbm/broker/internal/service/pnl"
 )
 
 // OrderbookSummary represents orderbook summary statistics
@@ -29,34 +29,28 @@ type OrderbookResponse struct {
 }
 
 // GetOrderbook returns orderbook data with PNL calculations from the database
-func GetOrderbook(w http.ResponseWriter, r *http.Request) {
+func GetOrderbook(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	// Get user ID from context (set by auth middleware)
-	userId := ctx.Value("userId").(string)
-	userUUID, err := uuid.Parse(userId)
+	userUUID, err := userIDFromRequest(r)
 	if err != nil {
-		logger.Log.Error("failed to parse user ID", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return err
 	}
+	userId := userUUID.String()
 
-	logger.Log.Infof("Processing GET /orderbook request for user: %s", userId)
+	logger.FromContext(ctx).Infof("Processing GET /orderbook request for user: %s", userId)
 
 	// Fetch orderbook entries from database
 	orderbookEntries, err := repository.GetOrderbookEntries(ctx)
 	if err != nil {
-		logger.Log.Error("failed to fetch orderbook entries", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrOrderbook.Wrap(fmt.Errorf("failed to fetch orderbook entries: %w", err))
 	}
 
 	// Fetch user positions for PNL calculation
 	userPositions, err := repository.GetUserPositions(ctx, userUUID)
 	if err != nil {
-		logger.Log.Error("failed to fetch user positions", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrOrderbook.Wrap(fmt.Errorf("failed to fetch user positions: %w", err))
 	}
 
 	// Calculate PNL from user positions
@@ -71,8 +65,9 @@ func GetOrderbook(w http.ResponseWriter, r *http.Request) {
 		Summary: summary,
 	}
 
-	logger.Log.Infof("Successfully fetched orderbook data with %d entries for user: %s", len(orderbookEntries), userId)
-	interceptor.SendSuccessResponse(w, response, http.StatusOK)
+	logger.FromContext(ctx).Infof("Successfully fetched orderbook data with %d entries for user: %s", len(orderbookEntries), userId)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
 }
 
 // calculateOrderbookSummary calculates summary statistics for the orderbook
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/mailer"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
+	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+	"github.com/prajwalbharadwajbm/broker/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChangePassword replaces the password of the logged in user after checking the current one,
+// every session of the user is logged out
+func ChangePassword(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.ChangePassword](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	user, err := repository.GetUserByID(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrPasswordChange.Wrap(fmt.Errorf("failed to get user: %w", err))
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(requestData.OldPassword)) != nil {
+		audit.Record(r, audit.Event{Action: audit.ActionPasswordChange, Err: interceptor.ErrIncorrectPassword})
+		return interceptor.ErrIncorrectPassword
+	}
+
+	hashedPassword, err := hashNewPassword(user.Email, requestData.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	err = repository.UpdatePassword(ctx, userUUID, hashedPassword)
+	if err != nil {
+		return interceptor.ErrPasswordChange.Wrap(fmt.Errorf("failed to update password: %w", err))
+	}
+
+	if err := passwordChanged(ctx, user.ID, user.Email); err != nil {
+		return err
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionPasswordChange})
+
+	interceptor.SendSuccessResponse(w, r, "Password changed successfully, please log in again", http.StatusOK)
+	return nil
+}
+
+// RequestPasswordReset emails a single use reset link to the user. The response is the same
+// whether or not the email belongs to an account, to avoid user enumeration.
+func RequestPasswordReset(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.PasswordResetRequest](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	response := "If an account exists for this email, a password reset link has been sent"
+
+	user, err := repository.GetUserByEmail(ctx, requestData.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+		return nil
+	}
+	if err != nil {
+		return interceptor.ErrPasswordChange.Wrap(fmt.Errorf("failed to get user: %w", err))
+	}
+	userUUID := user.ID
+
+	token, err := auth.IssuePasswordResetToken(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrPasswordChange.Wrap(fmt.Errorf("failed to issue password reset token: %w", err))
+	}
+
+	link := config.AppConfigInstance.Mailer.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	sendEmail(ctx, mailer.PasswordResetEmail(requestData.Email, link, auth.PasswordResetTTL))
+
+	logger.FromContext(ctx).Infof("Issued password reset token for user: %s", userUUID)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
+}
+
+// ConfirmPasswordReset sets a new password with the token from a reset email,
+// every session of the user is logged out
+func ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.PasswordResetConfirm](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	tokenHash := auth.HashUserToken(requestData.Token)
+
+	// look the user up first so the password can be validated without using up the token
+	userUUID, err := repository.GetUserTokenOwner(ctx, repository.PurposePasswordReset, tokenHash)
+	if errors.Is(err, repository.ErrUserTokenInvalid) {
+		return interceptor.ErrInvalidResetToken
+	}
+	if err != nil {
+		return interceptor.ErrPasswordChange.Wrap(fmt.Errorf("failed to get password reset token: %w", err))
+	}
+	user, err := repository.GetUserByID(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrPasswordChange.Wrap(fmt.Errorf("failed to get user: %w", err))
+	}
+
+	hashedPassword, err := hashNewPassword(user.Email, requestData.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = repository.ResetPassword(ctx, tokenHash, hashedPassword)
+	if errors.Is(err, repository.ErrUserTokenInvalid) {
+		return interceptor.ErrInvalidResetToken
+	}
+	if err != nil {
+		return interceptor.ErrPasswordChange.Wrap(fmt.Errorf("failed to reset password: %w", err))
+	}
+
+	if err := passwordChanged(ctx, user.ID, user.Email); err != nil {
+		return err
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionPasswordReset, UserID: user.ID.String()})
+
+	interceptor.SendSuccessResponse(w, r, "Password reset successfully, please log in with the new password", http.StatusOK)
+	return nil
+}
+
+// hashNewPassword checks the password rules involving the user's email, which the request
+// validation cannot, and returns the bcrypt hash of the password
+func hashNewPassword(email, password string) ([]byte, error) {
+	if valid, err := validator.IsValidPassword(email, password); !valid || err != nil {
+		return nil, interceptor.ErrValidation.WithDetails([]dtos.FieldError{{Field: "new_password", Code: err.Error()}})
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, interceptor.ErrPasswordChange.Wrap(fmt.Errorf("failed to hash password: %w", err))
+	}
+	return hashedPassword, nil
+}
+
+// passwordChanged logs the user out everywhere and notifies them of the change
+func passwordChanged(ctx context.Context, userUUID uuid.UUID, email string) error {
+	if err := auth.RevokeUserCredentials(ctx, userUUID); err != nil {
+		return interceptor.ErrPasswordChange.Wrap(err)
+	}
+	sendEmail(ctx, mailer.PasswordChangedEmail(email))
+	logger.FromContext(ctx).Infof("Changed password and revoked all sessions for user: %s", userUUID)
+	return nil
+}
+
+// sendEmail sends the email in the background so the response does not wait on the
+// mail server, and does not reveal through its timing whether an email was sent. Only the
+// request's logger is carried over, the send must outlive the request.
+func sendEmail(ctx context.Context, msg mailer.Message) {
+	log := logger.FromContext(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(logger.WithContext(context.Background(), log), 30*time.Second)
+		defer cancel()
+		if err := mailer.Default.Send(ctx, msg); err != nil {
+			log.Error("Failed to send email", err)
+		}
+	}()
+}
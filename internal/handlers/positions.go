@@ -1,14 +1,14 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 
-	"github.com/google/uuid"
 	"github.com/prajwalbharadwajbm/broker/internal/db/models"
 	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
 	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
-	positions "github.com/prajwalbharadwajbm/broker/internal/service/PNL"
+	positions "github.com/prajwalbharadwajbm/broker/internal/service/pnl"
 )
 
 // PositionsSummary represents positions summary Card information
@@ -27,26 +27,22 @@ type PositionsResponse struct {
 }
 
 // GetPositions returns all user positions with PNL calculations from the database
-func GetPositions(w http.ResponseWriter, r *http.Request) {
+func GetPositions(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	// Get user ID from context (set by auth middleware)
-	userId := ctx.Value("userId").(string)
-	userUUID, err := uuid.Parse(userId)
+	userUUID, err := userIDFromRequest(r)
 	if err != nil {
-		logger.Log.Error("failed to parse user ID", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return err
 	}
+	userId := userUUID.String()
 
-	logger.Log.Infof("Processing GET /positions request for user: %s", userId)
+	logger.FromContext(ctx).Infof("Processing GET /positions request for user: %s", userId)
 
 	// Fetch user positions from database
 	userPositions, err := repository.GetUserPositions(ctx, userUUID)
 	if err != nil {
-		logger.Log.Error("failed to fetch user positions", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrPositions.Wrap(fmt.Errorf("failed to fetch user positions: %w", err))
 	}
 
 	// Calculate PNL from user positions
@@ -61,8 +57,9 @@ func GetPositions(w http.ResponseWriter, r *http.Request) {
 		Summary:   summary,
 	}
 
-	logger.Log.Infof("Successfully fetched %d positions for user: %s", len(userPositions), userId)
-	interceptor.SendSuccessResponse(w, response, http.StatusOK)
+	logger.FromContext(ctx).Infof("Successfully fetched %d positions for user: %s", len(userPositions), userId)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
 }
 
 // calculatePositionsSummary calculates summary statistics for positions
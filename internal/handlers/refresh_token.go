@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
 	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
 	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
 	"github.com/prajwalbharadwajbm/broker/internal/utils"
 )
@@ -16,66 +19,59 @@ type RefreshTokenRequest struct {
 }
 
 // RefreshToken handles the refresh token endpoint
-func RefreshToken(w http.ResponseWriter, r *http.Request) {
+func RefreshToken(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	requestData, err := utils.FetchDataFromRequestBody[RefreshTokenRequest](r)
 	if err != nil {
-		logger.Log.Error("unable to fetch request body", err)
-		interceptor.SendErrorResponse(w, "BPB001", http.StatusBadRequest)
-		return
+		return interceptor.ErrBadRequest.Wrap(err)
 	}
 
 	if requestData.RefreshToken == "" {
-		logger.Log.Info("refresh token is required")
-		interceptor.SendErrorResponse(w, "BPB010", http.StatusBadRequest)
-		return
+		return interceptor.ErrRefreshTokenRequired
 	}
 
-	// Validate refresh token exists and is not expired
-	storedToken, err := repository.ValidateRefreshToken(ctx, requestData.RefreshToken)
+	// Generate new refresh token for rotation
+	newRefreshToken, err := auth.GenerateRefreshToken()
 	if err != nil {
-		logger.Log.Error("failed to validate refresh token", err)
-		interceptor.SendErrorResponse(w, "BPB011", http.StatusInternalServerError)
-		return
+		return interceptor.ErrTokenGeneration.Wrap(fmt.Errorf("failed to generate new refresh token: %w", err))
 	}
 
-	if storedToken == nil {
-		logger.Log.Info("invalid or expired refresh token")
-		interceptor.SendErrorResponse(w, "BPB012", http.StatusUnauthorized)
-		return
+	// Revoke the presented token and store its replacement in the same family (token rotation)
+	// tokens granted to OAuth clients only refresh through the OAuth token endpoint, keeping their scopes
+	storedToken, err := repository.RotateRefreshToken(ctx, requestData.RefreshToken, newRefreshToken, nil,
+		auth.GetRefreshTokenExpiration(), clientInfoFromRequest(r))
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		// a rotated token only comes back if it was copied, so neither holder can be trusted
+		logger.FromContext(ctx).Error(fmt.Sprintf("Security event: refresh token reuse detected, revoked token family %s of user_id: %s",
+			storedToken.FamilyID, storedToken.UserID), err)
+		audit.Record(r, audit.Event{Action: audit.ActionTokenRefresh, UserID: storedToken.UserID.String(),
+			Resource: storedToken.FamilyID.String(), Err: interceptor.ErrInvalidRefreshToken})
+		return interceptor.ErrInvalidRefreshToken.Wrap(err)
 	}
-
-	// Generate new access token
-	newAccessToken, err := auth.GenerateToken(storedToken.UserID.String())
 	if err != nil {
-		logger.Log.Error("failed to generate new access token", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+		return interceptor.ErrRefreshTokenProcessing.Wrap(fmt.Errorf("failed to rotate refresh token: %w", err))
 	}
 
-	// Generate new refresh token for rotation
-	newRefreshToken, err := auth.GenerateRefreshToken()
-	if err != nil {
-		logger.Log.Error("failed to generate new refresh token", err)
-		interceptor.SendErrorResponse(w, "BPB009", http.StatusInternalServerError)
-		return
+	if storedToken == nil {
+		return interceptor.ErrInvalidRefreshToken
 	}
 
-	// Update the refresh token in database (token rotation)
-	err = repository.RevokeRefreshToken(ctx, requestData.RefreshToken)
+	// the role is read again so a changed role reaches the new access token
+	user, err := repository.GetUserByID(ctx, storedToken.UserID)
 	if err != nil {
-		logger.Log.Error("failed to revoke old refresh token", err)
-		interceptor.SendErrorResponse(w, "BPB011", http.StatusInternalServerError)
-		return
+		return interceptor.ErrRefreshTokenProcessing.Wrap(fmt.Errorf("failed to fetch user: %w", err))
+	}
+	if user.FrozenAt != nil {
+		audit.Record(r, audit.Event{Action: audit.ActionTokenRefresh, UserID: user.ID.String(),
+			Resource: storedToken.FamilyID.String(), Err: interceptor.ErrAccountFrozen})
+		return interceptor.ErrAccountFrozen
 	}
 
-	refreshTokenExpiry := auth.GetRefreshTokenExpiration()
-	_, err = repository.CreateRefreshToken(ctx, storedToken.UserID, newRefreshToken, refreshTokenExpiry)
+	// Generate new access token
+	newAccessToken, err := auth.GenerateToken(storedToken.UserID.String(), user.Role)
 	if err != nil {
-		logger.Log.Error("failed to store new refresh token", err)
-		interceptor.SendErrorResponse(w, "BPB011", http.StatusInternalServerError)
-		return
+		return interceptor.ErrTokenGeneration.Wrap(fmt.Errorf("failed to generate new access token: %w", err))
 	}
 
 	response := map[string]interface{}{
@@ -85,38 +81,49 @@ func RefreshToken(w http.ResponseWriter, r *http.Request) {
 		"expires_in":    900, // access token expires in 15 minutes in seconds
 	}
 
-	logger.Log.Infof("Successfully refreshed token for user_id: %s", storedToken.UserID.String())
-	interceptor.SendSuccessResponse(w, response, http.StatusOK)
+	audit.Record(r, audit.Event{Action: audit.ActionTokenRefresh, UserID: storedToken.UserID.String(), Resource: storedToken.FamilyID.String()})
+	logger.FromContext(ctx).Infof("Successfully refreshed token for user_id: %s", storedToken.UserID.String())
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
 }
 
-// RevokeRefreshToken handles token revocation (logout)
-func RevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
+// RevokeRefreshToken handles token revocation (logout), revoking the access token from
+// the optional Authorization header as well
+func RevokeRefreshToken(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	requestData, err := utils.FetchDataFromRequestBody[RefreshTokenRequest](r)
 	if err != nil {
-		logger.Log.Error("unable to fetch request body", err)
-		interceptor.SendErrorResponse(w, "BPB001", http.StatusBadRequest)
-		return
+		return interceptor.ErrBadRequest.Wrap(err)
 	}
 
 	if requestData.RefreshToken == "" {
-		logger.Log.Info("refresh token is required")
-		interceptor.SendErrorResponse(w, "BPB010", http.StatusBadRequest)
-		return
+		return interceptor.ErrRefreshTokenRequired
 	}
 
 	err = repository.RevokeRefreshToken(ctx, requestData.RefreshToken)
 	if err != nil {
-		logger.Log.Error("failed to revoke refresh token", err)
-		interceptor.SendErrorResponse(w, "BPB011", http.StatusInternalServerError)
-		return
+		return interceptor.ErrRefreshTokenProcessing.Wrap(fmt.Errorf("failed to revoke refresh token: %w", err))
+	}
+
+	// the access token of the session is revoked too when the client sends it, an invalid or
+	// expired one needs no revocation so it does not fail the logout
+	var userId string
+	if accessToken, ok := auth.BearerToken(r.Header.Get("Authorization")); ok {
+		if claims, err := auth.ValidateToken(accessToken); err == nil {
+			if err := auth.RevokeAccessToken(ctx, claims); err != nil {
+				return interceptor.ErrRefreshTokenProcessing.Wrap(fmt.Errorf("failed to revoke access token: %w", err))
+			}
+			userId = claims.UserID
+		}
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionTokenRevoke, UserID: userId})
 
 	response := map[string]interface{}{
 		"message": "Token revoked successfully",
 	}
 
-	logger.Log.Info("Successfully revoked refresh token")
-	interceptor.SendSuccessResponse(w, response, http.StatusOK)
+	logger.FromContext(ctx).Info("Successfully revoked refresh token")
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
 }
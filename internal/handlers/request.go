@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+	"github.com/prajwalbharadwajbm/broker/internal/validator"
+)
+
+// validateRequest validates a request DTO against its `validate` tags,
+// field level failures are returned as ErrValidation details
+func validateRequest(r *http.Request, data any) error {
+	fieldErrors, err := validator.Struct(r.Context(), data)
+	if err != nil {
+		return interceptor.ErrInternal.Wrap(fmt.Errorf("unable to validate request body: %w", err))
+	}
+	if len(fieldErrors) > 0 {
+		return interceptor.ErrValidation.WithDetails(fieldErrors)
+	}
+	return nil
+}
+
+// userIDFromRequest returns the authenticated user id set by the auth middleware
+func userIDFromRequest(r *http.Request) (uuid.UUID, error) {
+	userId, _ := r.Context().Value("userId").(string)
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		return uuid.Nil, interceptor.ErrInternal.Wrap(fmt.Errorf("failed to parse user ID: %w", err))
+	}
+	return userUUID, nil
+}
+
+// clientInfoFromRequest returns the device details recorded with a session, clients can
+// name the device with the optional X-Device-Name header
+func clientInfoFromRequest(r *http.Request) models.ClientInfo {
+	return models.ClientInfo{
+		DeviceName: truncate(r.Header.Get("X-Device-Name"), 100),
+		UserAgent:  truncate(r.UserAgent(), 512),
+		IPAddress:  utils.ClientIP(r, config.AppConfigInstance.GeneralConfig.TrustedProxyHops),
+	}
+}
+
+// truncate shortens s to at most n runes so it fits its column
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// pageFromQuery reads the limit and offset query parameters of a listing, limit defaults to 50 and is capped at 200
+func pageFromQuery(query url.Values) (int, int, error) {
+	limit, err := queryInt(query.Get("limit"), defaultPageLimit)
+	if err != nil || limit < 1 {
+		return 0, 0, interceptor.ErrBadRequest.Wrap(fmt.Errorf("invalid limit %q", query.Get("limit")))
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		return 0, 0, interceptor.ErrBadRequest.Wrap(fmt.Errorf("invalid offset %q", query.Get("offset")))
+	}
+	return min(limit, maxPageLimit), offset, nil
+}
+
+// queryInt parses an integer query parameter, fallback when it is absent
+func queryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
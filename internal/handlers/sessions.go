@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
+	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+)
+
+// GetSessions lists the active sessions (logged in devices) of the user
+func GetSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := repository.GetActiveSessions(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrSessions.Wrap(fmt.Errorf("failed to get sessions: %w", err))
+	}
+
+	interceptor.SendSuccessResponse(w, r, sessions, http.StatusOK)
+	return nil
+}
+
+// RevokeSession logs the user out of one session
+func RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := uuid.Parse(httprouter.ParamsFromContext(ctx).ByName("id"))
+	if err != nil {
+		return interceptor.ErrSessionNotFound
+	}
+
+	err = repository.RevokeSession(ctx, userUUID, sessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return interceptor.ErrSessionNotFound
+	}
+	if err != nil {
+		return interceptor.ErrSessions.Wrap(fmt.Errorf("failed to revoke session: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionSessionRevoke, Resource: sessionID.String()})
+	logger.FromContext(ctx).Infof("Successfully revoked session %s for user: %s", sessionID, userUUID)
+	interceptor.SendSuccessResponse(w, r, "Session revoked successfully", http.StatusOK)
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere, including the current session, and revokes
+// every access token issued so far
+func RevokeAllSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	err = repository.RevokeAllUserRefreshTokens(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrSessions.Wrap(fmt.Errorf("failed to revoke all sessions: %w", err))
+	}
+
+	err = auth.RevokeUserAccessTokens(ctx, userUUID.String())
+	if err != nil {
+		return interceptor.ErrSessions.Wrap(fmt.Errorf("failed to revoke access tokens: %w", err))
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionSessionRevokeAll})
+	logger.FromContext(ctx).Infof("Successfully revoked all sessions for user: %s", userUUID)
+	interceptor.SendSuccessResponse(w, r, "All sessions revoked successfully", http.StatusOK)
+	return nil
+}
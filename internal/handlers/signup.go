@@ -5,43 +5,50 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/google/uuid"
 	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
 	"github.com/prajwalbharadwajbm/broker/internal/dtos"
 	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/metrics"
 	"github.com/prajwalbharadwajbm/broker/internal/utils"
-	"github.com/prajwalbharadwajbm/broker/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// register a new user with email and password.
-func Signup(w http.ResponseWriter, r *http.Request) {
+// register a new user with email and password, trading is blocked until the email
+// address is verified with the link sent to it.
+func Signup(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	userData, err := utils.FetchDataFromRequestBody[dtos.User](r)
 	if err != nil {
-		logger.Log.Error("unable to fetch request body", err)
-		interceptor.SendErrorResponse(w, "BPB001", http.StatusBadRequest)
-		return
+		return interceptor.ErrBadRequest.Wrap(err)
 	}
 
-	valid, err := validateRequestBody(userData)
-	if !valid || err != nil {
-		logger.Log.Info("request body is not valid %v", err)
-		interceptor.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
-		return
+	if err := validateRequest(r, userData); err != nil {
+		return err
 	}
+
 	userID, err := registerUser(ctx, userData)
 	if err != nil {
-		logger.Log.Error("unable to register user", err)
-		interceptor.SendErrorResponse(w, "BPB005", http.StatusBadRequest)
-		return
+		return interceptor.ErrRegistration.Wrap(err)
+	}
+	metrics.Signups.Inc()
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return interceptor.ErrInternal.Wrap(fmt.Errorf("failed to parse user ID: %w", err))
+	}
+	// the account is created either way, the user can ask for a new link if this fails
+	if err := sendVerificationEmail(ctx, userUUID, userData.Email); err != nil {
+		logger.FromContext(ctx).Error("Failed to send verification email", err)
 	}
 	response := map[string]interface{}{
 		"userID": userID,
 	}
-	logger.Log.Infof("Successfully registered user_id: %s", userID)
-	interceptor.SendSuccessResponse(w, response, http.StatusOK)
+	logger.FromContext(ctx).Infof("Successfully registered user_id: %s", userID)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
 }
 
 func registerUser(ctx context.Context, userData dtos.User) (string, error) {
@@ -55,14 +62,3 @@ func registerUser(ctx context.Context, userData dtos.User) (string, error) {
 	}
 	return userId, nil
 }
-
-func validateRequestBody(userData dtos.User) (bool, error) {
-	if valid, err := validator.IsValidEmail(userData.Email); !valid || err != nil {
-		return false, fmt.Errorf("invalid email: %w", err)
-	}
-
-	if valid, err := validator.IsValidPassword(userData.Email, userData.Password); !valid || err != nil {
-		return false, fmt.Errorf("invalid password: %w", err)
-	}
-	return true, nil
-}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// EnrollTwoFactor creates a TOTP secret for the user, it only takes effect
+// once confirmed with a code through VerifyTwoFactor
+func EnrollTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	user, err := repository.GetUserByID(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to get user: %w", err))
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to generate totp secret: %w", err))
+	}
+
+	sealedSecret, err := auth.EncryptTOTPSecret(userUUID, secret)
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to encrypt totp secret: %w", err))
+	}
+
+	err = repository.SavePendingTOTP(ctx, userUUID, sealedSecret)
+	if errors.Is(err, repository.ErrTOTPAlreadyEnabled) {
+		return interceptor.ErrTwoFactorAlreadyEnabled
+	}
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to save totp secret: %w", err))
+	}
+
+	response := map[string]interface{}{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(secret, user.Email),
+	}
+	logger.FromContext(ctx).Infof("Started two-factor enrollment for user: %s", userUUID)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
+}
+
+// VerifyTwoFactor confirms the enrollment with a first code, enables two-factor
+// authentication and returns the backup codes, which are only shown this once
+func VerifyTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.TwoFactorCode](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	totp, err := repository.GetTOTP(ctx, userUUID)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		return interceptor.ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to get two-factor enrollment: %w", err))
+	}
+	if totp.EnabledAt != nil {
+		return interceptor.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := auth.TOTPSecret(totp)
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(err)
+	}
+
+	step, ok := auth.MatchTOTP(secret, requestData.Code, time.Now())
+	if !ok {
+		return interceptor.ErrInvalidTwoFactorCode
+	}
+
+	backupCodes, backupCodeHashes, err := auth.GenerateBackupCodes()
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to generate backup codes: %w", err))
+	}
+
+	err = repository.EnableTOTP(ctx, userUUID, step, backupCodeHashes)
+	if errors.Is(err, repository.ErrTOTPAlreadyEnabled) {
+		return interceptor.ErrTwoFactorAlreadyEnabled
+	}
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to enable two-factor authentication: %w", err))
+	}
+
+	response := map[string]interface{}{
+		"backup_codes": backupCodes,
+	}
+	logger.FromContext(ctx).Infof("Enabled two-factor authentication for user: %s", userUUID)
+	interceptor.SendSuccessResponse(w, r, response, http.StatusOK)
+	return nil
+}
+
+// DisableTwoFactor turns off two-factor authentication after re-authenticating the
+// user with their password and a TOTP or backup code
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userUUID, err := userIDFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	requestData, err := utils.FetchDataFromRequestBody[dtos.DisableTwoFactor](r)
+	if err != nil {
+		return interceptor.ErrBadRequest.Wrap(err)
+	}
+	if err := validateRequest(r, requestData); err != nil {
+		return err
+	}
+
+	user, err := repository.GetUserByID(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to get user: %w", err))
+	}
+	now := time.Now()
+	if err := loginWaitError(w, user, now); err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(requestData.Password)) != nil {
+		return interceptor.ErrInvalidCredentials
+	}
+
+	verified, err := auth.VerifySecondFactor(ctx, userUUID, requestData.Code)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		return interceptor.ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to verify two-factor code: %w", err))
+	}
+	if !verified {
+		return recordFailedSecondFactor(w, r, user, now)
+	}
+
+	err = repository.DeleteTOTP(ctx, userUUID)
+	if err != nil {
+		return interceptor.ErrTwoFactor.Wrap(fmt.Errorf("failed to disable two-factor authentication: %w", err))
+	}
+
+	logger.FromContext(ctx).Infof("Disabled two-factor authentication for user: %s", userUUID)
+	interceptor.SendSuccessResponse(w, r, "Two-factor authentication disabled successfully", http.StatusOK)
+	return nil
+}
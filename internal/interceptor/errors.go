@@ -1,18 +1,146 @@
 package interceptor
 
-// TODO: Structure it better with user friendly messages
-var errors = map[string]string{
-	"BPB001": "Bad Request",
-	"BPB002": "Invalid Email",
-	"BPB003": "Invalid Password",
-	"BPB004": "Password cannot be same as email",
-	"BPB005": "Unable to register user",
-	"BPB006": "Unable to authenticate user",
-	"BPB007": "User not found",
-	"BPB008": "Invalid username or password",
-	"BPB009": "Unable to generate token",
-	"BPB010": "Refresh token is required",
-	"BPB011": "Unable to process refresh token",
-	"BPB012": "Invalid or expired refresh token",
-	"BPB500": "Internal Server Error",
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+)
+
+// docsBaseURL points at the error code reference, each code has its own anchor
+const docsBaseURL = "https://github.com/prajwalbharadwajbm/broker-platform-backend/blob/main/docs/Errors.md#"
+
+// Error is a catalogued API error. Handlers return it (optionally wrapping the
+// underlying cause) and the interceptor turns it into the response.
+type Error struct {
+	Code    string
+	Status  int
+	Message string            // user facing message, never includes internal details
+	Details []dtos.FieldError // optional field level details
+	cause   error             // logged but never sent to the client
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// DocsURL returns the link to the documentation of the error code
+func (e *Error) DocsURL() string {
+	return docsBaseURL + strings.ToLower(e.Code)
 }
+
+// Wrap returns a copy of the error carrying the underlying cause for logging
+func (e *Error) Wrap(cause error) *Error {
+	wrapped := *e
+	wrapped.cause = cause
+	return &wrapped
+}
+
+// WithDetails returns a copy of the error with field level details
+func (e *Error) WithDetails(details []dtos.FieldError) *Error {
+	detailed := *e
+	detailed.Details = details
+	return &detailed
+}
+
+// catalog holds every error by code, used to resolve field level codes
+var catalog = map[string]*Error{}
+
+func newError(code string, status int, message string) *Error {
+	err := &Error{Code: code, Status: status, Message: message}
+	catalog[code] = err
+	return err
+}
+
+// Lookup returns the catalogued error for a code
+func Lookup(code string) (*Error, bool) {
+	err, ok := catalog[code]
+	return err, ok
+}
+
+// Request errors
+var (
+	ErrBadRequest        = newError("BPB001", http.StatusBadRequest, "Bad Request")
+	ErrInvalidEmail      = newError("BPB002", http.StatusBadRequest, "Invalid Email")
+	ErrInvalidPassword   = newError("BPB003", http.StatusBadRequest, "Invalid Password, it must be at least 8 characters")
+	ErrPasswordSameEmail = newError("BPB004", http.StatusBadRequest, "Password cannot be same as email")
+	ErrValidation        = newError("BPB063", http.StatusBadRequest, "Request validation failed")
+)
+
+// Field level validation errors, returned in the details of ErrValidation
+var (
+	ErrFieldRequired           = newError("BPB064", http.StatusBadRequest, "Field is required")
+	ErrFieldNotPositive        = newError("BPB065", http.StatusBadRequest, "Value must be greater than zero")
+	ErrFieldPrecision          = newError("BPB066", http.StatusBadRequest, "Value has too many decimal places")
+	ErrFieldNotAllowed         = newError("BPB067", http.StatusBadRequest, "Value is not one of the allowed values")
+	ErrFieldUnknownSymbol      = newError("BPB068", http.StatusBadRequest, "Unknown symbol")
+	ErrFieldInvalidDate        = newError("BPB025", http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+	ErrFieldInvalidIP          = newError("BPB048", http.StatusBadRequest, "Invalid IP address or CIDR range")
+	ErrFieldNotFuture          = newError("BPB049", http.StatusBadRequest, "Time must be in the future")
+	ErrFieldInvalidRedirectURI = newError("BPB055", http.StatusBadRequest, "Invalid redirect URI, it must be an absolute https URL, or http on localhost, without a fragment")
+)
+
+// Authentication and authorization errors
+var (
+	ErrRegistration             = newError("BPB005", http.StatusBadRequest, "Unable to register user")
+	ErrAuthentication           = newError("BPB006", http.StatusInternalServerError, "Unable to authenticate user")
+	ErrInvalidCredentials       = newError("BPB008", http.StatusUnauthorized, "Invalid username or password")
+	ErrTokenGeneration          = newError("BPB009", http.StatusInternalServerError, "Unable to generate token")
+	ErrRefreshTokenRequired     = newError("BPB010", http.StatusBadRequest, "Refresh token is required")
+	ErrRefreshTokenProcessing   = newError("BPB011", http.StatusInternalServerError, "Unable to process refresh token")
+	ErrInvalidRefreshToken      = newError("BPB012", http.StatusUnauthorized, "Invalid or expired refresh token")
+	ErrInvalidAuthHeader        = newError("BPB013", http.StatusUnauthorized, "Invalid authorization header")
+	ErrAccessDenied             = newError("BPB014", http.StatusForbidden, "Access denied")
+	ErrInvalidAccessToken       = newError("BPB028", http.StatusUnauthorized, "Invalid or expired access token")
+	ErrAuthHeaderRequired       = newError("BPB029", http.StatusUnauthorized, "Authorization header is required")
+	ErrSessionNotFound          = newError("BPB030", http.StatusNotFound, "Session not found")
+	ErrSessions                 = newError("BPB031", http.StatusInternalServerError, "Unable to process sessions")
+	ErrInvalidTwoFactorCode     = newError("BPB032", http.StatusUnauthorized, "Invalid two-factor authentication code")
+	ErrTwoFactorAlreadyEnabled  = newError("BPB033", http.StatusConflict, "Two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled     = newError("BPB034", http.StatusBadRequest, "Two-factor authentication is not set up")
+	ErrInvalidChallengeToken    = newError("BPB035", http.StatusUnauthorized, "Invalid or expired login challenge")
+	ErrTwoFactor                = newError("BPB036", http.StatusInternalServerError, "Unable to process two-factor authentication")
+	ErrInvalidResetToken        = newError("BPB037", http.StatusBadRequest, "Invalid or expired password reset link")
+	ErrPasswordChange           = newError("BPB038", http.StatusInternalServerError, "Unable to change password")
+	ErrIncorrectPassword        = newError("BPB039", http.StatusUnauthorized, "Current password is incorrect")
+	ErrEmailNotVerified         = newError("BPB040", http.StatusForbidden, "Email address is not verified")
+	ErrInvalidVerificationToken = newError("BPB041", http.StatusBadRequest, "Invalid or expired email verification link")
+	ErrEmailAlreadyVerified     = newError("BPB042", http.StatusConflict, "Email address is already verified")
+	ErrTooManyRequests          = newError("BPB043", http.StatusTooManyRequests, "Too many requests, please retry later")
+	ErrEmailVerification        = newError("BPB044", http.StatusInternalServerError, "Unable to process email verification")
+	ErrAccountLocked            = newError("BPB045", http.StatusLocked, "Account is temporarily locked after too many failed login attempts")
+	ErrUserNotFound             = newError("BPB046", http.StatusNotFound, "User not found")
+	ErrUserManagement           = newError("BPB047", http.StatusInternalServerError, "Unable to manage user")
+	ErrInvalidAPIKey            = newError("BPB050", http.StatusUnauthorized, "Invalid API key or request signature")
+	ErrAPIKeyScope              = newError("BPB051", http.StatusForbidden, "API key does not have the scope required for this endpoint")
+	ErrAPIKeyIPNotAllowed       = newError("BPB052", http.StatusForbidden, "Request IP address is not allowed for this API key")
+	ErrAPIKeyNotFound           = newError("BPB053", http.StatusNotFound, "API key not found")
+	ErrAPIKeys                  = newError("BPB054", http.StatusInternalServerError, "Unable to process API keys")
+	ErrInvalidOAuthRequest      = newError("BPB056", http.StatusBadRequest, "Invalid authorization request")
+	ErrOAuthScope               = newError("BPB057", http.StatusForbidden, "Access token does not have the scope required for this endpoint")
+	ErrOAuthClientNotFound      = newError("BPB058", http.StatusNotFound, "OAuth app not found")
+	ErrOAuth                    = newError("BPB059", http.StatusInternalServerError, "Unable to process OAuth request")
+	ErrAccountFrozen            = newError("BPB060", http.StatusForbidden, "Account is frozen, contact support")
+	ErrImpersonationReadOnly    = newError("BPB061", http.StatusForbidden, "Impersonation tokens are read-only")
+	ErrAuditLog                 = newError("BPB062", http.StatusInternalServerError, "Unable to read the audit log")
+)
+
+// Portfolio errors
+var (
+	ErrCorporateAction     = newError("BPB019", http.StatusInternalServerError, "Unable to process corporate action")
+	ErrHoldingNotFound     = newError("BPB021", http.StatusNotFound, "Holding not found")
+	ErrInsufficientHolding = newError("BPB023", http.StatusBadRequest, "Sell quantity exceeds holding quantity")
+	ErrHoldings            = newError("BPB024", http.StatusInternalServerError, "Unable to process holdings")
+	ErrOrderbook           = newError("BPB026", http.StatusInternalServerError, "Unable to fetch orderbook")
+	ErrPositions           = newError("BPB027", http.StatusInternalServerError, "Unable to fetch positions")
+)
+
+var ErrInternal = newError("BPB500", http.StatusInternalServerError, "Internal Server Error")
@@ -0,0 +1,96 @@
+package interceptor
+
+import (
+	"embed"
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage is used when the client accepts none of the bundled languages,
+// its messages are the ones defined in the catalog
+const defaultLanguage = "en"
+
+// locales holds one message bundle per language, a JSON object of error code to message
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+// translations maps language to error code to message
+var translations = loadTranslations()
+
+func loadTranslations() map[string]map[string]string {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		panic("interceptor: unable to read message bundles: " + err.Error())
+	}
+
+	bundles := make(map[string]map[string]string, len(files))
+	for _, file := range files {
+		content, err := locales.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic("interceptor: unable to read message bundle " + file.Name() + ": " + err.Error())
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(content, &messages); err != nil {
+			panic("interceptor: invalid message bundle " + file.Name() + ": " + err.Error())
+		}
+		bundles[strings.TrimSuffix(file.Name(), path.Ext(file.Name()))] = messages
+	}
+	return bundles
+}
+
+// Localize returns the message of the error in lang, falling back to the English catalog message
+func (e *Error) Localize(lang string) string {
+	if message, ok := translations[lang][e.Code]; ok {
+		return message
+	}
+	return e.Message
+}
+
+// NegotiateLanguage picks the supported language the client prefers most from an
+// Accept-Language header such as "hi-IN,hi;q=0.9,en;q=0.8", defaulting to English
+func NegotiateLanguage(header string) string {
+	type preference struct {
+		lang    string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		preferences = append(preferences, preference{lang: base, quality: quality})
+	}
+
+	// stable so that equally weighted languages keep the order the client sent them in
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	for _, p := range preferences {
+		if p.lang == defaultLanguage {
+			return defaultLanguage
+		}
+		if _, ok := translations[p.lang]; ok {
+			return p.lang
+		}
+	}
+	return defaultLanguage
+}
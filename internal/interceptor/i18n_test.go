@@ -0,0 +1,54 @@
+package interceptor
+
+import "testing"
+
+func TestNegotiateLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"hi", "hi"},
+		{"kn-IN", "kn"},
+		{"hi-IN,hi;q=0.9,en;q=0.8", "hi"},
+		{"en;q=0.5,kn;q=0.9", "kn"},
+		{"fr-FR,fr;q=0.9", "en"},
+		{"fr,hi;q=0.7", "hi"},
+		{"hi;q=0,kn;q=0.1", "kn"},
+		{"EN-us", "en"},
+		{"hi;q=abc", "en"},
+	}
+
+	for _, tt := range tests {
+		if got := NegotiateLanguage(tt.header); got != tt.want {
+			t.Errorf("NegotiateLanguage(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	if got := ErrHoldingNotFound.Localize("en"); got != ErrHoldingNotFound.Message {
+		t.Errorf("Expected English catalog message, got %s", got)
+	}
+	if got := ErrHoldingNotFound.Localize("kn"); got == ErrHoldingNotFound.Message || got == "" {
+		t.Errorf("Expected Kannada message, got %s", got)
+	}
+	if got := ErrHoldingNotFound.Localize("fr"); got != ErrHoldingNotFound.Message {
+		t.Errorf("Expected fallback to English for unknown language, got %s", got)
+	}
+}
+
+func TestMessageBundlesCoverCatalog(t *testing.T) {
+	for lang, messages := range translations {
+		for code := range messages {
+			if _, ok := Lookup(code); !ok {
+				t.Errorf("Bundle %s has message for unknown code %s", lang, code)
+			}
+		}
+		for code := range catalog {
+			if messages[code] == "" {
+				t.Errorf("Bundle %s is missing a message for %s", lang, code)
+			}
+		}
+	}
+}
@@ -2,23 +2,123 @@ package interceptor
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
-func SendErrorResponse(w http.ResponseWriter, errorCode string, statusCode int) {
-	errorMessage := errors[errorCode]
+const problemContentType = "application/problem+json"
+
+// HandlerFunc is an http handler that returns errors instead of writing error responses itself
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Handle adapts a HandlerFunc to an http.HandlerFunc, sending any returned error. Each call runs in a
+// span named after the handler function, e.g. handlers.GetOrderbook.
+func Handle(fn HandlerFunc) http.HandlerFunc {
+	name := handlerName(fn)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), name)
+		defer span.End()
+		r = r.WithContext(ctx)
+
+		if err := fn(w, r); err != nil {
+			var apiErr *Error
+			if errors.As(err, &apiErr) {
+				span.SetAttributes(attribute.String("error.code", apiErr.Code))
+			}
+			// rejected requests are expected, only server errors fail the span
+			if apiErr == nil || apiErr.Status >= http.StatusInternalServerError {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			SendError(w, r, err)
+		}
+	}
+}
+
+// handlerName returns the package qualified name of the handler function
+func handlerName(fn HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// SendError logs err and responds with its catalogued code and status, errors that are not
+// catalogued are sent as BPB500. Messages are localized from the Accept-Language header and
+// clients accepting application/problem+json get an RFC 7807 document.
+func SendError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrInternal.Wrap(err)
+	}
+
+	log := logger.FromContext(r.Context())
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Error(apiErr.Message, err, "code", apiErr.Code, "method", r.Method, "path", r.URL.Path)
+	} else {
+		log.Info("request rejected", "code", apiErr.Code, "error", err.Error(), "method", r.Method, "path", r.URL.Path)
+	}
+
+	// set by the request id middleware, the logger above already carries it
+	requestId, _ := r.Context().Value("requestId").(string)
+
+	lang := NegotiateLanguage(r.Header.Get("Accept-Language"))
+	message := apiErr.Localize(lang)
+
+	details := make([]dtos.FieldError, len(apiErr.Details))
+	for i, detail := range apiErr.Details {
+		details[i] = detail
+		if fieldErr, ok := Lookup(detail.Code); ok {
+			details[i].Message = fieldErr.Localize(lang)
+		}
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), problemContentType) {
+		response := dtos.ProblemDetails{
+			Type:      apiErr.DocsURL(),
+			Title:     message,
+			Status:    apiErr.Status,
+			Instance:  r.URL.Path,
+			Code:      apiErr.Code,
+			Errors:    details,
+			RequestID: requestId,
+		}
+		w.Header().Set("Content-Type", problemContentType)
+		w.Header().Set("Content-Language", lang)
+		w.WriteHeader(apiErr.Status)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
 	response := dtos.InterceptorResponse{
-		ErrorMessage: errorMessage,
-		ErrorCode:    errorCode,
+		ErrorMessage: message,
+		ErrorCode:    apiErr.Code,
+		Details:      details,
+		DocsURL:      apiErr.DocsURL(),
+		RequestID:    requestId,
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	w.Header().Set("Content-Language", lang)
+	w.WriteHeader(apiErr.Status)
 	json.NewEncoder(w).Encode(response)
 }
 
-func SendSuccessResponse(w http.ResponseWriter, data interface{}, statusCode int) {
+// SendSuccessResponse responds with data, the encoding runs in its own span so slow serialization
+// shows apart from the handler's queries
+func SendSuccessResponse(w http.ResponseWriter, r *http.Request, data interface{}, statusCode int) {
+	_, span := tracing.Start(r.Context(), "encode response")
+	defer span.End()
+
 	response := dtos.InterceptorResponse{
 		Data: data,
 	}
@@ -26,3 +126,9 @@ func SendSuccessResponse(w http.ResponseWriter, data interface{}, statusCode int
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
 }
+
+// SetRetryAfter tells the client how long to wait before retrying a rejected request,
+// rounded up to whole seconds. Call it before sending the error.
+func SetRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,137 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitializeGlobalLogger("fatal", logger.FormatConsole, "test", "interceptor-test")
+	m.Run()
+}
+
+func TestSendError(t *testing.T) {
+	t.Run("SendError_CataloguedError", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/holdings", nil)
+
+		SendError(w, r, ErrHoldingNotFound.Wrap(errors.New("no rows")))
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+		var response dtos.InterceptorResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Expected JSON body, got %v", err)
+		}
+		if response.ErrorCode != "BPB021" || response.ErrorMessage != "Holding not found" {
+			t.Errorf("Expected BPB021 Holding not found, got %+v", response)
+		}
+		if response.DocsURL != docsBaseURL+"bpb021" {
+			t.Errorf("Expected docs url for bpb021, got %s", response.DocsURL)
+		}
+	})
+
+	t.Run("SendError_UncataloguedErrorIsInternal", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		SendError(w, r, errors.New("connection refused"))
+
+		var response dtos.InterceptorResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		if w.Code != http.StatusInternalServerError || response.ErrorCode != "BPB500" {
+			t.Errorf("Expected 500 BPB500, got %d %+v", w.Code, response)
+		}
+	})
+
+	t.Run("SendError_ProblemJSONWithDetails", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/holdings", nil)
+		r.Header.Set("Accept", "application/problem+json")
+
+		SendError(w, r, ErrValidation.WithDetails([]dtos.FieldError{{Field: "quantity", Code: "BPB065"}}))
+
+		if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+			t.Errorf("Expected problem+json content type, got %s", got)
+		}
+		var problem dtos.ProblemDetails
+		if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+			t.Fatalf("Expected JSON body, got %v", err)
+		}
+		if problem.Status != http.StatusBadRequest || problem.Code != "BPB063" || problem.Instance != "/api/v1/holdings" {
+			t.Errorf("Unexpected problem document %+v", problem)
+		}
+		if len(problem.Errors) != 1 || problem.Errors[0].Message != "Value must be greater than zero" {
+			t.Errorf("Expected field error with catalogued message, got %+v", problem.Errors)
+		}
+	})
+
+	t.Run("SendError_RequestID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/orderbook", nil)
+		r = r.WithContext(context.WithValue(r.Context(), "requestId", "req-1"))
+
+		SendError(w, r, ErrOrderbook)
+
+		var response dtos.InterceptorResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		if response.RequestID != "req-1" {
+			t.Errorf("Expected request id req-1 in the error body, got %q", response.RequestID)
+		}
+	})
+
+	t.Run("SendError_LocalizedMessages", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/users/signup", nil)
+		r.Header.Set("Accept-Language", "hi-IN,hi;q=0.9,en;q=0.8")
+
+		SendError(w, r, ErrValidation.WithDetails([]dtos.FieldError{{Field: "email", Code: "BPB002"}}))
+
+		if got := w.Header().Get("Content-Language"); got != "hi" {
+			t.Errorf("Expected Content-Language hi, got %s", got)
+		}
+		var response dtos.InterceptorResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		if response.ErrorMessage != translations["hi"]["BPB063"] {
+			t.Errorf("Expected Hindi message, got %s", response.ErrorMessage)
+		}
+		if len(response.Details) != 1 || response.Details[0].Message != translations["hi"]["BPB002"] {
+			t.Errorf("Expected Hindi field error, got %+v", response.Details)
+		}
+	})
+}
+
+func TestHandle(t *testing.T) {
+	handler := Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return ErrAccessDenied
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestSetRetryAfter(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetRetryAfter(w, 1200*time.Millisecond)
+	SendError(w, httptest.NewRequest(http.MethodPost, "/", nil), ErrTooManyRequests)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After rounded up to 2, got %q", got)
+	}
+}
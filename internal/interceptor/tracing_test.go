@@ -0,0 +1,62 @@
+package interceptor
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func getThing(w http.ResponseWriter, r *http.Request) error {
+	SendSuccessResponse(w, r, map[string]int{"count": 1}, http.StatusOK)
+	return nil
+}
+
+func failThing(w http.ResponseWriter, r *http.Request) error {
+	return ErrOrderbook.Wrap(errors.New("connection refused"))
+}
+
+func TestHandleSpans(t *testing.T) {
+	t.Run("EncodeIsChildOfHandler", func(t *testing.T) {
+		recorder := recordSpans(t)
+
+		Handle(getThing)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/thing", nil))
+
+		spans := recorder.Ended()
+		if len(spans) != 2 {
+			t.Fatalf("Expected encode and handler spans, got %d", len(spans))
+		}
+		encode, handler := spans[0], spans[1]
+		if handler.Name() != "interceptor.getThing" || encode.Name() != "encode response" {
+			t.Errorf("Unexpected span names %q and %q", handler.Name(), encode.Name())
+		}
+		if encode.Parent().SpanID() != handler.SpanContext().SpanID() {
+			t.Error("Expected the encode span to be a child of the handler span")
+		}
+	})
+
+	t.Run("ServerErrorFailsSpan", func(t *testing.T) {
+		recorder := recordSpans(t)
+
+		Handle(failThing)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/thing", nil))
+
+		spans := recorder.Ended()
+		if len(spans) != 1 || spans[0].Status().Code != codes.Error {
+			t.Fatalf("Expected one failed handler span, got %+v", spans)
+		}
+	})
+}
@@ -1,12 +1,24 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
+// Output formats, console is meant for reading locally and json for log shipping
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// badKey names the value of a dangling key/value pair, so a missing key shows up in the log instead of being dropped
+const badKey = "!BADKEY"
+
 type Logger struct {
 	logger zerolog.Logger
 }
@@ -14,15 +26,22 @@ type Logger struct {
 var Log *Logger
 
 // InitializeGlobalLogger creates and configures the global logger instance
-func InitializeGlobalLogger(level, env, serviceName string) {
+func InitializeGlobalLogger(level, format, env, serviceName string) {
+	Log = New(os.Stdout, level, format, env, serviceName)
+}
+
+// New creates a logger writing to out in the given format, unknown formats fall back to console
+func New(out io.Writer, level, format, env, serviceName string) *Logger {
 	zerolog.TimeFieldFormat = time.RFC3339
 
-	output := zerolog.ConsoleWriter{
-		Out:        os.Stdout,
-		TimeFormat: time.RFC3339,
+	if format != FormatJSON {
+		out = zerolog.ConsoleWriter{
+			Out:        out,
+			TimeFormat: time.RFC3339,
+		}
 	}
 
-	zeroLogger := zerolog.New(output).
+	zeroLogger := zerolog.New(out).
 		With().
 		Timestamp().
 		Str("service", serviceName).
@@ -35,6 +54,8 @@ func InitializeGlobalLogger(level, env, serviceName string) {
 		logLevel = zerolog.DebugLevel
 	case "info":
 		logLevel = zerolog.InfoLevel
+	case "warn":
+		logLevel = zerolog.WarnLevel
 	case "error":
 		logLevel = zerolog.ErrorLevel
 	case "fatal":
@@ -44,27 +65,83 @@ func InitializeGlobalLogger(level, env, serviceName string) {
 	}
 	zeroLogger = zeroLogger.Level(logLevel)
 
-	Log = &Logger{
+	return &Logger{
 		logger: zeroLogger,
 	}
 }
 
-func (l *Logger) Debug(msg string, fields ...interface{}) {
-	l.logger.Debug().Msg(msg)
+// With returns a child logger adding the key/value pairs to every line it writes
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	return &Logger{
+		logger: l.logger.With().Fields(fields(keyvals)).Logger(),
+	}
+}
+
+// Debug logs msg with the key/value pairs, e.g. Debug("order placed", "symbol", "TCS", "quantity", 10)
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Debug().Fields(fields(keyvals)).Msg(msg)
+}
+
+func (l *Logger) Debugf(msg string, args ...interface{}) {
+	l.logger.Debug().Msgf(msg, args...)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Info().Fields(fields(keyvals)).Msg(msg)
 }
 
-func (l *Logger) Info(msg string, fields ...interface{}) {
-	l.logger.Info().Msg(msg)
+func (l *Logger) Infof(msg string, args ...interface{}) {
+	l.logger.Info().Msgf(msg, args...)
 }
 
-func (l *Logger) Infof(msg string, fields ...interface{}) {
-	l.logger.Info().Msgf(msg, fields...)
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Warn().Fields(fields(keyvals)).Msg(msg)
 }
 
-func (l *Logger) Error(msg string, err error, fields ...interface{}) {
-	l.logger.Error().Err(err).Msg(msg)
+func (l *Logger) Warnf(msg string, args ...interface{}) {
+	l.logger.Warn().Msgf(msg, args...)
+}
+
+func (l *Logger) Error(msg string, err error, keyvals ...interface{}) {
+	l.logger.Error().Err(err).Fields(fields(keyvals)).Msg(msg)
 }
 
 func (l *Logger) Fatal(msg string, err error) {
 	l.logger.Fatal().Err(err).Msg(msg)
 }
+
+// fields turns alternating keys and values into a field list, keys that are not strings are
+// formatted and a value without a key is logged under badKey
+func fields(keyvals []interface{}) []interface{} {
+	if len(keyvals) == 0 {
+		return nil
+	}
+	out := make([]interface{}, 0, len(keyvals)+1)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 == len(keyvals) {
+			out = append(out, badKey, keyvals[i])
+			break
+		}
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		out = append(out, key, keyvals[i+1])
+	}
+	return out
+}
+
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying l, for request scoped loggers holding the request and user ids
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or the global logger when there is none
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Log
+}
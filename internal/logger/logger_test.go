@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", buf.String(), err)
+	}
+	return line
+}
+
+func TestJSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "debug", FormatJSON, "test", "logger-test")
+
+	l.Info("order placed", "symbol", "TCS", "quantity", 10)
+
+	line := decodeLine(t, &buf)
+	want := map[string]interface{}{
+		"level":    "info",
+		"message":  "order placed",
+		"symbol":   "TCS",
+		"quantity": float64(10),
+		"service":  "logger-test",
+		"env":      "test",
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %v", key, line[key], value)
+		}
+	}
+}
+
+func TestErrorFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "debug", FormatJSON, "test", "logger-test")
+
+	l.Error("settlement failed", errors.New("boom"), "user_id", "u1")
+
+	line := decodeLine(t, &buf)
+	if line["level"] != "error" || line["error"] != "boom" || line["user_id"] != "u1" {
+		t.Errorf("unexpected line %v", line)
+	}
+}
+
+func TestDanglingValue(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "debug", FormatJSON, "test", "logger-test")
+
+	l.Warn("odd fields", "symbol", "TCS", "orphan")
+
+	line := decodeLine(t, &buf)
+	if line["level"] != "warn" || line["symbol"] != "TCS" || line[badKey] != "orphan" {
+		t.Errorf("unexpected line %v", line)
+	}
+}
+
+func TestLevelFilters(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "warn", FormatJSON, "test", "logger-test")
+
+	l.Debug("hidden")
+	l.Info("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("expected debug and info to be filtered at warn, got %q", buf.String())
+	}
+	l.Warn("shown")
+	if buf.Len() == 0 {
+		t.Fatal("expected warn to be logged at warn")
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	Log = New(&buf, "debug", FormatJSON, "test", "logger-test")
+
+	if FromContext(context.Background()) != Log {
+		t.Fatal("expected the global logger without a logger in the context")
+	}
+
+	ctx := WithContext(context.Background(), Log.With("request_id", "req-1", "user_id", "u1"))
+	FromContext(ctx).Info("handled")
+
+	line := decodeLine(t, &buf)
+	if line["request_id"] != "req-1" || line["user_id"] != "u1" {
+		t.Errorf("unexpected line %v", line)
+	}
+}
+
+func TestConsoleFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "debug", FormatConsole, "test", "logger-test")
+
+	l.Info("authenticated request", "method", "GET")
+
+	out := buf.String()
+	if json.Valid(buf.Bytes()) || !strings.Contains(out, "authenticated request") || !strings.Contains(out, "method=") {
+		t.Errorf("unexpected console line %q", out)
+	}
+}
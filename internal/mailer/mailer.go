@@ -0,0 +1,149 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails to users
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+const (
+	// LogDriver writes emails to the log (and optionally a directory) instead of sending them, for local testing
+	LogDriver = "log"
+	// SMTPDriver sends emails through an SMTP server
+	SMTPDriver = "smtp"
+)
+
+// Default is the mailer used by the handlers, set by Initialize
+var Default Mailer = &LogMailer{}
+
+// Initialize selects the mailer by the configured driver
+func Initialize(cfg config.Mailer) error {
+	switch cfg.Driver {
+	case LogDriver:
+		Default = &LogMailer{From: cfg.From, Dir: cfg.OutboxDir}
+	case SMTPDriver:
+		if cfg.SMTPHost == "" {
+			return fmt.Errorf("SMTP_HOST is required for the smtp mailer")
+		}
+		Default = &SMTPMailer{
+			From:     cfg.From,
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}
+	case "":
+		return fmt.Errorf("MAILER_DRIVER is required outside dev")
+	default:
+		return fmt.Errorf("unknown mailer driver %q", cfg.Driver)
+	}
+	return nil
+}
+
+// SMTPMailer sends emails through an SMTP server, authenticating with PLAIN auth when a username is set.
+// net/smtp upgrades the connection with STARTTLS when the server supports it.
+type SMTPMailer struct {
+	From     string
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// the envelope sender is the bare address of a From like "Broker Platform <no-reply@example.com>"
+	sender := m.From
+	if address, err := mail.ParseAddress(m.From); err == nil {
+		sender = address.Address
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, sender, []string{msg.To}, format(m.From, msg, time.Now()))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogMailer logs emails instead of sending them. When Dir is set each email is
+// written there as an .eml file that can be opened by any mail client, otherwise
+// it is logged with the tokens of its links redacted.
+type LogMailer struct {
+	From string
+	Dir  string
+}
+
+// linkToken matches the token of the verification and password reset links in emails
+var linkToken = regexp.MustCompile(`([?&]token=)[^&\s]+`)
+
+// redactTokens hides link tokens, anyone reading the logs could otherwise reset the user's password
+func redactTokens(body string) string {
+	return linkToken.ReplaceAllString(body, "${1}REDACTED")
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if m.Dir == "" {
+		logger.FromContext(ctx).Infof("Email to %s - Subject: %s\n%s", msg.To, msg.Subject, redactTokens(msg.Body))
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+	now := time.Now()
+	file := filepath.Join(m.Dir, fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405"), uuid.NewString()))
+	if err := os.WriteFile(file, format(m.From, msg, now), 0o600); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Infof("Email to %s written to %s", msg.To, file)
+	return nil
+}
+
+// format renders msg as an RFC 5322 message
+func format(from string, msg Message, now time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitializeGlobalLogger("fatal", logger.FormatConsole, "test", "mailer-test")
+	os.Exit(m.Run())
+}
+
+func TestLogMailerWritesOutbox(t *testing.T) {
+	dir := t.TempDir()
+	m := &LogMailer{From: "no-reply@broker.test", Dir: dir}
+
+	msg := PasswordResetEmail("user@example.com", "http://localhost/reset?token=abc", 30*time.Minute)
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one email in the outbox, got %v (%v)", files, err)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"From: no-reply@broker.test\r\n",
+		"To: user@example.com\r\n",
+		"Subject: Reset your Broker Platform password\r\n",
+		"http://localhost/reset?token=abc",
+		"valid for 30 minutes",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("email does not contain %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestLogMailerRedactsTokens(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logger.WithContext(context.Background(), logger.New(&buf, "info", logger.FormatJSON, "test", "mailer-test"))
+	m := &LogMailer{From: "no-reply@broker.test"}
+
+	msg := PasswordResetEmail("user@example.com", "http://localhost/reset?token=abc123&lang=en", 30*time.Minute)
+	if err := m.Send(ctx, msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	logged := buf.String()
+	if strings.Contains(logged, "abc123") || !strings.Contains(logged, "token=REDACTED&lang=en") {
+		t.Errorf("expected the link token to be redacted, got %s", logged)
+	}
+}
+
+func TestFormatEncodesNonASCIISubject(t *testing.T) {
+	content := string(format("a@b.test", Message{To: "c@d.test", Subject: "पासवर्ड", Body: "one\ntwo"}, time.Now()))
+	if !strings.Contains(content, "Subject: =?utf-8?q?") {
+		t.Errorf("expected a Q-encoded subject, got:\n%s", content)
+	}
+	if !strings.HasSuffix(content, "\r\n\r\none\r\ntwo") {
+		t.Errorf("expected CRLF line endings in the body, got %q", content)
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	defer func() { Default = &LogMailer{} }()
+
+	if err := Initialize(config.Mailer{Driver: SMTPDriver}); err == nil {
+		t.Error("expected an error for the smtp driver without a host")
+	}
+	if err := Initialize(config.Mailer{}); err == nil {
+		t.Error("expected an error without a driver")
+	}
+	if err := Initialize(config.Mailer{Driver: "carrier-pigeon"}); err == nil {
+		t.Error("expected an error for an unknown driver")
+	}
+	if err := Initialize(config.Mailer{Driver: SMTPDriver, SMTPHost: "smtp.example.com", SMTPPort: 587}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if _, ok := Default.(*SMTPMailer); !ok {
+		t.Errorf("expected an SMTPMailer, got %T", Default)
+	}
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+)
+
+// PasswordResetEmail carries the link to reset a forgotten password
+func PasswordResetEmail(to, link string, validFor time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your Broker Platform password",
+		Body: fmt.Sprintf(`We received a request to reset the password of your Broker Platform account.
+
+Reset your password: %s
+
+The link is valid for %d minutes and can only be used once. If you did not request a reset you can ignore this email, your password stays unchanged.
+`, link, int(validFor.Minutes())),
+	}
+}
+
+// PasswordChangedEmail notifies the user that their password was changed
+func PasswordChangedEmail(to string) Message {
+	return Message{
+		To:      to,
+		Subject: "Your Broker Platform password was changed",
+		Body: `The password of your Broker Platform account was just changed and all your sessions were logged out.
+
+If you did not make this change, reset your password immediately and contact support.
+`,
+	}
+}
+
+// VerifyEmailEmail carries the link confirming the email address of a new account
+func VerifyEmailEmail(to, link string, validFor time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Verify your Broker Platform email address",
+		Body: fmt.Sprintf(`Welcome to Broker Platform! Confirm your email address to start trading.
+
+Verify your email: %s
+
+The link is valid for %d hours. If you did not create an account you can ignore this email.
+`, link, int(validFor.Hours())),
+	}
+}
+
+// AccountLockedEmail warns the user that their account was locked after repeated wrong passwords
+func AccountLockedEmail(to string, lockedUntil time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "Your Broker Platform account was temporarily locked",
+		Body: fmt.Sprintf(`Your Broker Platform account was locked after too many failed login attempts. You can log in again after %s.
+
+If these attempts were not made by you, someone may be trying to guess your password. Reset your password to unlock the account immediately, or contact support.
+`, lockedUntil.UTC().Format("02 Jan 2006 15:04 MST")),
+	}
+}
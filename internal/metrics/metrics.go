@@ -0,0 +1,139 @@
+// Package metrics holds the Prometheus collectors of the platform, served at /metrics
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "broker"
+
+// Result label values
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Holding change label values
+const (
+	ChangeAdd    = "add"
+	ChangeReduce = "reduce"
+)
+
+// HTTP server
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route pattern and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Database, measured around the circuit breaker of ProtectedDB
+var (
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database calls by operation, tx_ operations being statements run on a transaction.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+
+	DBQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Failed database calls by operation, calls rejected by the open circuit breaker included.",
+	}, []string{"operation"})
+
+	CircuitBreakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_circuit_breaker_trips_total",
+		Help:      "Times the database circuit breaker opened.",
+	})
+)
+
+// Background jobs
+var (
+	TokenCleanupRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_cleanup_runs_total",
+		Help:      "Token cleanup runs by table and result.",
+	}, []string{"table", "result"})
+
+	TokenCleanupLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "token_cleanup_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful token cleanup by table.",
+	}, []string{"table"})
+)
+
+// Business
+var (
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result, a password login awaiting its two-factor code is counted once the code is checked.",
+	}, []string{"result"})
+
+	Signups = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signups_total",
+		Help:      "Registered users.",
+	})
+
+	HoldingChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "holding_changes_total",
+		Help:      "Manual holding changes through the holdings API, lots added and sells reducing a holding.",
+	}, []string{"change"})
+)
+
+// RegisterCircuitBreakerState exports the state of the database circuit breaker, 1 when open
+func RegisterCircuitBreakerState(tripped func() bool) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_circuit_breaker_open",
+		Help:      "Whether the database circuit breaker is open (1) or closed (0).",
+	}, func() float64 {
+		if tripped() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// RegisterDBStats exports the connection pool statistics of db
+func RegisterDBStats(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "broker"))
+}
+
+// Handler serves the metrics in the Prometheus text format. When token is set scrapes must send it
+// as a Bearer token, the bearer_token or authorization setting of the scrape config.
+func Handler(token string) http.Handler {
+	metricsHandler := promhttp.Handler()
+	if token == "" {
+		return metricsHandler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		metricsHandler.ServeHTTP(w, r)
+	})
+}
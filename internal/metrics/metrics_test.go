@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	Signups.Inc()
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"OpenWithoutToken", "", "", http.StatusOK},
+		{"MissingToken", "scrape-secret", "", http.StatusUnauthorized},
+		{"WrongToken", "scrape-secret", "Bearer nope", http.StatusUnauthorized},
+		{"ValidToken", "scrape-secret", "Bearer scrape-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			Handler(tt.token).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("Expected status %d, got %d", tt.want, w.Code)
+			}
+			if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), "broker_signups_total") {
+				t.Errorf("Expected broker_signups_total in the scrape, got %s", w.Body.String())
+			}
+		})
+	}
+}
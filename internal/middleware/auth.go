@@ -2,13 +2,19 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/prajwalbharadwajbm/broker/internal/config"
 	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/service/audit"
 	"github.com/prajwalbharadwajbm/broker/internal/service/auth"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
 )
 
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -16,41 +22,172 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		start := time.Now()
 
 		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" && r.Header.Get(auth.APIKeyHeader) != "" {
+			apiKeyAuth(w, r, next)
+			return
+		}
 		if authHeader == "" {
-			logger.Log.Info("missing authorization header")
-			interceptor.SendErrorResponse(w, "BPB010", http.StatusUnauthorized)
+			interceptor.SendError(w, r, interceptor.ErrAuthHeaderRequired)
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			logger.Log.Info("invalid authorization header format")
-			interceptor.SendErrorResponse(w, "BPB013", http.StatusUnauthorized)
+		tokenString, ok := auth.BearerToken(authHeader)
+		if !ok {
+			interceptor.SendError(w, r, interceptor.ErrInvalidAuthHeader)
 			return
 		}
 
-		tokenString := parts[1]
-
 		claims, err := auth.ValidateToken(tokenString)
 		if err != nil {
-			if strings.Contains(err.Error(), "token is expired") {
-				logger.Log.Info("token expired: %v", err)
-				interceptor.SendErrorResponse(w, "BPB012", http.StatusUnauthorized)
+			interceptor.SendError(w, r, interceptor.ErrInvalidAccessToken.Wrap(err))
+			return
+		}
+
+		// tokens stay valid until exp, logout and account changes revoke them earlier
+		revoked, err := auth.IsAccessTokenRevoked(r.Context(), claims)
+		if err != nil {
+			interceptor.SendError(w, r, interceptor.ErrInternal.Wrap(fmt.Errorf("failed to check access token revocation: %w", err)))
+			return
+		}
+		if revoked {
+			interceptor.SendError(w, r, interceptor.ErrInvalidAccessToken)
+			return
+		}
+
+		// tokens issued to OAuth clients only reach the endpoints of their granted scopes, while the
+		// user still consents to the client
+		if claims.ClientID != "" {
+			consented, err := auth.HasOAuthConsent(r.Context(), claims)
+			if err != nil {
+				interceptor.SendError(w, r, interceptor.ErrInternal.Wrap(fmt.Errorf("failed to check oauth consent: %w", err)))
+				return
+			}
+			if !consented {
+				interceptor.SendError(w, r, interceptor.ErrInvalidAccessToken)
 				return
 			}
+			_, scope, _ := routeScope(r.Method, r.URL.Path)
+			if !hasScope(auth.ParseScope(claims.Scope), scope) {
+				interceptor.SendError(w, r, interceptor.ErrOAuthScope)
+				return
+			}
+		}
 
-			logger.Log.Info("invalid token: %v", err)
-			interceptor.SendErrorResponse(w, "BPB012", http.StatusUnauthorized)
+		if claims.Actor != nil {
+			impersonatedRequest(w, r, claims, start, next)
 			return
 		}
 
+		log := requestLogger(r, "user_id", claims.UserID)
 		ctx := context.WithValue(r.Context(), "userId", claims.UserID)
+		ctx = context.WithValue(ctx, "role", claims.Role)
+		ctx = logger.WithContext(ctx, log)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 
-		duration := time.Since(start)
-		// Adding Audit Log
-		logger.Log.Info("Authenticated request - Method: %s, Path: %s, UserID: %s, Latency: %v",
-			r.Method, r.URL.Path, claims.UserID, duration)
+		// request log, actions that must be audited are recorded in audit_events by their handlers
+		log.Info("authenticated request", "method", r.Method, "path", r.URL.Path, "latency", time.Since(start))
 	}
 }
+
+// impersonatedRequest serves a request made by staff with an impersonation token, which may only read.
+// Every request is audit logged with both identities, refused writes included.
+func impersonatedRequest(w http.ResponseWriter, r *http.Request, claims *auth.Claims, start time.Time, next http.HandlerFunc) {
+	log := requestLogger(r, "user_id", claims.UserID, "actor_id", claims.Actor.Subject)
+	ctx := context.WithValue(r.Context(), "userId", claims.UserID)
+	ctx = context.WithValue(ctx, "actorId", claims.Actor.Subject)
+	ctx = logger.WithContext(ctx, log)
+	r = r.WithContext(ctx)
+	resource := r.Method + " " + r.URL.Path
+
+	if !auth.ReadOnlyMethod(r.Method) {
+		audit.Record(r, audit.Event{Action: audit.ActionImpersonatedAccess, Resource: resource, Err: interceptor.ErrImpersonationReadOnly})
+		log.Warn("impersonated request refused", "method", r.Method, "path", r.URL.Path)
+		interceptor.SendError(w, r, interceptor.ErrImpersonationReadOnly)
+		return
+	}
+
+	audit.Record(r, audit.Event{Action: audit.ActionImpersonatedAccess, Resource: resource})
+	next.ServeHTTP(w, r)
+
+	log.Info("impersonated request", "method", r.Method, "path", r.URL.Path, "latency", time.Since(start))
+}
+
+// routeScopes maps the endpoints callable with an API key or an OAuth access token to the scope each
+// needs, an empty scope means the endpoint is closed to that kind of credential. Anything not listed,
+// such as managing API keys, sessions or consents, needs a logged in user. The API key funds scope has
+// no endpoints yet.
+var routeScopes = []struct {
+	method string
+	// path is matched exactly, or as a prefix when it ends with a slash
+	path        string
+	apiKeyScope string
+	oauthScope  string
+}{
+	{http.MethodGet, "/api/v1/holdings", auth.ScopeRead, auth.ScopeHoldingsRead},
+	{http.MethodGet, "/api/v1/positions", auth.ScopeRead, auth.ScopePositionsRead},
+	{http.MethodGet, "/api/v1/orderbook", auth.ScopeRead, ""},
+	{http.MethodPost, "/api/v1/holdings", auth.ScopeTrade, auth.ScopeOrdersWrite},
+	{http.MethodPatch, "/api/v1/holdings/", auth.ScopeTrade, auth.ScopeOrdersWrite},
+	{http.MethodDelete, "/api/v1/holdings/", auth.ScopeTrade, auth.ScopeOrdersWrite},
+}
+
+// routeScope returns the API key and OAuth scopes needed to call the endpoint, false when it is not listed
+func routeScope(method, path string) (string, string, bool) {
+	for _, route := range routeScopes {
+		if route.method != method {
+			continue
+		}
+		if path == route.path || (strings.HasSuffix(route.path, "/") && strings.HasPrefix(path, route.path)) {
+			return route.apiKeyScope, route.oauthScope, true
+		}
+	}
+	return "", "", false
+}
+
+// hasScope reports whether a credential granted scopes may call an endpoint needing scope
+func hasScope(scopes []string, scope string) bool {
+	return scope != "" && slices.Contains(scopes, scope)
+}
+
+// apiKeyAuth authenticates a request signed with an API key instead of a Bearer token
+func apiKeyAuth(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+
+	clientIP := utils.ClientIP(r, config.AppConfigInstance.GeneralConfig.TrustedProxyHops)
+	key, err := auth.AuthenticateAPIKey(r.Context(), w, r, clientIP)
+	switch {
+	case errors.Is(err, auth.ErrInvalidAPIKey):
+		interceptor.SendError(w, r, interceptor.ErrInvalidAPIKey)
+		return
+	case errors.Is(err, auth.ErrAPIKeyIPNotAllowed):
+		interceptor.SendError(w, r, interceptor.ErrAPIKeyIPNotAllowed)
+		return
+	case errors.Is(err, auth.ErrAPIKeyBodyTooLarge):
+		interceptor.SendError(w, r, interceptor.ErrBadRequest.Wrap(err))
+		return
+	case err != nil:
+		interceptor.SendError(w, r, interceptor.ErrAPIKeys.Wrap(fmt.Errorf("failed to authenticate api key: %w", err)))
+		return
+	}
+
+	scope, _, _ := routeScope(r.Method, r.URL.Path)
+	if !hasScope(key.Scopes, scope) {
+		interceptor.SendError(w, r, interceptor.ErrAPIKeyScope)
+		return
+	}
+
+	log := requestLogger(r, "user_id", key.UserID.String(), "key_id", key.KeyID)
+	ctx := context.WithValue(r.Context(), "userId", key.UserID.String())
+	ctx = logger.WithContext(ctx, log)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+
+	log.Info("api key request", "method", r.Method, "path", r.URL.Path, "latency", time.Since(start))
+}
+
+// requestLogger returns the request's logger, which already carries the request id, with the
+// authenticated identity added. The handlers below log through it.
+func requestLogger(r *http.Request, keyvals ...interface{}) *logger.Logger {
+	return logger.FromContext(r.Context()).With(keyvals...)
+}
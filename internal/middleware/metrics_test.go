@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prajwalbharadwajbm/broker/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRoutePattern(t *testing.T) {
+	router := httprouter.New()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandlerFunc(http.MethodGet, "/api/v1/orderbook", noop)
+	router.HandlerFunc(http.MethodPatch, "/api/v1/holdings/:id", noop)
+	router.HandlerFunc(http.MethodDelete, "/api/v1/oauth/consents/:client_id", noop)
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/api/v1/orderbook", "/api/v1/orderbook"},
+		{http.MethodPatch, "/api/v1/holdings/6f1c2b8e-4d3a-4e5f-9a7b-1c2d3e4f5a6b", "/api/v1/holdings/:id"},
+		{http.MethodDelete, "/api/v1/oauth/consents/app_123", "/api/v1/oauth/consents/:client_id"},
+		{http.MethodGet, "/api/v1/holdings/6f1c2b8e", unmatchedRoute},
+		{http.MethodGet, "/wp-login.php", unmatchedRoute},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := routePattern(router, r); got != tt.want {
+			t.Errorf("routePattern(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPatch, "/api/v1/holdings/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := MetricsMiddleware(router, router)
+
+	counter := metrics.HTTPRequests.WithLabelValues(http.MethodPatch, "/api/v1/holdings/:id", "404")
+	before := testutil.ToFloat64(counter)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/api/v1/holdings/h1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/api/v1/holdings/h2", nil))
+
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("Expected 2 requests counted under the route pattern, got %v", got)
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/ratelimit"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// Groups of public authentication routes, each group has its own bucket per client IP so that
+// e.g. refreshing tokens does not use up the logins of a client
+const (
+	RouteGroupSignup        = "signup"
+	RouteGroupLogin         = "login"
+	RouteGroupTwoFactor     = "2fa"
+	RouteGroupPasswordReset = "password_reset"
+	RouteGroupEmailVerify   = "email_verify"
+	RouteGroupRefresh       = "refresh"
+)
+
+// maxClientIDLength bounds the client_id used as a bucket key, longer ones are limited by IP
+const maxClientIDLength = 128
+
+// IPRateLimitMiddleware limits a group of public authentication routes per client IP with the auth limit
+func IPRateLimitMiddleware(group string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ip := utils.ClientIP(r, config.AppConfigInstance.GeneralConfig.TrustedProxyHops)
+			rateLimit(w, r, next, "auth:"+group+":ip:"+ip, config.AppConfigInstance.RateLimits.Auth)
+		}
+	}
+}
+
+// OAuthClientRateLimitMiddleware limits the OAuth endpoints called by third-party apps per client_id with the
+// oauth limit, so apps behind a shared egress IP do not limit each other. Requests without a client_id are
+// limited per client IP.
+func OAuthClientRateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := "oauth:ip:" + utils.ClientIP(r, config.AppConfigInstance.GeneralConfig.TrustedProxyHops)
+		if clientID := oauthClientID(r); clientID != "" && len(clientID) <= maxClientIDLength {
+			key = "oauth:client:" + clientID
+		}
+		rateLimit(w, r, next, key, config.AppConfigInstance.RateLimits.OAuth)
+	}
+}
+
+// oauthClientID returns the client_id of an OAuth request from HTTP Basic authentication or the form body,
+// a malformed body is left for the handler to reject
+func oauthClientID(r *http.Request) string {
+	if clientID, _, ok := r.BasicAuth(); ok {
+		return clientID
+	}
+	if err := r.ParseForm(); err != nil {
+		return ""
+	}
+	return r.PostForm.Get("client_id")
+}
+
+// UserRateLimitMiddleware limits authenticated routes per user with the api limit,
+// it must be wrapped by AuthMiddleware
+func UserRateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := r.Context().Value("userId").(string)
+		rateLimit(w, r, next, "api:user:"+userId, config.AppConfigInstance.RateLimits.API)
+	}
+}
+
+// rateLimit takes a token from the bucket of key, setting the X-RateLimit-* headers, and
+// responds with 429 when the bucket is empty. Requests are let through if the store fails.
+func rateLimit(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, key string, limit config.RateLimit) {
+	if !config.AppConfigInstance.RateLimits.Enabled {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	result, err := ratelimit.Default.Take(r.Context(), key, ratelimit.Limit{PerMinute: limit.PerMinute, Burst: limit.Burst})
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Rate limit check failed, allowing request", err, "key", key)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+
+	if !result.Allowed {
+		logger.FromContext(r.Context()).Warn("rate limited", "method", r.Method, "path", r.URL.Path, "key", key)
+		interceptor.SetRetryAfter(w, result.RetryAfter)
+		interceptor.SendError(w, r, interceptor.ErrTooManyRequests)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/ratelimit"
+)
+
+func TestRateLimitBuckets(t *testing.T) {
+	limits := config.AppConfigInstance.RateLimits
+	defer func() {
+		config.AppConfigInstance.RateLimits = limits
+		ratelimit.Default = ratelimit.NewMemoryStore()
+	}()
+	config.AppConfigInstance.RateLimits.Enabled = true
+	config.AppConfigInstance.RateLimits.Auth = config.RateLimit{PerMinute: 1, Burst: 1}
+	config.AppConfigInstance.RateLimits.OAuth = config.RateLimit{PerMinute: 1, Burst: 1}
+	ratelimit.Default = ratelimit.NewMemoryStore()
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	serve := func(handler http.HandlerFunc, r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	oauthRequest := func(clientID string) *http.Request {
+		form := url.Values{"grant_type": {"refresh_token"}, "client_id": {clientID}}
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	t.Run("RouteGroupsHaveTheirOwnBucket", func(t *testing.T) {
+		login := IPRateLimitMiddleware(RouteGroupLogin)(ok)
+		refresh := IPRateLimitMiddleware(RouteGroupRefresh)(ok)
+
+		if code := serve(refresh, httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)); code != http.StatusOK {
+			t.Fatalf("Expected first refresh to pass, got %d", code)
+		}
+		if code := serve(refresh, httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)); code != http.StatusTooManyRequests {
+			t.Errorf("Expected second refresh to be limited, got %d", code)
+		}
+		if code := serve(login, httptest.NewRequest(http.MethodPost, "/api/v1/users/login", nil)); code != http.StatusOK {
+			t.Errorf("Expected login to have its own bucket, got %d", code)
+		}
+	})
+
+	t.Run("OAuthLimitedPerClient", func(t *testing.T) {
+		handler := OAuthClientRateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			if r.PostForm.Get("grant_type") != "refresh_token" {
+				t.Error("Expected the form to stay readable by the handler")
+			}
+		})
+
+		if code := serve(handler, oauthRequest("tax-app")); code != http.StatusOK {
+			t.Fatalf("Expected first request of the client to pass, got %d", code)
+		}
+		if code := serve(handler, oauthRequest("tax-app")); code != http.StatusTooManyRequests {
+			t.Errorf("Expected second request of the client to be limited, got %d", code)
+		}
+		if code := serve(handler, oauthRequest("portfolio-app")); code != http.StatusOK {
+			t.Errorf("Expected another client from the same IP to pass, got %d", code)
+		}
+	})
+}
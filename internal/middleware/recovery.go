@@ -14,16 +14,17 @@ func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				logger.Log.Error(
+				log := logger.FromContext(r.Context())
+				log.Error(
 					fmt.Sprintf("Panic recovered: %v", err),
 					fmt.Errorf("panic: %v", err),
 				)
 
 				// Log the stack trace for debugging
-				logger.Log.Error("Stack trace", fmt.Errorf("%s", debug.Stack()))
+				log.Error("Stack trace", fmt.Errorf("%s", debug.Stack()))
 
 				// Send error response to client
-				interceptor.SendErrorResponse(w, "BPB500", http.StatusInternalServerError)
+				interceptor.SendError(w, r, interceptor.ErrInternal)
 			}
 		}()
 
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the id correlating a request's log lines, audit events, DB queries and error response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds a client supplied request id, longer ones are replaced
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware accepts the client's X-Request-ID or generates one, echoes it in the response and
+// stores it in the context under "requestId" along with a logger that adds it to every line
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestId) {
+			requestId = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestId)
+
+		ctx := context.WithValue(r.Context(), "requestId", requestId)
+		keyvals := []interface{}{"request_id", requestId}
+		// the trace started by the tracing middleware, lines and spans of a request can be joined either way
+		if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+			span.SetAttributes(attribute.String("request.id", requestId))
+			keyvals = append(keyvals, "trace_id", span.SpanContext().TraceID().String())
+		}
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).With(keyvals...))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID only accepts ids made of letters, digits and . _ - so a client cannot inject
+// into log lines or the SQL comment tagging the request's queries
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
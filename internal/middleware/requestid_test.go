@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitializeGlobalLogger("fatal", logger.FormatConsole, "test", "middleware-test")
+	os.Exit(m.Run())
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{"AcceptsClientID", "order-7f3a.retry_2", true},
+		{"GeneratesWhenMissing", "", false},
+		{"ReplacesCommentInjection", "x */ DROP TABLE users; /*", false},
+		{"ReplacesOverlongID", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen, _ = r.Context().Value("requestId").(string)
+			}))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/orderbook", nil)
+			if tt.header != "" {
+				r.Header.Set(RequestIDHeader, tt.header)
+			}
+			handler.ServeHTTP(w, r)
+
+			echoed := w.Header().Get(RequestIDHeader)
+			if seen == "" || echoed != seen {
+				t.Fatalf("Expected the context id %q to be echoed, got %q", seen, echoed)
+			}
+			if (seen == tt.header) != tt.wantSame {
+				t.Errorf("Request id %q for header %q, want client id kept: %v", seen, tt.header, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+)
+
+// RequireRoles allows only users with one of the roles through, it must be wrapped by AuthMiddleware.
+// The role is the one in the access token, changing a role revokes the user's access tokens so the
+// next refresh picks up the new one. API keys and OAuth tokens carry no role and never pass.
+func RequireRoles(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value("role").(string)
+			if !slices.Contains(roles, role) {
+				logger.FromContext(r.Context()).Warn("access denied", "role", role, "method", r.Method, "path", r.URL.Path)
+				interceptor.SendError(w, r, interceptor.ErrAccessDenied)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/api/v1/holdings/:id", func(w http.ResponseWriter, r *http.Request) {})
+	handler := TracingMiddleware(router, RequestIDMiddleware(router))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/holdings/h1", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "GET /api/v1/holdings/:id" {
+		t.Fatalf("Expected one span named after the route pattern, got %+v", spans)
+	}
+	attributes := map[string]string{}
+	for _, attribute := range spans[0].Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	if attributes["http.route"] != "/api/v1/holdings/:id" || attributes["request.id"] != w.Header().Get(RequestIDHeader) {
+		t.Errorf("Expected route and request id attributes, got %v", attributes)
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+)
+
+// VerifiedEmailMiddleware allows only users with a verified email address through, it must be
+// wrapped by AuthMiddleware. The flag is read from the database on every request so verifying
+// takes effect without a new access token.
+func VerifiedEmailMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := r.Context().Value("userId").(string)
+		userUUID, err := uuid.Parse(userId)
+		if err != nil {
+			interceptor.SendError(w, r, interceptor.ErrInternal.Wrap(fmt.Errorf("failed to parse user ID: %w", err)))
+			return
+		}
+
+		verified, err := repository.IsEmailVerified(r.Context(), userUUID)
+		if err != nil {
+			interceptor.SendError(w, r, interceptor.ErrInternal.Wrap(fmt.Errorf("failed to check email verification: %w", err)))
+			return
+		}
+		if !verified {
+			interceptor.SendError(w, r, interceptor.ErrEmailNotVerified)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests can be made at once and the bucket
+// refills at PerMinute requests per minute
+type Limit struct {
+	PerMinute int
+	Burst     int
+}
+
+// refillRate returns the tokens added per second
+func (l Limit) refillRate() float64 {
+	return float64(l.PerMinute) / 60
+}
+
+// Result is the outcome of taking a token, used for the X-RateLimit-* headers
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request is allowed, zero when Allowed
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Store keeps the token buckets. The in-memory store limits each instance on its own,
+// a shared store (e.g. Redis) is needed to enforce limits across replicas.
+type Store interface {
+	// Take takes a token from the bucket of key, creating a full bucket for unknown keys
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// MemoryStore keeps buckets in the process, only suitable for a single instance
+const MemoryStore = "memory"
+
+// Default is the store used by the rate limiting middleware, set by Initialize
+var Default Store = NewMemoryStore()
+
+// Initialize selects the store by name
+func Initialize(kind string) error {
+	switch kind {
+	case MemoryStore:
+		Default = NewMemoryStore()
+	default:
+		return fmt.Errorf("unknown rate limit store %q", kind)
+	}
+	return nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// refill adds the tokens earned since the last request, up to the burst
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.refillRate())
+		b.last = now
+	}
+}
+
+// sweepInterval is how often idle buckets are dropped from the memory store
+const sweepInterval = time.Minute
+
+// memoryStore is an in-process Store, buckets that have refilled completely are
+// dropped since a new full bucket behaves the same
+type memoryStore struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns an empty in-memory Store
+func NewMemoryStore() Store {
+	return &memoryStore{
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Burst), last: now, limit: limit}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+
+	result := Result{Limit: limit.Burst}
+	rate := limit.refillRate()
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else if rate > 0 {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	} else {
+		result.RetryAfter = time.Duration(math.MaxInt64)
+	}
+	result.Remaining = int(b.tokens)
+	if rate > 0 {
+		result.ResetAfter = seconds((float64(limit.Burst) - b.tokens) / rate)
+	}
+	return result, nil
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestStore(now *time.Time) *memoryStore {
+	store := NewMemoryStore().(*memoryStore)
+	store.now = func() time.Time { return *now }
+	return store
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{PerMinute: 60, Burst: 3}
+
+	t.Run("MemoryStore_Burst", func(t *testing.T) {
+		now := time.Now()
+		store := newTestStore(&now)
+
+		for i := 2; i >= 0; i-- {
+			result, err := store.Take(ctx, "ip:203.0.113.7", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Allowed || result.Remaining != i || result.Limit != 3 {
+				t.Fatalf("Expected allowed with %d remaining, got %+v", i, result)
+			}
+		}
+
+		result, _ := store.Take(ctx, "ip:203.0.113.7", limit)
+		if result.Allowed {
+			t.Fatal("Expected the request over the burst to be throttled")
+		}
+		if result.RetryAfter != time.Second || result.ResetAfter != 3*time.Second {
+			t.Errorf("Expected retry after 1s and reset after 3s, got %+v", result)
+		}
+
+		// other keys have their own bucket
+		if result, _ := store.Take(ctx, "ip:198.51.100.1", limit); !result.Allowed {
+			t.Error("Expected another key to be allowed")
+		}
+	})
+
+	t.Run("MemoryStore_Refill", func(t *testing.T) {
+		now := time.Now()
+		store := newTestStore(&now)
+
+		for i := 0; i < 3; i++ {
+			store.Take(ctx, "user:1", limit)
+		}
+		now = now.Add(1500 * time.Millisecond)
+
+		if result, _ := store.Take(ctx, "user:1", limit); !result.Allowed {
+			t.Error("Expected a refilled token after 1.5s")
+		}
+		if result, _ := store.Take(ctx, "user:1", limit); result.Allowed {
+			t.Error("Expected only one token to have refilled")
+		}
+	})
+
+	t.Run("MemoryStore_SweepsFullBuckets", func(t *testing.T) {
+		now := time.Now()
+		store := newTestStore(&now)
+
+		store.Take(ctx, "user:1", limit)
+		now = now.Add(2 * sweepInterval)
+		store.Take(ctx, "user:2", limit)
+
+		if _, ok := store.buckets["user:1"]; ok {
+			t.Error("Expected the refilled bucket to be swept")
+		}
+		if _, ok := store.buckets["user:2"]; !ok {
+			t.Error("Expected the bucket in use to be kept")
+		}
+	})
+}
+
+func TestInitialize(t *testing.T) {
+	defer func() { Default = NewMemoryStore() }()
+
+	if err := Initialize("redis"); err == nil {
+		t.Error("Expected an error for an unknown store")
+	}
+	if err := Initialize(MemoryStore); err != nil {
+		t.Errorf("Initialize() error = %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionLogin               = "login"
+	ActionLoginTwoFactor      = "login.2fa"
+	ActionTokenRefresh        = "token.refresh"
+	ActionTokenRevoke         = "token.revoke"
+	ActionSessionRevoke       = "session.revoke"
+	ActionSessionRevokeAll    = "session.revoke_all"
+	ActionPasswordChange      = "password.change"
+	ActionPasswordReset       = "password.reset"
+	ActionAPIKeyCreate        = "api_key.create"
+	ActionAPIKeyRevoke        = "api_key.revoke"
+	ActionOAuthToken          = "oauth.token"
+	ActionOAuthConsentRevoke  = "oauth.consent_revoke"
+	ActionHoldingAdd          = "holding.add"
+	ActionHoldingUpdate       = "holding.update"
+	ActionHoldingSell         = "holding.sell"
+	ActionHoldingDelete       = "holding.delete"
+	ActionUserUnlock          = "user.unlock"
+	ActionUserFreeze          = "user.freeze"
+	ActionUserUnfreeze        = "user.unfreeze"
+	ActionUserRole            = "user.role"
+	ActionImpersonate         = "user.impersonate"
+	ActionImpersonatedAccess  = "impersonation.request"
+	ActionOAuthClientCreate   = "oauth_client.create"
+	ActionCircuitBreakerReset = "circuit_breaker.reset"
+)
+
+// Event is an action to record. The actor, IP, user agent and request id are taken from the request.
+type Event struct {
+	Action string
+	// UserID is the account acted on, the authenticated user when empty
+	UserID   string
+	Resource string
+	// Before and After are the resource around a change, marshalled to JSON
+	Before any
+	After  any
+	// Err marks the action as failed and is recorded in After, by its code for catalogued errors and by its
+	// message otherwise, so it must not carry internal details
+	Err error
+}
+
+// verifyBatch is how many events VerifyChain reads at a time
+const verifyBatch = 1000
+
+// Column sizes of audit_events, request values are cut to fit so an oversized one cannot fail the insert
+const (
+	maxResourceLength  = 255
+	maxUserAgentLength = 512
+	maxRequestIDLength = 128
+)
+
+// Record appends the event to the audit log. The append is synchronous so the event is stored before the
+// response is sent, but a failure is only logged: the action it describes has already happened.
+func Record(r *http.Request, e Event) {
+	event, err := newAuditEvent(r, e, time.Now())
+	if err == nil {
+		err = repository.AppendAuditEvent(r.Context(), event)
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Failed to record audit event", err, "action", e.Action, "audit_user_id", e.UserID)
+	}
+}
+
+// newAuditEvent builds the row of an event made during the request
+func newAuditEvent(r *http.Request, e Event, now time.Time) (*models.AuditEvent, error) {
+	ctx := r.Context()
+	// set by the request id middleware from X-Request-ID
+	requestId, _ := ctx.Value("requestId").(string)
+	event := &models.AuditEvent{
+		// the database keeps microseconds, the hash must cover the time as it is stored
+		OccurredAt: now.UTC().Truncate(time.Microsecond),
+		Action:     e.Action,
+		Resource:   truncate(e.Resource, maxResourceLength),
+		IP:         clientIP(r),
+		UserAgent:  truncate(r.UserAgent(), maxUserAgentLength),
+		RequestID:  truncate(requestId, maxRequestIDLength),
+		Outcome:    models.OutcomeSuccess,
+	}
+
+	userID := e.UserID
+	if userID == "" {
+		userID, _ = ctx.Value("userId").(string)
+	}
+	event.UserID = parseID(userID)
+
+	// the staff member acting through an impersonation token or on another account, otherwise the user
+	actorID, _ := ctx.Value("actorId").(string)
+	if actorID == "" {
+		actorID, _ = ctx.Value("userId").(string)
+	}
+	if actorID == "" {
+		actorID = userID
+	}
+	event.ActorID = parseID(actorID)
+
+	var err error
+	if event.Before, err = marshalPayload(e.Before); err != nil {
+		return nil, err
+	}
+	after := e.After
+	if e.Err != nil {
+		event.Outcome = models.OutcomeFailure
+		after = map[string]string{"error": errorCode(e.Err)}
+	}
+	if event.After, err = marshalPayload(after); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// clientIP returns the client address of the request, or empty when RemoteAddr is not an address
+func clientIP(r *http.Request) string {
+	addr, err := netip.ParseAddr(utils.ClientIP(r, config.AppConfigInstance.GeneralConfig.TrustedProxyHops))
+	if err != nil {
+		return ""
+	}
+	return addr.WithZone("").String()
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func parseID(id string) *uuid.UUID {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+func marshalPayload(payload any) (json.RawMessage, error) {
+	if payload == nil {
+		return nil, nil
+	}
+	return json.Marshal(payload)
+}
+
+// errorCode returns the code of a catalogued error, or the message of any other
+func errorCode(err error) string {
+	var apiErr *interceptor.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return err.Error()
+}
+
+// Verification is the result of checking the audit hash chain
+type Verification struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// BrokenAt is the id of the first event whose hash does not match, set when the chain is not valid
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+}
+
+// VerifyChain recomputes the hash of every audit event in order and reports the first one that was changed,
+// or whose predecessor was changed or removed
+func VerifyChain(ctx context.Context) (*Verification, error) {
+	result := &Verification{Valid: true}
+	prevHash := models.GenesisAuditHash
+	var lastID int64
+
+	for {
+		events, err := repository.GetAuditEventsAfter(ctx, lastID, verifyBatch)
+		if err != nil {
+			return nil, err
+		}
+
+		checked, brokenAt, err := verifyEvents(prevHash, events)
+		result.Checked += checked
+		if err != nil {
+			return nil, err
+		}
+		if brokenAt != nil {
+			result.Valid = false
+			result.BrokenAt = brokenAt
+			return result, nil
+		}
+		if len(events) < verifyBatch {
+			return result, nil
+		}
+
+		last := events[len(events)-1]
+		prevHash, lastID = last.Hash, last.ID
+	}
+}
+
+// verifyEvents checks that consecutive events chain on from prevHash, returning how many were checked
+// and the id of the first broken one
+func verifyEvents(prevHash string, events []models.AuditEvent) (int, *int64, error) {
+	for i := range events {
+		event := &events[i]
+		hash, err := event.ComputeHash()
+		if err != nil {
+			return i, nil, err
+		}
+		if event.PrevHash != prevHash || event.Hash != hash {
+			return i + 1, &event.ID, nil
+		}
+		prevHash = event.Hash
+	}
+	return len(events), nil, nil
+}
@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/interceptor"
+)
+
+const (
+	userID  = "6f1c2b8e-4d3a-4e5f-9a7b-1c2d3e4f5a6b"
+	staffID = "0a9b8c7d-6e5f-4a3b-8c1d-2e3f4a5b6c7d"
+)
+
+func TestNewAuditEvent(t *testing.T) {
+	now := time.Date(2025, 7, 1, 10, 0, 0, 123456789, time.FixedZone("IST", 19800))
+
+	t.Run("AuthenticatedUser", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/api/v1/holdings", nil)
+		r.Header.Set("User-Agent", "test-agent")
+		ctx := context.WithValue(r.Context(), "userId", userID)
+		r = r.WithContext(context.WithValue(ctx, "requestId", "req-1"))
+
+		event, err := newAuditEvent(r, Event{Action: ActionHoldingAdd, Resource: "holding-1", After: map[string]int{"quantity": 10}}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.UserID == nil || event.UserID.String() != userID || event.ActorID == nil || event.ActorID.String() != userID {
+			t.Errorf("Expected user and actor %s, got %v and %v", userID, event.UserID, event.ActorID)
+		}
+		if !event.OccurredAt.Equal(now.Truncate(time.Microsecond)) || event.OccurredAt.Location() != time.UTC {
+			t.Errorf("Expected occurred_at in UTC truncated to microseconds, got %v", event.OccurredAt)
+		}
+		if event.Outcome != models.OutcomeSuccess || string(event.After) != `{"quantity":10}` || event.Before != nil {
+			t.Errorf("Unexpected outcome %s or payloads %s, %s", event.Outcome, event.Before, event.After)
+		}
+		if event.UserAgent != "test-agent" || event.RequestID != "req-1" || event.IP == "" {
+			t.Errorf("Expected request metadata, got %q, %q, %q", event.UserAgent, event.RequestID, event.IP)
+		}
+	})
+
+	t.Run("StaffActingOnUser", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/api/v1/admin/users/"+userID+"/freeze", nil)
+		r = r.WithContext(context.WithValue(r.Context(), "userId", staffID))
+
+		event, _ := newAuditEvent(r, Event{Action: ActionUserFreeze, UserID: userID}, now)
+		if event.UserID.String() != userID || event.ActorID.String() != staffID {
+			t.Errorf("Expected staff %s acting on %s, got %v on %v", staffID, userID, event.ActorID, event.UserID)
+		}
+	})
+
+	t.Run("Impersonation", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/api/v1/holdings", nil)
+		ctx := context.WithValue(r.Context(), "userId", userID)
+		r = r.WithContext(context.WithValue(ctx, "actorId", staffID))
+
+		event, _ := newAuditEvent(r, Event{Action: ActionImpersonatedAccess}, now)
+		if event.UserID.String() != userID || event.ActorID.String() != staffID {
+			t.Errorf("Expected staff %s acting as %s, got %v as %v", staffID, userID, event.ActorID, event.UserID)
+		}
+	})
+
+	t.Run("OversizedRequestValues", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/api/v1/holdings", nil)
+		r.RemoteAddr = "not-an-address"
+		r.Header.Set("User-Agent", strings.Repeat("a", 1000))
+		r = r.WithContext(context.WithValue(r.Context(), "requestId", strings.Repeat("r", 200)))
+
+		event, err := newAuditEvent(r, Event{Action: ActionLogin, Resource: strings.Repeat("é", 300)}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if utf8.RuneCountInString(event.Resource) != maxResourceLength || len(event.UserAgent) != maxUserAgentLength ||
+			len(event.RequestID) != maxRequestIDLength {
+			t.Errorf("Expected values cut to the column sizes, got %d, %d, %d",
+				utf8.RuneCountInString(event.Resource), len(event.UserAgent), len(event.RequestID))
+		}
+		if event.IP != "" {
+			t.Errorf("Expected an invalid address to be dropped, got %q", event.IP)
+		}
+	})
+
+	t.Run("FailedAnonymousAction", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/api/v1/users/login", nil)
+
+		event, _ := newAuditEvent(r, Event{Action: ActionLogin, Resource: "trader@example.com", Err: interceptor.ErrInvalidCredentials.Wrap(context.Canceled)}, now)
+		if event.UserID != nil || event.ActorID != nil {
+			t.Errorf("Expected no identities, got %v and %v", event.UserID, event.ActorID)
+		}
+		if event.Outcome != models.OutcomeFailure || string(event.After) != `{"error":"`+interceptor.ErrInvalidCredentials.Code+`"}` {
+			t.Errorf("Expected failure with error code, got %s %s", event.Outcome, event.After)
+		}
+	})
+}
+
+func TestVerifyEvents(t *testing.T) {
+	chain := func() []models.AuditEvent {
+		events := make([]models.AuditEvent, 3)
+		prevHash := models.GenesisAuditHash
+		for i := range events {
+			events[i] = models.AuditEvent{
+				ID:         int64(i + 1),
+				OccurredAt: time.Date(2025, 7, 1, 10, i, 0, 0, time.UTC),
+				Action:     ActionHoldingUpdate,
+				Outcome:    models.OutcomeSuccess,
+				After:      json.RawMessage(`{"quantity":10}`),
+				PrevHash:   prevHash,
+			}
+			events[i].Hash, _ = events[i].ComputeHash()
+			prevHash = events[i].Hash
+		}
+		return events
+	}
+
+	if checked, brokenAt, _ := verifyEvents(models.GenesisAuditHash, chain()); brokenAt != nil || checked != 3 {
+		t.Errorf("Expected intact chain of 3, got %d checked and broken at %v", checked, brokenAt)
+	}
+
+	tampered := chain()
+	tampered[1].After = json.RawMessage(`{"quantity":1000}`)
+	if _, brokenAt, _ := verifyEvents(models.GenesisAuditHash, tampered); brokenAt == nil || *brokenAt != 2 {
+		t.Errorf("Expected changed payload to break the chain at 2, got %v", brokenAt)
+	}
+
+	removed := chain()
+	removed = append(removed[:1], removed[2:]...)
+	if _, brokenAt, _ := verifyEvents(models.GenesisAuditHash, removed); brokenAt == nil || *brokenAt != 3 {
+		t.Errorf("Expected removed event to break the chain at 3, got %v", brokenAt)
+	}
+
+	rehashed := chain()
+	rehashed[0].Resource = "other"
+	rehashed[0].Hash, _ = rehashed[0].ComputeHash()
+	if _, brokenAt, _ := verifyEvents(models.GenesisAuditHash, rehashed); brokenAt == nil || *brokenAt != 2 {
+		t.Errorf("Expected rehashed event to break the link to the next one at 2, got %v", brokenAt)
+	}
+}
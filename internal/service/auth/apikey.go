@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// API key scopes, a key can only call the endpoints of the scopes it was granted
+const (
+	ScopeRead  = "read"
+	ScopeTrade = "trade"
+	ScopeFunds = "funds"
+)
+
+// Headers of an API key signed request
+const (
+	APIKeyHeader          = "X-API-Key"
+	APIKeyTimestampHeader = "X-API-Timestamp"
+	APIKeySignatureHeader = "X-API-Signature"
+)
+
+const (
+	apiKeyPrefix = "bpk_"
+	// APIKeySignatureWindow is how far the request timestamp may be from the server clock,
+	// it bounds how long a captured request can be replayed
+	APIKeySignatureWindow = 5 * time.Minute
+)
+
+var (
+	// ErrInvalidAPIKey covers unknown, revoked and expired keys, stale timestamps and bad signatures
+	// alike so callers cannot tell which part was wrong
+	ErrInvalidAPIKey = errors.New("invalid api key or request signature")
+	// ErrAPIKeyIPNotAllowed is returned when the request IP is outside the key's allowlist
+	ErrAPIKeyIPNotAllowed = errors.New("request ip not allowed for api key")
+)
+
+// GenerateAPIKey returns a new public key id and the secret shown once to the user
+func GenerateAPIKey() (string, string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(id), hex.EncodeToString(secret), nil
+}
+
+// maxSignedBodyBytes bounds the body of an API key request, it is buffered whole to check the signature
+const maxSignedBodyBytes = 64 << 10
+
+// ErrAPIKeyBodyTooLarge is returned when a signed request body exceeds maxSignedBodyBytes
+var ErrAPIKeyBodyTooLarge = errors.New("api key request body too large")
+
+// APIKeySigningKey derives the HMAC key requests are signed with from the secret, the hex SHA-256 of the
+// secret. The server derives it from the secret it decrypts, neither is stored in the clear.
+func APIKeySigningKey(secret string) string {
+	return utils.HashToken(secret, "")
+}
+
+// canonicalRequest is the string that is signed: the method, the path with its query string,
+// the unix timestamp and the hex SHA-256 of the body, separated by newlines
+func canonicalRequest(method, requestURI, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{method, requestURI, timestamp, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+// SignRequest returns the hex HMAC-SHA256 signature of a request, keyed with APIKeySigningKey of the secret
+func SignRequest(signingKey, method, requestURI, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(canonicalRequest(method, requestURI, timestamp, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature checks the timestamp is within APIKeySignatureWindow of now and the signature
+// matches, comparing in constant time
+func verifySignature(signingKey, method, requestURI, timestamp, signature string, body []byte, now time.Time) bool {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := now.Sub(time.Unix(unix, 0))
+	if skew > APIKeySignatureWindow || skew < -APIKeySignatureWindow {
+		return false
+	}
+
+	given, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(SignRequest(signingKey, method, requestURI, timestamp, body))
+	return hmac.Equal(given, expected)
+}
+
+// IPAllowed reports whether ip matches an address or CIDR range of the allowlist, an empty allowlist allows any IP
+func IPAllowed(allowlist []string, ip string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, entry := range allowlist {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if allowed, err := netip.ParseAddr(entry); err == nil && allowed.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateAPIKey verifies the API key signature headers of the request sent from clientIP and
+// returns the key. The body is read for the signature, only once the key is known and up to
+// maxSignedBodyBytes, and put back for the handler.
+func AuthenticateAPIKey(ctx context.Context, w http.ResponseWriter, r *http.Request, clientIP string) (*models.APIKey, error) {
+	if !APIKeysEnabled() {
+		return nil, ErrAPIKeysDisabled
+	}
+
+	key, err := repository.GetAPIKeyByKeyID(ctx, r.Header.Get(APIKeyHeader))
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, ErrAPIKeyBodyTooLarge
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	secret, err := decryptAPIKeySecret(key.KeyID, key.SecretCiphertext)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySignature(APIKeySigningKey(secret), r.Method, r.URL.RequestURI(), r.Header.Get(APIKeyTimestampHeader),
+		r.Header.Get(APIKeySignatureHeader), body, now) {
+		return nil, ErrInvalidAPIKey
+	}
+	// checked after the signature so the allowlist cannot be probed without the secret
+	if !IPAllowed(key.IPAllowlist, clientIP) {
+		logger.FromContext(ctx).Infof("Security event: API key %s of user %s used from IP %s outside its allowlist", key.KeyID, key.UserID, clientIP)
+		return nil, ErrAPIKeyIPNotAllowed
+	}
+
+	if err := repository.TouchAPIKey(ctx, key.ID); err != nil {
+		logger.FromContext(ctx).Error("failed to record API key use", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+)
+
+// ErrAPIKeysDisabled is returned when no API_KEY_ENCRYPTION_KEY is configured, keys can then
+// neither be created nor used
+var ErrAPIKeysDisabled = errors.New("api keys are disabled, API_KEY_ENCRYPTION_KEY is not configured")
+
+// apiKeySecretAEAD encrypts API key secrets at rest, nil while API keys are disabled
+var apiKeySecretAEAD cipher.AEAD
+
+// InitializeAPIKeyEncryption loads the AES-256 key API key secrets are encrypted with, the base64 of
+// 32 random bytes. It is kept outside the database so a copy of the api_keys table or a backup
+// cannot sign requests. An empty key leaves API keys disabled.
+func InitializeAPIKeyEncryption(encodedKey string) error {
+	apiKeySecretAEAD = nil
+	if encodedKey == "" {
+		return nil
+	}
+
+	aead, err := newSecretAEAD("API_KEY_ENCRYPTION_KEY", encodedKey)
+	if err != nil {
+		return err
+	}
+	apiKeySecretAEAD = aead
+	return nil
+}
+
+// APIKeysEnabled reports whether an encryption key is configured
+func APIKeysEnabled() bool {
+	return apiKeySecretAEAD != nil
+}
+
+// EncryptAPIKeySecret seals the secret of the key with AES-256-GCM, returning the nonce followed by
+// the ciphertext. The key id is authenticated with it so a ciphertext cannot be moved to another key.
+func EncryptAPIKeySecret(keyID, secret string) ([]byte, error) {
+	if apiKeySecretAEAD == nil {
+		return nil, ErrAPIKeysDisabled
+	}
+	return sealSecret(apiKeySecretAEAD, keyID, secret)
+}
+
+// decryptAPIKeySecret opens a secret sealed by EncryptAPIKeySecret for the key
+func decryptAPIKeySecret(keyID string, sealed []byte) (string, error) {
+	if apiKeySecretAEAD == nil {
+		return "", ErrAPIKeysDisabled
+	}
+	secret, err := openSecret(apiKeySecretAEAD, keyID, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt api key secret: %w", err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	keyID, secret, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(keyID, "bpk_") || len(keyID) != 20 {
+		t.Errorf("Unexpected key id %q", keyID)
+	}
+	if len(secret) != 64 {
+		t.Errorf("Expected 64 hex character secret, got %q", secret)
+	}
+
+	otherID, otherSecret, _ := GenerateAPIKey()
+	if otherID == keyID || otherSecret == secret {
+		t.Error("Expected every generated key to be unique")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	signingKey := APIKeySigningKey("secret")
+	now := time.Unix(1751360000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"symbol":"INFY","quantity":10}`)
+	signature := SignRequest(signingKey, "POST", "/api/v1/holdings", timestamp, body)
+
+	if !verifySignature(signingKey, "POST", "/api/v1/holdings", timestamp, signature, body, now) {
+		t.Error("Expected valid signature to be accepted")
+	}
+	if !verifySignature(signingKey, "POST", "/api/v1/holdings", timestamp, strings.ToUpper(signature), body, now.Add(4*time.Minute)) {
+		t.Error("Expected upper case signature within the window to be accepted")
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		method    string
+		uri       string
+		timestamp string
+		signature string
+		body      []byte
+		now       time.Time
+	}{
+		{"wrong key", APIKeySigningKey("other"), "POST", "/api/v1/holdings", timestamp, signature, body, now},
+		{"wrong method", signingKey, "PATCH", "/api/v1/holdings", timestamp, signature, body, now},
+		{"wrong path", signingKey, "POST", "/api/v1/holdings?x=1", timestamp, signature, body, now},
+		{"tampered body", signingKey, "POST", "/api/v1/holdings", timestamp, signature, []byte(`{"symbol":"INFY","quantity":100}`), now},
+		{"stale timestamp", signingKey, "POST", "/api/v1/holdings", timestamp, signature, body, now.Add(6 * time.Minute)},
+		{"future timestamp", signingKey, "POST", "/api/v1/holdings", timestamp, signature, body, now.Add(-6 * time.Minute)},
+		{"invalid timestamp", signingKey, "POST", "/api/v1/holdings", "yesterday", signature, body, now},
+		{"invalid signature", signingKey, "POST", "/api/v1/holdings", timestamp, "not hex", body, now},
+	}
+	for _, tt := range tests {
+		if verifySignature(tt.key, tt.method, tt.uri, tt.timestamp, tt.signature, tt.body, tt.now) {
+			t.Errorf("%s: expected signature to be rejected", tt.name)
+		}
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	allowlist := []string{"203.0.113.7", "198.51.100.0/24", "2001:db8::/32"}
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"203.0.113.7", true},
+		{"203.0.113.8", false},
+		{"198.51.100.200", true},
+		{"::ffff:198.51.100.1", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"not an ip", false},
+	}
+	for _, tt := range tests {
+		if got := IPAllowed(allowlist, tt.ip); got != tt.allowed {
+			t.Errorf("IPAllowed(%s) = %v, want %v", tt.ip, got, tt.allowed)
+		}
+	}
+	if !IPAllowed(nil, "192.0.2.1") {
+		t.Error("Expected empty allowlist to allow any IP")
+	}
+}
+
+func TestAPIKeySecretEncryption(t *testing.T) {
+	defer InitializeAPIKeyEncryption("")
+
+	if _, err := EncryptAPIKeySecret("bpk_1", "secret"); !errors.Is(err, ErrAPIKeysDisabled) {
+		t.Fatalf("Expected API keys to be disabled without a key, got %v", err)
+	}
+	if err := InitializeAPIKeyEncryption(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Fatal("Expected a key that is not 32 bytes to be rejected")
+	}
+	if err := InitializeAPIKeyEncryption(base64.StdEncoding.EncodeToString(make([]byte, 32))); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := EncryptAPIKeySecret("bpk_1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sealed), "secret") || strings.Contains(string(sealed), APIKeySigningKey("secret")) {
+		t.Error("Expected neither the secret nor the signing key in the stored value")
+	}
+	if secret, err := decryptAPIKeySecret("bpk_1", sealed); err != nil || secret != "secret" {
+		t.Errorf("Expected the secret back, got %q, %v", secret, err)
+	}
+	if _, err := decryptAPIKeySecret("bpk_2", sealed); err == nil {
+		t.Error("Expected a ciphertext moved to another key to fail")
+	}
+
+	InitializeAPIKeyEncryption(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if _, err := decryptAPIKeySecret("bpk_1", sealed); err == nil {
+		t.Error("Expected decryption with another encryption key to fail")
+	}
+}
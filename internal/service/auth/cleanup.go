@@ -6,9 +6,11 @@ import (
 
 	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
 	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/metrics"
 )
 
 // StartTokenCleanupService starts a background goroutine to periodically clean up expired refresh tokens
+// and access token revocations, mailed user tokens and OAuth authorization codes
 func StartTokenCleanupService(ctx context.Context) {
 	ticker := time.NewTicker(24 * time.Hour) // Run cleanup once per day TODO: make it configurable
 	defer ticker.Stop()
@@ -18,7 +20,7 @@ func StartTokenCleanupService(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Log.Info("Token cleanup service stopped")
+			logger.FromContext(ctx).Info("Token cleanup service stopped")
 			return
 		case <-ticker.C:
 			cleanupExpiredTokens(ctx)
@@ -28,13 +30,30 @@ func StartTokenCleanupService(ctx context.Context) {
 
 // cleanupExpiredTokens removes expired refresh tokens from the database
 func cleanupExpiredTokens(ctx context.Context) {
-	logger.Log.Info("Starting cleanup of expired refresh tokens")
+	logger.FromContext(ctx).Info("Starting cleanup of expired refresh tokens")
 
-	err := repository.CleanupExpiredTokens(ctx)
-	if err != nil {
-		logger.Log.Error("Failed to cleanup expired refresh tokens", err)
+	if !runCleanup(ctx, "refresh_tokens", repository.CleanupExpiredTokens(ctx)) {
+		return
+	}
+	if !runCleanup(ctx, "access_token_revocations", repository.CleanupExpiredAccessTokenRevocations(ctx)) {
+		return
+	}
+	if !runCleanup(ctx, "user_tokens", repository.CleanupExpiredUserTokens(ctx)) {
 		return
 	}
+	runCleanup(ctx, "authorization_codes", repository.CleanupExpiredAuthorizationCodes(ctx))
+}
+
+// runCleanup logs and records the result of cleaning up table, reporting whether it succeeded
+func runCleanup(ctx context.Context, table string, err error) bool {
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to cleanup expired "+table, err)
+		metrics.TokenCleanupRuns.WithLabelValues(table, metrics.ResultFailure).Inc()
+		return false
+	}
 
-	logger.Log.Info("Successfully cleaned up expired refresh tokens")
+	logger.FromContext(ctx).Info("Successfully cleaned up expired " + table)
+	metrics.TokenCleanupRuns.WithLabelValues(table, metrics.ResultSuccess).Inc()
+	metrics.TokenCleanupLastSuccess.WithLabelValues(table).SetToCurrentTime()
+	return true
 }
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+)
+
+const (
+	// EmailVerificationTTL is how long an email verification link stays valid
+	EmailVerificationTTL = 24 * time.Hour
+	// VerificationResendInterval is the minimum time between two verification emails to the same user
+	VerificationResendInterval = time.Minute
+)
+
+// IssueEmailVerificationToken creates a single use email verification token for the user,
+// earlier verification tokens of the user stop working
+func IssueEmailVerificationToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	return issueUserToken(ctx, userID, repository.PurposeEmailVerification, EmailVerificationTTL)
+}
+
+// VerificationResendWait returns how long the user has to wait before another verification
+// email may be sent, zero when one can be sent now
+func VerificationResendWait(ctx context.Context, userID uuid.UUID) (time.Duration, error) {
+	lastSent, err := repository.GetLastUserTokenTime(ctx, userID, repository.PurposeEmailVerification)
+	if err != nil || lastSent == nil {
+		return 0, err
+	}
+	return max(VerificationResendInterval-time.Since(*lastSent), 0), nil
+}
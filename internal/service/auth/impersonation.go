@@ -0,0 +1,22 @@
+package auth
+
+import "time"
+
+// ImpersonationTokenTTL is how long an impersonation token stays valid, it must not exceed AccessTokenTTL
+// so revoking the actor's access tokens covers every impersonation token they hold
+const ImpersonationTokenTTL = 5 * time.Minute
+
+// GenerateImpersonationToken creates a read-only access token for the user on behalf of the staff member
+// actorID. It carries no role, so it never reaches admin endpoints, and cannot be refreshed.
+func GenerateImpersonationToken(userID, actorID string) (string, error) {
+	return generateAccessToken(&Claims{UserID: userID, Actor: &Actor{Subject: actorID}}, ImpersonationTokenTTL)
+}
+
+// ReadOnlyMethod reports whether the HTTP method only reads, the methods impersonation tokens may use
+func ReadOnlyMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+)
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	config.AppConfigInstance.JWTSecret = "test-secret"
+
+	token, err := GenerateImpersonationToken("user-1", "staff-1")
+	if err != nil {
+		t.Fatalf("Expected token, got %v", err)
+	}
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+
+	if claims.UserID != "user-1" || claims.Actor == nil || claims.Actor.Subject != "staff-1" {
+		t.Errorf("Expected user-1 impersonated by staff-1, got %s by %+v", claims.UserID, claims.Actor)
+	}
+	if claims.Role != "" {
+		t.Errorf("Expected no role, got %q", claims.Role)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != ImpersonationTokenTTL {
+		t.Errorf("Expected %v validity, got %v", ImpersonationTokenTTL, ttl)
+	}
+}
+
+func TestImpersonationTokenRevokedWithActor(t *testing.T) {
+	config.AppConfigInstance.JWTSecret = "test-secret"
+	ctx := context.Background()
+	Revocations = NewMemoryStore()
+	defer func() { Revocations = NewMemoryStore() }()
+
+	token, _ := GenerateImpersonationToken("user-1", "staff-1")
+	claims, _ := ValidateToken(token)
+	if revoked, _ := IsAccessTokenRevoked(ctx, claims); revoked {
+		t.Fatal("Expected fresh impersonation token to be allowed")
+	}
+
+	// revocation times are inclusive, revoke a second later so the token issued this second matches
+	Revocations.RevokeUserTokens(ctx, "staff-1", time.Now().Add(time.Second))
+	if revoked, _ := IsAccessTokenRevoked(ctx, claims); !revoked {
+		t.Error("Expected impersonation token to be revoked with the actor's tokens")
+	}
+}
+
+func TestReadOnlyMethod(t *testing.T) {
+	for _, method := range []string{"GET", "HEAD", "OPTIONS"} {
+		if !ReadOnlyMethod(method) {
+			t.Errorf("Expected %s to be read-only", method)
+		}
+	}
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		if ReadOnlyMethod(method) {
+			t.Errorf("Expected %s to write", method)
+		}
+	}
+}
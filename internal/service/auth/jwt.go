@@ -4,33 +4,71 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/prajwalbharadwajbm/broker/internal/config"
 )
 
+// AccessTokenTTL is how long an access token stays valid
+const AccessTokenTTL = 10 * time.Minute
+
+func init() {
+	// iat is compared with the time a user's tokens were revoked, whole seconds would deny a token
+	// issued in the same second right after the revocation (e.g. the login following a password change)
+	jwt.TimePrecision = time.Microsecond
+}
+
+// Claims are the claims of an access token, RegisteredClaims.ID carries the jti used to revoke it
 type Claims struct {
 	UserID string `json:"user_id"`
+	// Role is the role of the user when the token was issued, tokens of OAuth clients carry none
+	Role string `json:"role,omitempty"`
+	// ClientID and Scope are set on tokens issued to OAuth clients, which may only call the endpoints
+	// of their space separated scopes. First-party tokens have neither and full access.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Actor is set on impersonation tokens, the staff member acting as the user (RFC 8693 section 4.1)
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor identifies who acts on behalf of the token's user
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
 
-func GenerateToken(userId string) (string, error) {
-	// Access tokens should have a 10-minute validity.
-	expirationTime := time.Now().Add(10 * time.Minute)
-
-	claims := &Claims{
-		UserID: userId,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "broker-platform",
-		},
+// GenerateToken creates a first-party access token for the user with the role
+func GenerateToken(userId, role string) (string, error) {
+	return generateAccessToken(&Claims{UserID: userId, Role: role}, AccessTokenTTL)
+}
+
+// generateAccessToken sets the registered claims of an access token valid for ttl and signs it
+func generateAccessToken(claims *Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Issuer:    "broker-platform",
+		ID:        uuid.NewString(),
+	}
+
+	return signToken(claims)
+}
+
+// signToken signs claims with the active key of the key ring, or with
+// HS256 and JWT_SECRET when no key ring is configured
+func signToken(claims jwt.Claims) (string, error) {
+	if keyRing != nil {
+		return keyRing.sign(claims)
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -40,16 +78,12 @@ func GenerateToken(userId string) (string, error) {
 		return "", errors.New("JWT secret not configured")
 	}
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		return "", err
-	}
-	return tokenString, nil
+	return token.SignedString([]byte(jwtSecret))
 }
 
 // GenerateTokenPair creates both access and refresh tokens
-func GenerateTokenPair(userId string) (*TokenPair, error) {
-	accessToken, err := GenerateToken(userId)
+func GenerateTokenPair(userId, role string) (*TokenPair, error) {
+	accessToken, err := GenerateToken(userId, role)
 	if err != nil {
 		return nil, err
 	}
@@ -82,8 +116,25 @@ func GetRefreshTokenExpiration() time.Time {
 
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
+	if err := parseToken(tokenString, claims); err != nil {
+		return nil, err
+	}
+	// other tokens signed with the same keys, like two-factor challenges, carry no user_id
+	if claims.UserID == "" {
+		return nil, errors.New("not an access token")
+	}
+	return claims, nil
+}
 
+// parseToken verifies the signature of a token into claims. Tokens with a kid are verified with that
+// key of the key ring, tokens without one with JWT_SECRET, so HS256 tokens issued before switching
+// to asymmetric keys keep working until they expire as long as the secret stays configured.
+func parseToken(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Header["kid"]; ok && keyRing != nil {
+			return keyRing.verificationKey(token)
+		}
+
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
@@ -94,13 +145,22 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		}
 
 		return []byte(jwtSecret), nil
-	})
+	}, opts...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if !token.Valid {
-		return nil, errors.New("invalid token")
+		return errors.New("invalid token")
 	}
-	return claims, nil
+	return nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header value
+func BearerToken(authHeader string) (string, bool) {
+	token, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok || token == "" || strings.Contains(token, " ") {
+		return "", false
+	}
+	return token, true
 }
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+)
+
+func TestGenerateToken(t *testing.T) {
+	config.AppConfigInstance.JWTSecret = "test-secret"
+
+	first, err := GenerateToken("user-1", "support")
+	if err != nil {
+		t.Fatalf("Expected token, got %v", err)
+	}
+	second, _ := GenerateToken("user-1", "trader")
+
+	firstClaims, err := ValidateToken(first)
+	if err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+	secondClaims, _ := ValidateToken(second)
+
+	if firstClaims.UserID != "user-1" {
+		t.Errorf("Expected user-1, got %s", firstClaims.UserID)
+	}
+	if firstClaims.Role != "support" {
+		t.Errorf("Expected role support, got %q", firstClaims.Role)
+	}
+	if firstClaims.ID == "" || firstClaims.ID == secondClaims.ID {
+		t.Errorf("Expected a unique jti per token, got %q and %q", firstClaims.ID, secondClaims.ID)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer abc.def.ghi", "abc.def.ghi", true},
+		{"Bearer ", "", false},
+		{"bearer abc", "", false},
+		{"Basic abc", "", false},
+		{"Bearer abc def", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		token, ok := BearerToken(tt.header)
+		if token != tt.token || ok != tt.ok {
+			t.Errorf("BearerToken(%q) = %q, %v, want %q, %v", tt.header, token, ok, tt.token, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is an asymmetric key identified by its kid. Retired keys only
+// have a public key, they keep verifying tokens until those expire.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeyRing holds the keys used to sign and verify access tokens, tokens are signed with
+// the active key and verified with the key named by their kid header
+type KeyRing struct {
+	keys   map[string]*signingKey
+	active *signingKey
+}
+
+// keyRing is nil when tokens are signed with the shared HS256 JWT_SECRET
+var keyRing *KeyRing
+
+// InitializeKeyRing switches token signing to the RS256/ES256 keys in dir.
+// An empty dir keeps HS256 signing with JWT_SECRET.
+func InitializeKeyRing(dir, activeKeyID string) error {
+	if dir == "" {
+		keyRing = nil
+		return nil
+	}
+	ring, err := LoadKeyRing(dir, activeKeyID)
+	if err != nil {
+		return err
+	}
+	keyRing = ring
+	return nil
+}
+
+// LoadKeyRing loads every <kid>.pem file in dir. A file holds either a private key (PKCS#1, PKCS#8
+// or SEC 1) that can sign, or only a PKIX public key for a retired key that still verifies.
+// RSA keys sign with RS256 and P-256 keys with ES256. activeKeyID names the signing key and may
+// be left empty when there is a single private key.
+func LoadKeyRing(dir, activeKeyID string) (*KeyRing, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &KeyRing{keys: map[string]*signingKey{}}
+	var signers []string
+	for _, file := range files {
+		key, err := loadSigningKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load signing key %s: %w", file, err)
+		}
+		ring.keys[key.id] = key
+		if key.private != nil {
+			signers = append(signers, key.id)
+		}
+	}
+
+	if activeKeyID == "" && len(signers) == 1 {
+		activeKeyID = signers[0]
+	}
+	active, ok := ring.keys[activeKeyID]
+	if !ok || active.private == nil {
+		return nil, fmt.Errorf("active signing key %q has no private key in %s", activeKeyID, dir)
+	}
+	ring.active = active
+	return ring, nil
+}
+
+func loadSigningKey(file string) (*signingKey, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &signingKey{id: strings.TrimSuffix(filepath.Base(file), ".pem")}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key.private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if signer, ok := parsed.(crypto.Signer); ok {
+			key.private = signer
+		}
+	case "PUBLIC KEY":
+		key.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.private != nil {
+		key.public = key.private.Public()
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 EC keys are supported")
+		}
+		key.method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.public)
+	}
+	return key, nil
+}
+
+// sign signs the claims with the active key, setting the kid header
+func (ring *KeyRing) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ring.active.method, claims)
+	token.Header["kid"] = ring.active.id
+	return token.SignedString(ring.active.private)
+}
+
+// verificationKey returns the public key for the token's kid, rejecting tokens
+// whose algorithm does not match the key so a public key is never used as an HMAC secret
+func (ring *KeyRing) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ring.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// JSONWebKey is a public key in JWK format (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys that verify access tokens, it is empty when
+// tokens are signed with the shared HS256 secret
+func JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if keyRing == nil {
+		return set
+	}
+
+	ids := make([]string, 0, len(keyRing.keys))
+	for id := range keyRing.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := keyRing.keys[id]
+		jwk := JSONWebKey{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64URL(public.N.Bytes())
+			jwk.E = base64URL(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			// uncompressed point encoding is 0x04 || X || Y with 32 byte coordinates for P-256
+			point, err := public.ECDH()
+			if err != nil {
+				continue
+			}
+			encoded := point.Bytes()
+			jwk.KeyType = "EC"
+			jwk.Curve = "P-256"
+			jwk.X = base64URL(encoded[1:33])
+			jwk.Y = base64URL(encoded[33:])
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+)
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	content := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newKeyDir writes an RSA key "rsa-2025", a P-256 key "ec-2025" and the public half of a
+// retired RSA key "rsa-2024", returning the directory and the retired private key
+func newKeyDir(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+	dir := t.TempDir()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writePEM(t, dir, "rsa-2025", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	writePEM(t, dir, "ec-2025", "PRIVATE KEY", ecDER)
+
+	retired, _ := rsa.GenerateKey(rand.Reader, 2048)
+	retiredDER, _ := x509.MarshalPKIXPublicKey(&retired.PublicKey)
+	writePEM(t, dir, "rsa-2024", "PUBLIC KEY", retiredDER)
+
+	return dir, retired
+}
+
+func TestKeyRing(t *testing.T) {
+	dir, retired := newKeyDir(t)
+	defer InitializeKeyRing("", "")
+
+	for _, activeKeyID := range []string{"rsa-2025", "ec-2025"} {
+		t.Run("KeyRing_SignAndVerify_"+activeKeyID, func(t *testing.T) {
+			if err := InitializeKeyRing(dir, activeKeyID); err != nil {
+				t.Fatalf("Expected key ring, got %v", err)
+			}
+
+			tokenString, err := GenerateToken("user-1", "trader")
+			if err != nil {
+				t.Fatalf("Expected token, got %v", err)
+			}
+			token, _, _ := jwt.NewParser().ParseUnverified(tokenString, &Claims{})
+			if token.Header["kid"] != activeKeyID {
+				t.Errorf("Expected kid %s, got %v", activeKeyID, token.Header["kid"])
+			}
+
+			claims, err := ValidateToken(tokenString)
+			if err != nil || claims.UserID != "user-1" {
+				t.Errorf("Expected valid token for user-1, got %v %v", claims, err)
+			}
+		})
+	}
+
+	t.Run("KeyRing_RetiredKeyStillVerifies", func(t *testing.T) {
+		InitializeKeyRing(dir, "rsa-2025")
+
+		claims := &Claims{UserID: "user-2", RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "rsa-2024"
+		tokenString, _ := token.SignedString(retired)
+
+		if _, err := ValidateToken(tokenString); err != nil {
+			t.Errorf("Expected token of retired key to verify, got %v", err)
+		}
+	})
+
+	t.Run("KeyRing_RejectsUnknownKid", func(t *testing.T) {
+		InitializeKeyRing(dir, "rsa-2025")
+
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{UserID: "user-3"})
+		token.Header["kid"] = "rsa-unknown"
+		tokenString, _ := token.SignedString(other)
+
+		if _, err := ValidateToken(tokenString); err == nil {
+			t.Error("Expected token with unknown kid to be rejected")
+		}
+	})
+
+	t.Run("KeyRing_RejectsAlgorithmConfusion", func(t *testing.T) {
+		InitializeKeyRing(dir, "rsa-2025")
+
+		// an HS256 token keyed with the published public key must not verify
+		publicDER, _ := x509.MarshalPKIXPublicKey(keyRing.keys["rsa-2025"].public)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "user-4"})
+		token.Header["kid"] = "rsa-2025"
+		tokenString, _ := token.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+
+		if _, err := ValidateToken(tokenString); err == nil {
+			t.Error("Expected HS256 token with an RSA kid to be rejected")
+		}
+	})
+
+	t.Run("KeyRing_LegacyHS256TokensVerifyWithSecret", func(t *testing.T) {
+		InitializeKeyRing("", "")
+		config.AppConfigInstance.JWTSecret = "test-secret"
+		legacy, _ := GenerateToken("user-5", "trader")
+
+		InitializeKeyRing(dir, "rsa-2025")
+		if _, err := ValidateToken(legacy); err != nil {
+			t.Errorf("Expected HS256 token to verify during rotation, got %v", err)
+		}
+
+		config.AppConfigInstance.JWTSecret = ""
+		if _, err := ValidateToken(legacy); err == nil {
+			t.Error("Expected HS256 token to be rejected once the secret is removed")
+		}
+	})
+}
+
+func TestLoadKeyRingRequiresActiveSigningKey(t *testing.T) {
+	dir, _ := newKeyDir(t)
+
+	if _, err := LoadKeyRing(dir, ""); err == nil {
+		t.Error("Expected error when several private keys exist and none is active")
+	}
+	if _, err := LoadKeyRing(dir, "rsa-2024"); err == nil {
+		t.Error("Expected error when the active key has no private key")
+	}
+	if _, err := LoadKeyRing(dir, "missing"); err == nil {
+		t.Error("Expected error for unknown active key")
+	}
+
+	os.Remove(filepath.Join(dir, "ec-2025.pem"))
+	ring, err := LoadKeyRing(dir, "")
+	if err != nil || ring.active.id != "rsa-2025" {
+		t.Errorf("Expected the single private key to be active, got %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir, _ := newKeyDir(t)
+	defer InitializeKeyRing("", "")
+
+	InitializeKeyRing("", "")
+	if keys := JWKS().Keys; len(keys) != 0 {
+		t.Errorf("Expected no keys with HS256 signing, got %d", len(keys))
+	}
+
+	InitializeKeyRing(dir, "ec-2025")
+	keys := JWKS().Keys
+	if len(keys) != 3 {
+		t.Fatalf("Expected 3 keys, got %d", len(keys))
+	}
+
+	byID := map[string]JSONWebKey{}
+	for _, key := range keys {
+		byID[key.KeyID] = key
+	}
+	if key := byID["ec-2025"]; key.KeyType != "EC" || key.Algorithm != "ES256" || key.Curve != "P-256" || len(key.X) != 43 || len(key.Y) != 43 {
+		t.Errorf("Unexpected EC key %+v", key)
+	}
+	if key := byID["rsa-2024"]; key.KeyType != "RSA" || key.Algorithm != "RS256" || key.E != "AQAB" || key.N == "" {
+		t.Errorf("Unexpected RSA key %+v", key)
+	}
+}
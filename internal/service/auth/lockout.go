@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+)
+
+// LoginWait returns how long the user has to wait before the next password attempt: until a
+// lock expires, or an exponential back-off after failed attempts. locked tells which one applies.
+func LoginWait(user *models.User, now time.Time) (wait time.Duration, locked bool) {
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return user.LockedUntil.Sub(now), true
+	}
+	if user.LastFailedLoginAt == nil {
+		return 0, false
+	}
+	cfg := config.AppConfigInstance.LoginProtection
+	delay := backoffDelay(user.FailedLoginAttempts, cfg.BackoffBase, cfg.BackoffMax)
+	return max(user.LastFailedLoginAt.Add(delay).Sub(now), 0), false
+}
+
+// backoffDelay is base after the first failure, doubling with each further one up to limit
+func backoffDelay(failedAttempts int, base, limit time.Duration) time.Duration {
+	if failedAttempts <= 0 || base <= 0 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < failedAttempts && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// RecordFailedLogin counts a wrong password for the user and returns the lock expiry
+// when the configured number of failures was reached
+func RecordFailedLogin(ctx context.Context, userID uuid.UUID) (*time.Time, error) {
+	cfg := config.AppConfigInstance.LoginProtection
+	return repository.RecordFailedLogin(ctx, userID, cfg.MaxFailedAttempts, cfg.LockoutDuration)
+}
+
+// ipLoginFailures counts failed logins per client IP in memory, it stops a single client from
+// guessing passwords across many accounts. Each instance counts on its own.
+var ipLoginFailures = newLoginFailureTracker()
+
+// LoginIPWait returns how long logins from the IP are blocked, zero when they are allowed
+func LoginIPWait(ip string, now time.Time) time.Duration {
+	cfg := config.AppConfigInstance.LoginProtection
+	return ipLoginFailures.wait(ip, cfg.MaxFailedAttemptsPerIP, now)
+}
+
+// RecordLoginIPFailure counts a failed login, wrong password or unknown email, from the IP
+func RecordLoginIPFailure(ip string, now time.Time) {
+	ipLoginFailures.record(ip, config.AppConfigInstance.LoginProtection.IPWindow, now)
+}
+
+type loginFailures struct {
+	count     int
+	windowEnd time.Time
+}
+
+// failureSweepInterval is how often finished windows are dropped from a loginFailureTracker
+const failureSweepInterval = time.Minute
+
+// loginFailureTracker counts failures per key within a fixed window starting at the first failure
+type loginFailureTracker struct {
+	mu        sync.Mutex
+	entries   map[string]*loginFailures
+	lastSweep time.Time
+}
+
+func newLoginFailureTracker() *loginFailureTracker {
+	return &loginFailureTracker{entries: map[string]*loginFailures{}}
+}
+
+// record counts a failure for key and returns the number of failures in its current window
+func (t *loginFailureTracker) record(key string, window time.Duration, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+
+	// a finished window may not have been swept yet
+	entry, ok := t.entries[key]
+	if !ok || !now.Before(entry.windowEnd) {
+		entry = &loginFailures{windowEnd: now.Add(window)}
+		t.entries[key] = entry
+	}
+	entry.count++
+	return entry.count
+}
+
+// sweep drops finished windows so the map only holds recent failures, at most once per failureSweepInterval
+func (t *loginFailureTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < failureSweepInterval {
+		return
+	}
+	t.lastSweep = now
+	for key, entry := range t.entries {
+		if !now.Before(entry.windowEnd) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+func (t *loginFailureTracker) wait(key string, limit int, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok || limit <= 0 || entry.count < limit || !now.Before(entry.windowEnd) {
+		return 0
+	}
+	return entry.windowEnd.Sub(now)
+}
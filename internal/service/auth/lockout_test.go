@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	testCases := []struct {
+		failedAttempts int
+		expected       time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, 30 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		if got := backoffDelay(tc.failedAttempts, time.Second, 30*time.Second); got != tc.expected {
+			t.Errorf("backoffDelay(%d) = %v, expected %v", tc.failedAttempts, got, tc.expected)
+		}
+	}
+}
+
+func TestLoginWait(t *testing.T) {
+	config.AppConfigInstance.LoginProtection = config.LoginProtection{BackoffBase: time.Second, BackoffMax: time.Minute}
+	now := time.Now()
+
+	t.Run("LoginWait_Locked", func(t *testing.T) {
+		lockedUntil := now.Add(10 * time.Minute)
+		wait, locked := LoginWait(&models.User{LockedUntil: &lockedUntil}, now)
+		if !locked || wait != 10*time.Minute {
+			t.Errorf("Expected a 10m lock, got %v locked=%v", wait, locked)
+		}
+	})
+
+	t.Run("LoginWait_Backoff", func(t *testing.T) {
+		lastFailed := now.Add(-time.Second)
+		wait, locked := LoginWait(&models.User{FailedLoginAttempts: 3, LastFailedLoginAt: &lastFailed}, now)
+		if locked || wait != 3*time.Second {
+			t.Errorf("Expected 3s of back-off left, got %v locked=%v", wait, locked)
+		}
+	})
+
+	t.Run("LoginWait_ExpiredLock", func(t *testing.T) {
+		lockedUntil := now.Add(-time.Minute)
+		wait, locked := LoginWait(&models.User{LockedUntil: &lockedUntil, LastFailedLoginAt: &lockedUntil}, now)
+		if locked || wait != 0 {
+			t.Errorf("Expected no wait after the lock expired, got %v locked=%v", wait, locked)
+		}
+	})
+}
+
+func TestLoginFailureTracker(t *testing.T) {
+	tracker := newLoginFailureTracker()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if wait := tracker.wait("203.0.113.7", 3, now); wait != 0 {
+			t.Fatalf("Expected no block after %d failures, got %v", i, wait)
+		}
+		tracker.record("203.0.113.7", 15*time.Minute, now.Add(time.Duration(i)*time.Minute))
+	}
+
+	if wait := tracker.wait("203.0.113.7", 3, now.Add(5*time.Minute)); wait != 10*time.Minute {
+		t.Errorf("Expected the IP blocked until the window ends, got %v", wait)
+	}
+	if wait := tracker.wait("198.51.100.1", 3, now); wait != 0 {
+		t.Errorf("Expected other IPs not to be blocked, got %v", wait)
+	}
+	if wait := tracker.wait("203.0.113.7", 3, now.Add(15*time.Minute)); wait != 0 {
+		t.Errorf("Expected the block to end with the window, got %v", wait)
+	}
+
+	tracker.record("198.51.100.1", 15*time.Minute, now.Add(20*time.Minute))
+	if _, ok := tracker.entries["203.0.113.7"]; ok {
+		t.Error("Expected the finished window to be swept")
+	}
+
+	// within the sweep interval a finished window is not swept but starts over on the next failure
+	tracker.record("192.0.2.1", time.Second, now.Add(20*time.Minute))
+	if count := tracker.record("192.0.2.1", time.Second, now.Add(20*time.Minute+2*time.Second)); count != 1 {
+		t.Errorf("Expected a new window after the previous one finished, got %d failures", count)
+	}
+}
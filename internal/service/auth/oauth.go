@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// OAuth scopes third-party apps can ask users for
+const (
+	ScopeHoldingsRead  = "holdings:read"
+	ScopePositionsRead = "positions:read"
+	ScopeOrdersWrite   = "orders:write"
+)
+
+const (
+	// AuthorizationCodeTTL is how long the client has to exchange an authorization code
+	AuthorizationCodeTTL = 5 * time.Minute
+	oauthClientPrefix    = "bpc_"
+)
+
+var (
+	// ErrInvalidClient is returned for an unknown client id or a wrong client secret
+	ErrInvalidClient = errors.New("invalid oauth client credentials")
+	// ErrInvalidGrant is returned for an invalid, expired or reused authorization code or refresh token,
+	// or a redirect URI or PKCE verifier that does not match the authorization request
+	ErrInvalidGrant = errors.New("invalid oauth grant")
+	// ErrInvalidScope is returned when no scope is requested or one the client may not ask for
+	ErrInvalidScope = errors.New("invalid oauth scope")
+)
+
+// OAuthTokens is the token response of the OAuth token endpoint (RFC 6749 section 5.1)
+type OAuthTokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	// UserID is the user who granted the tokens, not part of the response
+	UserID string `json:"-"`
+}
+
+// Introspection is the token introspection response (RFC 7662), only Active is set for inactive tokens
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// GenerateOAuthClientCredentials returns a new client id, and a secret for confidential clients
+func GenerateOAuthClientCredentials(confidential bool) (string, string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	clientID := oauthClientPrefix + hex.EncodeToString(id)
+	if !confidential {
+		return clientID, "", nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	return clientID, hex.EncodeToString(secret), nil
+}
+
+// HashClientSecret returns the hash a client secret is stored and compared by
+func HashClientSecret(secret string) string {
+	return utils.HashToken(secret, "")
+}
+
+// AuthenticateOAuthClient returns the client with the id, checking the secret of confidential clients.
+// Public clients must not send a secret, they are bound to the flow by PKCE instead.
+func AuthenticateOAuthClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	client, err := repository.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Confidential() {
+		if clientSecret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(HashClientSecret(clientSecret)), []byte(*client.ClientSecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// ParseScope splits a space separated scope parameter into sorted unique scopes
+func ParseScope(scope string) []string {
+	scopes := strings.Fields(scope)
+	slices.Sort(scopes)
+	return slices.Compact(scopes)
+}
+
+// FormatScope joins scopes into a scope parameter
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// RequestedScopes parses the scope of an authorization request, every scope must be one the client may ask for
+func RequestedScopes(client *models.OAuthClient, scope string) ([]string, error) {
+	scopes := ParseScope(scope)
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	for _, s := range scopes {
+		if !slices.Contains(client.Scopes, s) {
+			return nil, ErrInvalidScope
+		}
+	}
+	return scopes, nil
+}
+
+// VerifyPKCE checks the code verifier against the S256 code challenge of the authorization request (RFC 7636)
+func VerifyPKCE(verifier, challenge string) bool {
+	// RFC 7636 section 4.1 allows 43 to 128 characters
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// IssueAuthorizationCode creates the single use code the client exchanges for tokens after the user consented
+func IssueAuthorizationCode(ctx context.Context, client *models.OAuthClient, userID uuid.UUID, redirectURI string, scopes []string, codeChallenge string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := hex.EncodeToString(random)
+
+	err := repository.CreateAuthorizationCode(ctx, models.OAuthAuthorizationCode{
+		CodeHash:      HashUserToken(code),
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scopes:        scopes,
+		CodeChallenge: codeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(AuthorizationCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeAuthorizationCode issues tokens for an authorization code of the client. The redirect URI must be
+// the one of the authorization request and the verifier must match its PKCE challenge.
+func ExchangeAuthorizationCode(ctx context.Context, client *models.OAuthClient, code, redirectURI, verifier string, info models.ClientInfo) (*OAuthTokens, error) {
+	familyID := uuid.New()
+	stored, err := repository.UseAuthorizationCode(ctx, HashUserToken(code), familyID, func(stored *models.OAuthAuthorizationCode) bool {
+		return stored.ClientID == client.ClientID && stored.RedirectURI == redirectURI && VerifyPKCE(verifier, stored.CodeChallenge)
+	})
+	if errors.Is(err, repository.ErrAuthorizationCodeReused) {
+		logger.FromContext(ctx).Infof("Security event: authorization code of client %s for user %s reused, revoked the tokens issued for it",
+			stored.ClientID, stored.UserID)
+		return nil, ErrInvalidGrant
+	}
+	if errors.Is(err, repository.ErrAuthorizationCodeInvalid) {
+		return nil, ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return issueOAuthTokens(ctx, client.ClientID, stored.UserID, stored.Scopes, familyID, info)
+}
+
+// RefreshOAuthTokens rotates a refresh token issued to the client, the new tokens keep the granted scopes
+func RefreshOAuthTokens(ctx context.Context, client *models.OAuthClient, refreshToken string, info models.ClientInfo) (*OAuthTokens, error) {
+	newRefreshToken, err := GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := repository.RotateRefreshToken(ctx, refreshToken, newRefreshToken, &client.ClientID, GetRefreshTokenExpiration(), info)
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		logger.FromContext(ctx).Infof("Security event: refresh token reuse detected for client %s, revoked token family %s of user_id: %s",
+			client.ClientID, rotated.FamilyID, rotated.UserID)
+		return nil, ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rotated == nil {
+		return nil, ErrInvalidGrant
+	}
+
+	accessToken, err := generateAccessToken(&Claims{
+		UserID:   rotated.UserID.String(),
+		ClientID: client.ClientID,
+		Scope:    FormatScope(rotated.Scopes),
+	}, AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthTokens{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		RefreshToken: newRefreshToken,
+		Scope:        FormatScope(rotated.Scopes),
+		UserID:       rotated.UserID.String(),
+	}, nil
+}
+
+// issueOAuthTokens issues an access token limited to the scopes and starts a refresh token family for the client
+func issueOAuthTokens(ctx context.Context, clientID string, userID uuid.UUID, scopes []string, familyID uuid.UUID, info models.ClientInfo) (*OAuthTokens, error) {
+	accessToken, err := generateAccessToken(&Claims{
+		UserID:   userID.String(),
+		ClientID: clientID,
+		Scope:    FormatScope(scopes),
+	}, AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = repository.CreateOAuthRefreshToken(ctx, userID, familyID, clientID, scopes, refreshToken, GetRefreshTokenExpiration(), info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &OAuthTokens{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        FormatScope(scopes),
+		UserID:       userID.String(),
+	}, nil
+}
+
+// IntrospectToken reports whether an access or refresh token issued to the client is active. Tokens of other
+// clients and first-party tokens are reported inactive, so a client learns nothing about them.
+func IntrospectToken(ctx context.Context, client *models.OAuthClient, token string) (*Introspection, error) {
+	inactive := &Introspection{Active: false}
+
+	if claims, err := ValidateToken(token); err == nil {
+		if claims.ClientID != client.ClientID {
+			return inactive, nil
+		}
+		revoked, err := IsAccessTokenRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return inactive, nil
+		}
+		consented, err := HasOAuthConsent(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if !consented {
+			return inactive, nil
+		}
+
+		return &Introspection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Subject:   claims.UserID,
+			TokenType: "Bearer",
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+		}, nil
+	}
+
+	refreshToken, err := repository.ValidateRefreshToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken == nil || refreshToken.ClientID == nil || *refreshToken.ClientID != client.ClientID {
+		return inactive, nil
+	}
+	return &Introspection{
+		Active:    true,
+		Scope:     FormatScope(refreshToken.Scopes),
+		ClientID:  client.ClientID,
+		Subject:   refreshToken.UserID.String(),
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+	}, nil
+}
+
+// HasOAuthConsent reports whether the user still consents to the OAuth client an access token was
+// issued to. Access tokens are not revoked with the consent, they stop working as soon as it is
+func HasOAuthConsent(ctx context.Context, claims *Claims) (bool, error) {
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return false, nil
+	}
+	_, err = repository.GetOAuthConsent(ctx, userID, claims.ClientID)
+	if errors.Is(err, repository.ErrOAuthConsentNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
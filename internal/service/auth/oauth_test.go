@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("Expected RFC 7636 verifier to match its challenge")
+	}
+	if VerifyPKCE(verifier[:42]+"x", challenge) {
+		t.Error("Expected wrong verifier to be rejected")
+	}
+	if VerifyPKCE(verifier, verifier) {
+		t.Error("Expected plain challenge to be rejected")
+	}
+	if VerifyPKCE("short", "ptpGVHgLKPdTfpbuYPbr21HkbGBGJEVdLp3gAmnU0uM") {
+		t.Error("Expected verifier shorter than 43 characters to be rejected")
+	}
+	if VerifyPKCE(strings.Repeat("a", 129), challenge) {
+		t.Error("Expected verifier longer than 128 characters to be rejected")
+	}
+}
+
+func TestRequestedScopes(t *testing.T) {
+	client := &models.OAuthClient{Scopes: []string{ScopeHoldingsRead, ScopePositionsRead}}
+
+	scopes, err := RequestedScopes(client, " positions:read holdings:read  positions:read ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scopes, []string{ScopeHoldingsRead, ScopePositionsRead}) {
+		t.Errorf("Expected sorted unique scopes, got %v", scopes)
+	}
+	if FormatScope(scopes) != "holdings:read positions:read" {
+		t.Errorf("Unexpected scope parameter %q", FormatScope(scopes))
+	}
+
+	if _, err := RequestedScopes(client, "holdings:read orders:write"); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected scope the client may not ask for to be rejected, got %v", err)
+	}
+	if _, err := RequestedScopes(client, " "); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected empty scope to be rejected, got %v", err)
+	}
+}
+
+func TestGenerateOAuthClientCredentials(t *testing.T) {
+	clientID, secret, err := GenerateOAuthClientCredentials(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(clientID, "bpc_") || len(clientID) != 20 || len(secret) != 64 {
+		t.Errorf("Unexpected confidential client credentials %q %q", clientID, secret)
+	}
+
+	clientID, secret, err = GenerateOAuthClientCredentials(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(clientID, "bpc_") || secret != "" {
+		t.Errorf("Expected public client without secret, got %q %q", clientID, secret)
+	}
+}
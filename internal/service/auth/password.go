@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+)
+
+// PasswordResetTTL is how long a password reset link stays valid
+const PasswordResetTTL = 30 * time.Minute
+
+// IssuePasswordResetToken creates a single use password reset token for the user,
+// earlier reset tokens of the user stop working
+func IssuePasswordResetToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	return issueUserToken(ctx, userID, repository.PurposePasswordReset, PasswordResetTTL)
+}
+
+// RevokeUserCredentials logs the user out everywhere by revoking every refresh token
+// and every access token issued so far, used when the password changes
+func RevokeUserCredentials(ctx context.Context, userID uuid.UUID) error {
+	if err := repository.RevokeAllUserRefreshTokens(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	if err := RevokeUserAccessTokens(ctx, userID.String()); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+)
+
+// RevocationStore denies access tokens before they expire. Tokens are revoked one by one by
+// their jti (e.g. on logout) or all at once for a user (e.g. on password change or account freeze).
+type RevocationStore interface {
+	// RevokeToken denies the access token with the jti until it expires at expiresAt
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeUserTokens denies every access token of the user issued at or before the given time
+	RevokeUserTokens(ctx context.Context, userID string, before time.Time) error
+	// IsRevoked reports whether the access token was revoked by either of the above
+	IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error)
+}
+
+const (
+	// MemoryRevocationStore keeps revocations in the process, only suitable for a single instance
+	MemoryRevocationStore = "memory"
+	// PostgresRevocationStore shares revocations between replicas through the database
+	PostgresRevocationStore = "postgres"
+)
+
+// Revocations is the store checked by the auth middleware, set by InitializeRevocationStore
+var Revocations RevocationStore = NewMemoryStore()
+
+// InitializeRevocationStore selects the revocation store by name
+func InitializeRevocationStore(kind string) error {
+	switch kind {
+	case MemoryRevocationStore:
+		Revocations = NewMemoryStore()
+	case PostgresRevocationStore:
+		Revocations = &postgresStore{}
+	default:
+		return fmt.Errorf("unknown access token revocation store %q", kind)
+	}
+	return nil
+}
+
+// RevokeAccessToken revokes a single access token, e.g. the one presented on logout
+func RevokeAccessToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		// tokens issued before jti was added can only be revoked per user
+		return Revocations.RevokeUserTokens(ctx, claims.UserID, revocationTime())
+	}
+	return Revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RevokeUserAccessTokens revokes every access token issued to the user so far
+func RevokeUserAccessTokens(ctx context.Context, userID string) error {
+	return Revocations.RevokeUserTokens(ctx, userID, revocationTime())
+}
+
+// revocationTime is now at the precision of iat, so tokens issued before it compare at or before it
+// and tokens issued after it compare after it
+func revocationTime() time.Time {
+	return time.Now().Truncate(jwt.TimePrecision)
+}
+
+// IsAccessTokenRevoked checks validated claims against the revocation store. Impersonation tokens are
+// also revoked with the access tokens of the staff member acting through them.
+func IsAccessTokenRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	revoked, err := Revocations.IsRevoked(ctx, claims.ID, claims.UserID, issuedAt)
+	if err != nil || revoked || claims.Actor == nil {
+		return revoked, err
+	}
+	return Revocations.IsRevoked(ctx, "", claims.Actor.Subject, issuedAt)
+}
+
+// memoryStore is an in-process RevocationStore, entries are dropped once
+// every token they can match has expired
+type memoryStore struct {
+	mu     sync.RWMutex
+	now    func() time.Time
+	tokens map[string]time.Time // jti to token expiry
+	users  map[string]time.Time // user id to revocation time
+}
+
+// NewMemoryStore returns an empty in-memory RevocationStore
+func NewMemoryStore() RevocationStore {
+	return &memoryStore{
+		now:    time.Now,
+		tokens: map[string]time.Time{},
+		users:  map[string]time.Time{},
+	}
+}
+
+func (s *memoryStore) RevokeToken(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *memoryStore) RevokeUserTokens(_ context.Context, userID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	if before.After(s.users[userID]) {
+		s.users[userID] = before
+	}
+	return nil
+}
+
+func (s *memoryStore) IsRevoked(_ context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if expiresAt, ok := s.tokens[jti]; ok && jti != "" && s.now().Before(expiresAt) {
+		return true, nil
+	}
+	before, ok := s.users[userID]
+	return ok && !issuedAt.After(before), nil
+}
+
+// sweep drops expired entries, revocations are rare so a full scan on write is cheap
+func (s *memoryStore) sweep() {
+	now := s.now()
+	for jti, expiresAt := range s.tokens {
+		if !now.Before(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, before := range s.users {
+		if !now.Before(before.Add(AccessTokenTTL)) {
+			delete(s.users, userID)
+		}
+	}
+}
+
+// postgresStore is a RevocationStore backed by the database, shared by every replica
+type postgresStore struct{}
+
+func (s *postgresStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return repository.RevokeAccessToken(ctx, jti, expiresAt)
+}
+
+func (s *postgresStore) RevokeUserTokens(ctx context.Context, userID string, before time.Time) error {
+	return repository.RevokeUserAccessTokens(ctx, userID, before, before.Add(AccessTokenTTL))
+}
+
+func (s *postgresStore) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	return repository.IsAccessTokenRevoked(ctx, jti, userID, issuedAt)
+}
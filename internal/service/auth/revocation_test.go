@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryStore().(*memoryStore)
+	store.now = func() time.Time { return now }
+
+	t.Run("MemoryStore_RevokeToken", func(t *testing.T) {
+		store.RevokeToken(ctx, "jti-1", now.Add(5*time.Minute))
+
+		if revoked, _ := store.IsRevoked(ctx, "jti-1", "user-1", now.Add(-time.Minute)); !revoked {
+			t.Error("Expected revoked jti to be denied")
+		}
+		if revoked, _ := store.IsRevoked(ctx, "jti-2", "user-1", now.Add(-time.Minute)); revoked {
+			t.Error("Expected other jti to be allowed")
+		}
+	})
+
+	t.Run("MemoryStore_RevokeUserTokens", func(t *testing.T) {
+		store.RevokeUserTokens(ctx, "user-2", now)
+
+		if revoked, _ := store.IsRevoked(ctx, "jti-3", "user-2", now.Add(-time.Minute)); !revoked {
+			t.Error("Expected token issued before revocation to be denied")
+		}
+		if revoked, _ := store.IsRevoked(ctx, "jti-4", "user-2", now); !revoked {
+			t.Error("Expected token issued at revocation time to be denied")
+		}
+		if revoked, _ := store.IsRevoked(ctx, "jti-5", "user-2", now.Add(time.Second)); revoked {
+			t.Error("Expected token issued after revocation to be allowed")
+		}
+		if revoked, _ := store.IsRevoked(ctx, "jti-6", "user-3", now.Add(-time.Minute)); revoked {
+			t.Error("Expected tokens of other users to be allowed")
+		}
+	})
+
+	t.Run("MemoryStore_SameSecondAsRevocation", func(t *testing.T) {
+		store.RevokeUserTokens(ctx, "user-4", now.Add(500*time.Millisecond))
+
+		if revoked, _ := store.IsRevoked(ctx, "jti-9", "user-4", now.Add(200*time.Millisecond)); !revoked {
+			t.Error("Expected token issued earlier in the second to be denied")
+		}
+		if revoked, _ := store.IsRevoked(ctx, "jti-10", "user-4", now.Add(700*time.Millisecond)); revoked {
+			t.Error("Expected token issued later in the second to be allowed")
+		}
+	})
+
+	t.Run("MemoryStore_EarlierRevocationDoesNotOverride", func(t *testing.T) {
+		store.RevokeUserTokens(ctx, "user-2", now.Add(-time.Hour))
+
+		if revoked, _ := store.IsRevoked(ctx, "jti-7", "user-2", now.Add(-time.Minute)); !revoked {
+			t.Error("Expected the later revocation time to be kept")
+		}
+	})
+
+	t.Run("MemoryStore_ExpiredEntriesAreSwept", func(t *testing.T) {
+		now = now.Add(AccessTokenTTL + time.Minute)
+		store.RevokeToken(ctx, "jti-8", now.Add(time.Minute))
+
+		if _, ok := store.tokens["jti-1"]; ok {
+			t.Error("Expected expired jti to be swept")
+		}
+		if _, ok := store.users["user-2"]; ok {
+			t.Error("Expected user revocation to be swept once its tokens expired")
+		}
+	})
+}
+
+func TestUserRevocationDoesNotDenyLaterTokens(t *testing.T) {
+	config.AppConfigInstance.JWTSecret = "test-secret"
+	defer func() { Revocations = NewMemoryStore() }()
+	Revocations = NewMemoryStore()
+	ctx := context.Background()
+
+	before, _ := GenerateToken("user-1", "trader")
+	if err := RevokeUserAccessTokens(ctx, "user-1"); err != nil {
+		t.Fatalf("Expected revocation, got %v", err)
+	}
+	// step past the microsecond of the revocation, well within the second it was made in
+	time.Sleep(time.Millisecond)
+	after, _ := GenerateToken("user-1", "trader")
+
+	beforeClaims, _ := ValidateToken(before)
+	if revoked, _ := IsAccessTokenRevoked(ctx, beforeClaims); !revoked {
+		t.Error("Expected token issued before the revocation to be denied")
+	}
+	afterClaims, _ := ValidateToken(after)
+	if revoked, _ := IsAccessTokenRevoked(ctx, afterClaims); revoked {
+		t.Error("Expected token issued right after the revocation to be allowed")
+	}
+}
+
+func TestInitializeRevocationStore(t *testing.T) {
+	defer func() { Revocations = NewMemoryStore() }()
+
+	if err := InitializeRevocationStore(PostgresRevocationStore); err != nil {
+		t.Errorf("Expected postgres store, got %v", err)
+	}
+	if _, ok := Revocations.(*postgresStore); !ok {
+		t.Errorf("Expected postgres store to be selected, got %T", Revocations)
+	}
+	if err := InitializeRevocationStore("redis"); err == nil {
+		t.Error("Expected error for unknown store")
+	}
+}
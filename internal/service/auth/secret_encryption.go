@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// newSecretAEAD returns the AES-256-GCM cipher of a key configured in env as the base64 of 32 random bytes
+func newSecretAEAD(env, encodedKey string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not valid base64: %w", env, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s must be 32 bytes, got %d", env, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret encrypts the secret, returning the nonce followed by the ciphertext. The owner, e.g. the
+// id of the row storing it, is authenticated with it so a ciphertext cannot be moved to another row.
+func sealSecret(aead cipher.AEAD, owner, secret string) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, []byte(secret), []byte(owner)), nil
+}
+
+// openSecret decrypts a secret sealed by sealSecret for the owner
+func openSecret(aead cipher.AEAD, owner string, sealed []byte) (string, error) {
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("encrypted secret is too short")
+	}
+	secret, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(owner))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
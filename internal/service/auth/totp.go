@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// TOTP parameters (RFC 6238), the defaults every authenticator app supports
+const (
+	totpIssuer = "Broker Platform"
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// totpSkew is the number of periods accepted before and after the current one for clock drift
+	totpSkew = 1
+
+	backupCodeCount = 10
+	// ChallengeTokenTTL is how long the second login step may take after the password was accepted
+	ChallengeTokenTTL = 5 * time.Minute
+	challengeAudience = "mfa-challenge"
+	// maxChallengeAttempts is how many wrong codes a challenge token takes before it is revoked
+	// and the password step has to be repeated
+	maxChallengeAttempts = 3
+)
+
+// ErrChallengeRevoked is returned for a challenge token that was used up by a login or by too many wrong codes
+var ErrChallengeRevoked = errors.New("challenge token was revoked")
+
+// challengeFailures counts wrong codes per challenge jti, each instance counts on its own while the
+// failures also count towards the account lockout shared through the database
+var challengeFailures = newLoginFailureTracker()
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random 160-bit base32 secret as recommended by RFC 4226
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth:// URI authenticator apps import, usually shown as a QR code
+func TOTPURI(secret, accountName string) string {
+	label := url.PathEscape(totpIssuer + ":" + accountName)
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpStep returns the RFC 6238 time step counter of t
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// hotp computes the RFC 4226 code of the counter with the given number of digits
+func hotp(key []byte, counter int64, digits int) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
+
+// MatchTOTP checks code against the secret at now, allowing totpSkew periods of clock drift.
+// It returns the time step the code belongs to so the caller can reject replays of it.
+func MatchTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step, totpDigits)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateBackupCodes returns single use recovery codes formatted as xxxxx-xxxxx and their hashes for storage
+func GenerateBackupCodes() ([]string, []string, error) {
+	codes := make([]string, backupCodeCount)
+	hashes := make([]string, backupCodeCount)
+	for i := range codes {
+		random := make([]byte, 7)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		encoded := strings.ToLower(base32NoPadding.EncodeToString(random))[:10]
+		codes[i] = encoded[:5] + "-" + encoded[5:]
+		hashes[i] = hashBackupCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashBackupCode normalizes a backup code as typed by the user before hashing it
+func hashBackupCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return utils.HashToken(normalized, "")
+}
+
+// VerifySecondFactor checks a TOTP code, or a backup code which is then used up, for a user with
+// two-factor authentication enabled. A TOTP code is only accepted once.
+func VerifySecondFactor(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	totp, err := repository.GetTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if totp.EnabledAt == nil {
+		return false, repository.ErrTOTPNotFound
+	}
+
+	secret, err := TOTPSecret(totp)
+	if err != nil {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := MatchTOTP(secret, code, time.Now()); ok {
+		return repository.UseTOTPStep(ctx, userID, step)
+	}
+	return repository.UseBackupCode(ctx, userID, hashBackupCode(code))
+}
+
+// GenerateChallengeToken returns the short-lived token proving the password step of a two-factor login
+func GenerateChallengeToken(userID string) (string, error) {
+	now := time.Now()
+	claims := &jwt.RegisteredClaims{
+		Subject:   userID,
+		Audience:  jwt.ClaimStrings{challengeAudience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ChallengeTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Issuer:    "broker-platform",
+		ID:        uuid.NewString(),
+	}
+	return signToken(claims)
+}
+
+// ValidateChallengeToken returns the claims of a valid challenge token that was not revoked,
+// the subject is the user id
+func ValidateChallengeToken(ctx context.Context, tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	if err := parseToken(tokenString, claims, jwt.WithAudience(challengeAudience)); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" || claims.ID == "" || claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return nil, errors.New("challenge token is missing claims")
+	}
+
+	// revoking the user's access tokens, e.g. on a password change, also revokes pending challenges
+	revoked, err := Revocations.IsRevoked(ctx, claims.ID, claims.Subject, claims.IssuedAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrChallengeRevoked
+	}
+	return claims, nil
+}
+
+// ConsumeChallenge revokes the challenge token so it cannot complete another login
+func ConsumeChallenge(ctx context.Context, claims *jwt.RegisteredClaims) error {
+	return Revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RecordChallengeFailure counts a wrong code for the challenge token and revokes it after maxChallengeAttempts
+func RecordChallengeFailure(ctx context.Context, claims *jwt.RegisteredClaims, now time.Time) error {
+	if challengeFailures.record(claims.ID, ChallengeTokenTTL, now) < maxChallengeAttempts {
+		return nil
+	}
+	return ConsumeChallenge(ctx, claims)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+)
+
+// ErrTwoFactorDisabled is returned when no TOTP_ENCRYPTION_KEY is configured, two-factor
+// authentication can then neither be set up nor completed
+var ErrTwoFactorDisabled = errors.New("two-factor authentication is disabled, TOTP_ENCRYPTION_KEY is not configured")
+
+// totpSecretAEAD encrypts TOTP secrets at rest, nil while two-factor authentication is disabled
+var totpSecretAEAD cipher.AEAD
+
+// InitializeTOTPEncryption loads the AES-256 key TOTP secrets are encrypted with, the base64 of 32
+// random bytes. It is a key of its own, kept outside the database so a copy of the user_totp table
+// or a backup cannot generate codes. An empty key leaves two-factor authentication disabled.
+func InitializeTOTPEncryption(encodedKey string) error {
+	totpSecretAEAD = nil
+	if encodedKey == "" {
+		return nil
+	}
+
+	aead, err := newSecretAEAD("TOTP_ENCRYPTION_KEY", encodedKey)
+	if err != nil {
+		return err
+	}
+	totpSecretAEAD = aead
+	return nil
+}
+
+// TwoFactorEnabled reports whether an encryption key is configured
+func TwoFactorEnabled() bool {
+	return totpSecretAEAD != nil
+}
+
+// EncryptTOTPSecret seals the TOTP secret of the user with AES-256-GCM, returning the nonce followed
+// by the ciphertext. The user id is authenticated with it so a ciphertext cannot be moved to another user.
+func EncryptTOTPSecret(userID uuid.UUID, secret string) ([]byte, error) {
+	if totpSecretAEAD == nil {
+		return nil, ErrTwoFactorDisabled
+	}
+	return sealSecret(totpSecretAEAD, userID.String(), secret)
+}
+
+// TOTPSecret returns the decrypted secret of a two-factor enrollment
+func TOTPSecret(totp *models.UserTOTP) (string, error) {
+	if totpSecretAEAD == nil {
+		return "", ErrTwoFactorDisabled
+	}
+	secret, err := openSecret(totpSecretAEAD, totp.UserID.String(), totp.SecretCiphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	return secret, nil
+}
+
+// EncryptStoredTOTPSecrets encrypts the plaintext secrets stored before migration 019 and clears
+// them, returning how many were encrypted. It does nothing once every secret is encrypted.
+func EncryptStoredTOTPSecrets(ctx context.Context) (int, error) {
+	if totpSecretAEAD == nil {
+		return 0, ErrTwoFactorDisabled
+	}
+
+	secrets, err := repository.GetPlaintextTOTPSecrets(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for userID, secret := range secrets {
+		sealed, err := EncryptTOTPSecret(userID, secret)
+		if err != nil {
+			return 0, err
+		}
+		if err := repository.StoreEncryptedTOTPSecret(ctx, userID, secret, sealed); err != nil {
+			return 0, err
+		}
+	}
+	return len(secrets), nil
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+)
+
+// RFC 6238 appendix B secret for SHA-1, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPMatchesRFC6238(t *testing.T) {
+	key, _ := base32NoPadding.DecodeString(rfcSecret)
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	}
+
+	for _, tt := range tests {
+		if got := hotp(key, totpStep(time.Unix(tt.unix, 0)), 8); got != tt.code {
+			t.Errorf("hotp at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	step, ok := MatchTOTP(rfcSecret, "287082", now)
+	if !ok || step != 1 {
+		t.Errorf("Expected code of step 1 to match, got %d %v", step, ok)
+	}
+	if _, ok := MatchTOTP(strings.ToLower(rfcSecret), "287082", now); !ok {
+		t.Error("Expected lower case secret to be accepted")
+	}
+	if _, ok := MatchTOTP(rfcSecret, "287082", now.Add(totpPeriod)); !ok {
+		t.Error("Expected code of the previous period to match for clock drift")
+	}
+	if _, ok := MatchTOTP(rfcSecret, "287082", now.Add(2*totpPeriod)); ok {
+		t.Error("Expected code two periods old to be rejected")
+	}
+	if _, ok := MatchTOTP(rfcSecret, "287083", now); ok {
+		t.Error("Expected wrong code to be rejected")
+	}
+	if _, ok := MatchTOTP(rfcSecret, "28708", now); ok {
+		t.Error("Expected short code to be rejected")
+	}
+	if _, ok := MatchTOTP("not base32!", "287082", now); ok {
+		t.Error("Expected invalid secret to be rejected")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("Expected 20 byte base32 secret, got %q %v", secret, err)
+	}
+
+	uri, err := url.Parse(TOTPURI(secret, "trader1@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Query().Get("secret") != secret {
+		t.Errorf("Unexpected otpauth uri %s", uri)
+	}
+	if uri.Path != "/Broker Platform:trader1@example.com" || uri.Query().Get("issuer") != "Broker Platform" {
+		t.Errorf("Unexpected label or issuer in %s", uri)
+	}
+}
+
+func TestGenerateBackupCodes(t *testing.T) {
+	codes, hashes, err := GenerateBackupCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != backupCodeCount || len(hashes) != backupCodeCount {
+		t.Fatalf("Expected %d codes, got %d", backupCodeCount, len(codes))
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected backup code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate backup code %q", code)
+		}
+		seen[code] = true
+		if hashes[i] != hashBackupCode(code) {
+			t.Errorf("Expected hash of code %d to match", i)
+		}
+	}
+
+	// users may type the code without the dash, in upper case or with spaces around it
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")) + " "
+	if hashBackupCode(typed) != hashes[0] {
+		t.Error("Expected typed variant of a backup code to match")
+	}
+}
+
+func TestChallengeToken(t *testing.T) {
+	config.AppConfigInstance.JWTSecret = "test-secret"
+	defer func() { Revocations = NewMemoryStore() }()
+	Revocations = NewMemoryStore()
+	ctx := context.Background()
+
+	challenge, err := GenerateChallengeToken("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateChallengeToken(ctx, challenge)
+	if err != nil || claims.Subject != "user-1" {
+		t.Fatalf("Expected challenge for user-1, got %v %v", claims, err)
+	}
+	if _, err := ValidateToken(challenge); err == nil {
+		t.Error("Expected challenge token to be rejected as an access token")
+	}
+
+	accessToken, _ := GenerateToken("user-1", "trader")
+	if _, err := ValidateChallengeToken(ctx, accessToken); err == nil {
+		t.Error("Expected access token to be rejected as a challenge token")
+	}
+
+	if err := ConsumeChallenge(ctx, claims); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateChallengeToken(ctx, challenge); !errors.Is(err, ErrChallengeRevoked) {
+		t.Errorf("Expected used challenge to be rejected, got %v", err)
+	}
+}
+
+func TestChallengeRevokedAfterWrongCodes(t *testing.T) {
+	config.AppConfigInstance.JWTSecret = "test-secret"
+	defer func() { Revocations = NewMemoryStore() }()
+	Revocations = NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now()
+
+	challenge, _ := GenerateChallengeToken("user-1")
+	claims, err := ValidateChallengeToken(ctx, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < maxChallengeAttempts; i++ {
+		RecordChallengeFailure(ctx, claims, now)
+		if _, err := ValidateChallengeToken(ctx, challenge); err != nil {
+			t.Fatalf("Expected challenge to stay valid after %d wrong codes, got %v", i, err)
+		}
+	}
+	RecordChallengeFailure(ctx, claims, now)
+	if _, err := ValidateChallengeToken(ctx, challenge); !errors.Is(err, ErrChallengeRevoked) {
+		t.Errorf("Expected challenge to be revoked after %d wrong codes, got %v", maxChallengeAttempts, err)
+	}
+}
+
+func TestTOTPSecretEncryption(t *testing.T) {
+	defer InitializeTOTPEncryption("")
+	userID := uuid.New()
+
+	if _, err := EncryptTOTPSecret(userID, rfcSecret); !errors.Is(err, ErrTwoFactorDisabled) {
+		t.Fatalf("Expected two-factor authentication to be disabled without a key, got %v", err)
+	}
+	if err := InitializeTOTPEncryption(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Fatal("Expected a key that is not 32 bytes to be rejected")
+	}
+	if err := InitializeTOTPEncryption(base64.StdEncoding.EncodeToString(make([]byte, 32))); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := EncryptTOTPSecret(userID, rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sealed), rfcSecret) {
+		t.Error("Expected the secret not to be stored in plaintext")
+	}
+	if secret, err := TOTPSecret(&models.UserTOTP{UserID: userID, SecretCiphertext: sealed}); err != nil || secret != rfcSecret {
+		t.Errorf("Expected the secret back, got %q, %v", secret, err)
+	}
+	if _, err := TOTPSecret(&models.UserTOTP{UserID: uuid.New(), SecretCiphertext: sealed}); err == nil {
+		t.Error("Expected a ciphertext moved to another user to fail")
+	}
+
+	InitializeTOTPEncryption(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if _, err := TOTPSecret(&models.UserTOTP{UserID: userID, SecretCiphertext: sealed}); err == nil {
+		t.Error("Expected decryption with another encryption key to fail")
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/utils"
+)
+
+// HashUserToken returns the hash a mailed token is stored and looked up by
+func HashUserToken(token string) string {
+	return utils.HashToken(token, "")
+}
+
+// issueUserToken creates a single use token of the purpose valid for ttl,
+// earlier tokens of the user for the same purpose stop working
+func issueUserToken(ctx context.Context, userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+
+	expiresAt := time.Now().UTC().Add(ttl)
+	if err := repository.CreateUserToken(ctx, userID, purpose, HashUserToken(token), expiresAt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,84 @@
+package corporateactions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+)
+
+// StartCorporateActionsService starts a background loop that applies corporate actions
+// reaching their ex-date once a day at the configured hour (UTC)
+func StartCorporateActionsService(ctx context.Context) {
+	// catch up on actions whose ex-date passed while the server was down
+	ApplyDueCorporateActions(ctx)
+
+	for {
+		timer := time.NewTimer(time.Until(nextRun(time.Now().UTC(), config.AppConfigInstance.CorporateActions.RunHour)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.FromContext(ctx).Info("Corporate actions service stopped")
+			return
+		case <-timer.C:
+			ApplyDueCorporateActions(ctx)
+		}
+	}
+}
+
+// ApplyDueCorporateActions applies all pending corporate actions whose ex-date has been reached
+func ApplyDueCorporateActions(ctx context.Context) {
+	logger.FromContext(ctx).Info("Starting to apply due corporate actions")
+
+	actions, err := repository.GetDueCorporateActions(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to fetch due corporate actions", err)
+		return
+	}
+
+	var applied int
+	for _, action := range actions {
+		err := repository.ApplyCorporateAction(ctx, action, AdjustmentFactor(action))
+		if errors.Is(err, repository.ErrCorporateActionAlreadyApplied) {
+			continue
+		}
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to apply corporate action "+action.ID.String()+" for symbol: "+action.Symbol, err)
+			continue
+		}
+		applied++
+		logger.FromContext(ctx).Infof("Applied %s corporate action %s for symbol: %s", action.ActionType, action.ID, action.Symbol)
+	}
+
+	logger.FromContext(ctx).Infof("Corporate actions completed: %d of %d applied", applied, len(actions))
+}
+
+// AdjustmentFactor returns the multiplier applied to quantities (and divisor applied to prices)
+// A 1:5 split gives 5, a 1:1 bonus gives 2 and dividends do not adjust quantities
+func AdjustmentFactor(action models.CorporateAction) float64 {
+	if action.RatioFrom <= 0 {
+		return 1
+	}
+
+	switch action.ActionType {
+	case "SPLIT":
+		return action.RatioTo / action.RatioFrom
+	case "BONUS":
+		return (action.RatioFrom + action.RatioTo) / action.RatioFrom
+	default:
+		return 1
+	}
+}
+
+// nextRun returns the next time at runHour (UTC) strictly after now
+func nextRun(now time.Time, runHour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), runHour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,74 @@
+package corporateactions
+
+import (
+	"testing"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+)
+
+func TestAdjustmentFactor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		action   models.CorporateAction
+		expected float64
+	}{
+		{"Split_1_5", models.CorporateAction{ActionType: "SPLIT", RatioFrom: 1, RatioTo: 5}, 5},
+		{"Split_2_1_Consolidation", models.CorporateAction{ActionType: "SPLIT", RatioFrom: 2, RatioTo: 1}, 0.5},
+		{"Bonus_1_1", models.CorporateAction{ActionType: "BONUS", RatioFrom: 1, RatioTo: 1}, 2},
+		{"Bonus_2_1", models.CorporateAction{ActionType: "BONUS", RatioFrom: 2, RatioTo: 1}, 1.5},
+		{"Dividend", models.CorporateAction{ActionType: "DIVIDEND", DividendPerShare: 10}, 1},
+		{"InvalidRatio", models.CorporateAction{ActionType: "SPLIT", RatioFrom: 0, RatioTo: 5}, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := AdjustmentFactor(tc.action); got != tc.expected {
+				t.Errorf("Expected factor %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// A run after the ex-date must not adjust delivery buys made on or after it that have since settled
+func TestEntitlementAfterPostExDateBuySettled(t *testing.T) {
+	split := models.CorporateAction{ActionType: "SPLIT", RatioFrom: 1, RatioTo: 2}
+
+	// 10 held before the ex-date at 100, then 5 bought at the post-split price of 50 and settled
+	entitlement := models.Entitlement{
+		Quantity:           15,
+		AveragePrice:       (10*100 + 5*50) / 15.0,
+		CurrentPrice:       100,
+		SettledSinceExDate: 5,
+	}
+
+	quantity, averagePrice, currentPrice := entitlement.AdjustHolding(AdjustmentFactor(split))
+	if quantity != 25 {
+		t.Errorf("Expected quantity 25, got %v", quantity)
+	}
+	if averagePrice != 50 {
+		t.Errorf("Expected average price 50, got %v", averagePrice)
+	}
+	if currentPrice != 50 {
+		t.Errorf("Expected current price 50, got %v", currentPrice)
+	}
+
+	if got := entitlement.EntitledQuantity(); got != 10 {
+		t.Errorf("Expected dividend entitlement of 10, got %v", got)
+	}
+
+	// a holding opened entirely after the ex-date is left as it is
+	postEx := models.Entitlement{Quantity: 5, AveragePrice: 50, CurrentPrice: 50, SettledSinceExDate: 5}
+	quantity, averagePrice, currentPrice = postEx.AdjustHolding(AdjustmentFactor(split))
+	if quantity != 5 || averagePrice != 50 || currentPrice != 50 {
+		t.Errorf("Expected holding unchanged at 5 @ 50, got %v @ %v (current %v)", quantity, averagePrice, currentPrice)
+	}
+	if got := postEx.EntitledQuantity(); got != 0 {
+		t.Errorf("Expected no dividend entitlement, got %v", got)
+	}
+
+	// unsettled delivery buys made before the ex-date still count towards a dividend
+	pending := models.Entitlement{Quantity: 10, SettledSinceExDate: 5, UnsettledBeforeExDate: 3}
+	if got := pending.EntitledQuantity(); got != 8 {
+		t.Errorf("Expected dividend entitlement of 8, got %v", got)
+	}
+}
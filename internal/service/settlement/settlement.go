@@ -0,0 +1,171 @@
+package settlement
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/config"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/logger"
+)
+
+// Obligation is the net delivery quantity for a user and symbol from a single trading day
+type Obligation struct {
+	UserID      uuid.UUID
+	Symbol      string
+	TradeDate   time.Time
+	NetQuantity float64 // positive when shares are to be received, negative when delivered
+	BuyPrice    float64 // average price of the day's buy trades, used for the weighted average cost
+	TradeIDs    []uuid.UUID
+}
+
+// StartSettlementService starts a background loop that runs the end-of-day settlement
+// once a day at the configured hour (UTC)
+func StartSettlementService(ctx context.Context) {
+	// catch up on anything that became due while the server was down
+	SettlePendingTrades(ctx, time.Now().UTC())
+
+	for {
+		timer := time.NewTimer(time.Until(nextRun(time.Now().UTC(), config.AppConfigInstance.Settlement.RunHour)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.FromContext(ctx).Info("Settlement service stopped")
+			return
+		case <-timer.C:
+			SettlePendingTrades(ctx, time.Now().UTC())
+		}
+	}
+}
+
+// SettlePendingTrades nets all unsettled delivery trades and moves the ones that are due into holdings
+func SettlePendingTrades(ctx context.Context, now time.Time) {
+	logger.FromContext(ctx).Info("Starting settlement of delivery trades")
+
+	trades, err := repository.GetUnsettledDeliveryTrades(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to fetch unsettled delivery trades", err)
+		return
+	}
+
+	cycleDays := config.AppConfigInstance.Settlement.CycleDays
+	runHour := config.AppConfigInstance.Settlement.RunHour
+
+	var settled, failed int
+	for _, obligation := range NetTrades(trades) {
+		if !IsDue(obligation.TradeDate, cycleDays, runHour, now) {
+			continue
+		}
+
+		err := repository.SettleDeliveryTrades(ctx, obligation.UserID, obligation.Symbol,
+			obligation.NetQuantity, obligation.BuyPrice, obligation.TradeIDs)
+		if err != nil {
+			failed++
+			if errors.Is(err, repository.ErrInsufficientHoldings) {
+				logger.FromContext(ctx).Error("Settlement sell obligation exceeds holdings for user_id: "+obligation.UserID.String()+", symbol: "+obligation.Symbol, err)
+				continue
+			}
+			logger.FromContext(ctx).Error("Failed to settle delivery trades for user_id: "+obligation.UserID.String()+", symbol: "+obligation.Symbol, err)
+			continue
+		}
+		settled++
+	}
+
+	logger.FromContext(ctx).Infof("Settlement completed: %d obligations settled, %d failed", settled, failed)
+}
+
+// NetTrades groups CNC trades per user, symbol and trade date and nets buys against sells
+func NetTrades(trades []models.Trade) []Obligation {
+	type key struct {
+		userID    uuid.UUID
+		symbol    string
+		tradeDate string
+	}
+
+	type totals struct {
+		obligation *Obligation
+		buyQty     float64
+		buyValue   float64
+		sellQty    float64
+	}
+
+	grouped := make(map[key]*totals)
+	var order []key
+
+	for _, trade := range trades {
+		if trade.Product != "CNC" {
+			continue
+		}
+
+		k := key{userID: trade.UserID, symbol: trade.Symbol, tradeDate: trade.TradeDate.Format(time.DateOnly)}
+		t, ok := grouped[k]
+		if !ok {
+			t = &totals{obligation: &Obligation{
+				UserID:    trade.UserID,
+				Symbol:    trade.Symbol,
+				TradeDate: trade.TradeDate,
+			}}
+			grouped[k] = t
+			order = append(order, k)
+		}
+
+		switch trade.Side {
+		case "BUY":
+			t.buyQty += trade.Quantity
+			t.buyValue += trade.Quantity * trade.Price
+		case "SELL":
+			t.sellQty += trade.Quantity
+		}
+		t.obligation.TradeIDs = append(t.obligation.TradeIDs, trade.ID)
+	}
+
+	obligations := make([]Obligation, 0, len(order))
+	for _, k := range order {
+		t := grouped[k]
+		t.obligation.NetQuantity = t.buyQty - t.sellQty
+		if t.buyQty > 0 {
+			t.obligation.BuyPrice = t.buyValue / t.buyQty
+		}
+		obligations = append(obligations, *t.obligation)
+	}
+
+	// settle older trade dates first so sells never run ahead of the buys they depend on
+	sort.SliceStable(obligations, func(i, j int) bool {
+		return obligations[i].TradeDate.Before(obligations[j].TradeDate)
+	})
+
+	return obligations
+}
+
+// SettlementDate returns the date on which a trade settles, counting only weekdays
+// Exchange holidays are not accounted for yet
+func SettlementDate(tradeDate time.Time, cycleDays int) time.Time {
+	date := time.Date(tradeDate.Year(), tradeDate.Month(), tradeDate.Day(), 0, 0, 0, 0, time.UTC)
+	for cycleDays > 0 {
+		date = date.AddDate(0, 0, 1)
+		if date.Weekday() != time.Saturday && date.Weekday() != time.Sunday {
+			cycleDays--
+		}
+	}
+	return date
+}
+
+// IsDue reports whether trades from tradeDate should be settled by now,
+// settlement happens at runHour (UTC) on the settlement date
+func IsDue(tradeDate time.Time, cycleDays, runHour int, now time.Time) bool {
+	settleAt := SettlementDate(tradeDate, cycleDays).Add(time.Duration(runHour) * time.Hour)
+	return !now.Before(settleAt)
+}
+
+// nextRun returns the next time at runHour (UTC) strictly after now
+func nextRun(now time.Time, runHour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), runHour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
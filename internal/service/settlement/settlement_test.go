@@ -0,0 +1,94 @@
+package settlement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prajwalbharadwajbm/broker/internal/db/models"
+)
+
+func TestNetTrades(t *testing.T) {
+	userID := uuid.New()
+	day := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+
+	t.Run("NetTrades_BuysAndSellsNetted", func(t *testing.T) {
+		trades := []models.Trade{
+			{ID: uuid.New(), UserID: userID, Symbol: "TCS", Side: "BUY", Product: "CNC", Quantity: 10, Price: 100, TradeDate: day},
+			{ID: uuid.New(), UserID: userID, Symbol: "TCS", Side: "BUY", Product: "CNC", Quantity: 10, Price: 200, TradeDate: day},
+			{ID: uuid.New(), UserID: userID, Symbol: "TCS", Side: "SELL", Product: "CNC", Quantity: 5, Price: 210, TradeDate: day},
+		}
+
+		obligations := NetTrades(trades)
+		if len(obligations) != 1 {
+			t.Fatalf("Expected 1 obligation, got %d", len(obligations))
+		}
+		if obligations[0].NetQuantity != 15 {
+			t.Errorf("Expected net quantity 15, got %v", obligations[0].NetQuantity)
+		}
+		if obligations[0].BuyPrice != 150 {
+			t.Errorf("Expected buy price 150, got %v", obligations[0].BuyPrice)
+		}
+		if len(obligations[0].TradeIDs) != 3 {
+			t.Errorf("Expected 3 trade IDs, got %d", len(obligations[0].TradeIDs))
+		}
+	})
+
+	t.Run("NetTrades_IntradayTradesIgnored", func(t *testing.T) {
+		trades := []models.Trade{
+			{ID: uuid.New(), UserID: userID, Symbol: "INFY", Side: "BUY", Product: "MIS", Quantity: 10, Price: 100, TradeDate: day},
+		}
+
+		if obligations := NetTrades(trades); len(obligations) != 0 {
+			t.Errorf("Expected no obligations for MIS trades, got %d", len(obligations))
+		}
+	})
+
+	t.Run("NetTrades_SeparatedBySymbolAndDate", func(t *testing.T) {
+		trades := []models.Trade{
+			{ID: uuid.New(), UserID: userID, Symbol: "TCS", Side: "SELL", Product: "CNC", Quantity: 4, Price: 100, TradeDate: day.AddDate(0, 0, 1)},
+			{ID: uuid.New(), UserID: userID, Symbol: "TCS", Side: "BUY", Product: "CNC", Quantity: 4, Price: 100, TradeDate: day},
+			{ID: uuid.New(), UserID: userID, Symbol: "INFY", Side: "BUY", Product: "CNC", Quantity: 2, Price: 100, TradeDate: day},
+		}
+
+		obligations := NetTrades(trades)
+		if len(obligations) != 3 {
+			t.Fatalf("Expected 3 obligations, got %d", len(obligations))
+		}
+		if !obligations[0].TradeDate.Equal(day) || obligations[2].NetQuantity != -4 {
+			t.Errorf("Expected obligations ordered by trade date with the sell last, got %+v", obligations)
+		}
+	})
+}
+
+func TestSettlementDate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		tradeDate time.Time
+		cycleDays int
+		expected  time.Time
+	}{
+		{"Monday_T1", time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), 1, time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{"Friday_T1_SkipsWeekend", time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC), 1, time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC)},
+		{"Thursday_T2_SkipsWeekend", time.Date(2025, 6, 5, 0, 0, 0, 0, time.UTC), 2, time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SettlementDate(tc.tradeDate, tc.cycleDays); !got.Equal(tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsDue(t *testing.T) {
+	tradeDate := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+
+	if IsDue(tradeDate, 1, 12, time.Date(2025, 6, 3, 11, 59, 0, 0, time.UTC)) {
+		t.Error("Expected trade not to be due before the settlement run hour")
+	}
+	if !IsDue(tradeDate, 1, 12, time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC)) {
+		t.Error("Expected trade to be due at the settlement run hour")
+	}
+}
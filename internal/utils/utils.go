@@ -2,12 +2,19 @@ package utils
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // GetEnv returns the environment variable value if it exists, otherwise returns the fallback value.
@@ -29,6 +36,11 @@ func GetEnv[T any](key string, fallback T) T {
 			if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
 				return any(floatVal).(T)
 			}
+		case time.Duration:
+			// durations are written like "15m" or "1h30m"
+			if durationVal, err := time.ParseDuration(value); err == nil {
+				return any(durationVal).(T)
+			}
 		}
 	}
 	return fallback
@@ -52,3 +64,42 @@ func FetchDataFromRequestBody[T any](request *http.Request) (T, error) {
 	}
 	return data, nil
 }
+
+// HashToken returns the hex encoded SHA-256 of a secret token so that only the hash needs to be stored.
+// When pepper is set an HMAC-SHA256 keyed with it is used instead, so a leaked table alone cannot be brute forced.
+func HashToken(token, pepper string) string {
+	if pepper == "" {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ClientIP returns the IP address of the client that sent the request. trustedProxyHops is the number of
+// proxies in front of the server that append to X-Forwarded-For, the header is ignored when it is 0.
+// Proxies append the address they received the request from, so only the rightmost trustedProxyHops
+// entries were written by them and the client is the one added by the outermost proxy; anything to its
+// left was sent by the client and could be forged. An entry that is not a valid IP falls back to the
+// connection's remote address.
+func ClientIP(r *http.Request, trustedProxyHops int) string {
+	if trustedProxyHops > 0 {
+		var entries []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			entries = append(entries, strings.Split(header, ",")...)
+		}
+		if len(entries) > 0 {
+			// with fewer entries than proxies every entry came from a proxy, the leftmost is the furthest out
+			entry := entries[max(len(entries)-trustedProxyHops, 0)]
+			if addr, err := netip.ParseAddr(strings.TrimSpace(entry)); err == nil {
+				return addr.Unmap().String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 // TestGetEnv tests the GetEnv function with different types
@@ -31,6 +32,28 @@ func TestGetEnv(t *testing.T) {
 			t.Errorf("Expected %v, got %v", fallback, result)
 		}
 	})
+
+	t.Run("GetEnv_Duration", func(t *testing.T) {
+		key := "TEST_DURATION"
+		os.Setenv(key, "1h30m")
+		defer os.Unsetenv(key)
+
+		result := GetEnv(key, time.Minute)
+		if result != 90*time.Minute {
+			t.Errorf("Expected %v, got %v", 90*time.Minute, result)
+		}
+	})
+
+	t.Run("GetEnv_Duration_Invalid", func(t *testing.T) {
+		key := "TEST_DURATION"
+		os.Setenv(key, "15")
+		defer os.Unsetenv(key)
+
+		result := GetEnv(key, time.Minute)
+		if result != time.Minute {
+			t.Errorf("Expected fallback %v, got %v", time.Minute, result)
+		}
+	})
 	// TODO: Add more tests for other types
 }
 
@@ -82,3 +105,67 @@ func TestFetchDataFromRequestBody(t *testing.T) {
 		}
 	})
 }
+
+// TestHashToken tests the HashToken function with and without a pepper
+func TestHashToken(t *testing.T) {
+	t.Run("HashToken_SHA256", func(t *testing.T) {
+		// echo -n abc | sha256sum
+		expected := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+		if result := HashToken("abc", ""); result != expected {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+	})
+
+	t.Run("HashToken_HMACWithPepper", func(t *testing.T) {
+		// RFC 4231 test case 2
+		expected := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+		if result := HashToken("what do ya want for nothing?", "Jefe"); result != expected {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+	})
+
+	t.Run("HashToken_PepperChangesHash", func(t *testing.T) {
+		if HashToken("token", "") == HashToken("token", "pepper") {
+			t.Error("Expected peppered hash to differ from plain hash")
+		}
+	})
+}
+
+// TestClientIP tests the ClientIP function with and without trusted proxy headers
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		hops      int
+		want      string
+	}{
+		{"ProxyNotTrusted", []string{"203.0.113.7"}, 0, "10.0.0.1"},
+		{"SingleProxy", []string{"203.0.113.7"}, 1, "203.0.113.7"},
+		// the client sent a forged entry, the proxy appended the real address
+		{"ForgedEntryIgnored", []string{"1.2.3.4, 203.0.113.7"}, 1, "203.0.113.7"},
+		{"TwoProxies", []string{"1.2.3.4, 203.0.113.7, 10.0.0.2"}, 2, "203.0.113.7"},
+		{"RepeatedHeaders", []string{"1.2.3.4", "203.0.113.7"}, 1, "203.0.113.7"},
+		{"FewerEntriesThanHops", []string{"203.0.113.7"}, 2, "203.0.113.7"},
+		{"IPv4MappedIPv6", []string{"::ffff:203.0.113.7"}, 1, "203.0.113.7"},
+		{"InvalidEntry", []string{"203.0.113.7, not-an-ip"}, 1, "10.0.0.1"},
+		{"NoHeader", nil, 1, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.1:52314"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if result := ClientIP(r, tt.hops); result != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, result)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[2001:db8::1]:443"
+	if result := ClientIP(r, 1); result != "2001:db8::1" {
+		t.Errorf("Expected IPv6 remote address, got %v", result)
+	}
+}
@@ -0,0 +1,292 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/db/repository"
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+)
+
+// Rule validates a single field value. It returns the error code of the failure,
+// or an empty string when the value is valid. parent is the struct holding the field
+// so rules can compare against sibling fields.
+type Rule func(ctx context.Context, value reflect.Value, param string, parent reflect.Value) (string, error)
+
+// rules available in `validate` struct tags, e.g. `validate:"required,positive,maxprecision=8"`
+// Apart from required and required_if, rules skip zero values so optional fields
+// are only checked when present.
+var rules = map[string]Rule{
+	"required":     required,
+	"required_if":  requiredIf,
+	"positive":     positive,
+	"maxprecision": maxPrecision,
+	"oneof":        oneOf,
+	"date":         date,
+	"email":        email,
+	"password":     password,
+	"symbol":       symbol,
+	"ipnet":        ipNet,
+	"future":       future,
+	"redirecturi":  redirectURI,
+}
+
+// Struct validates every field of s (a struct or pointer to struct) against its `validate` tag
+// and returns one FieldError per invalid field, keyed by the field's json name
+func Struct(ctx context.Context, s any) ([]dtos.FieldError, error) {
+	parent := reflect.Indirect(reflect.ValueOf(s))
+	if parent.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("validator: expected struct, got %s", parent.Kind())
+	}
+
+	var fieldErrors []dtos.FieldError
+	for i := 0; i < parent.NumField(); i++ {
+		field := parent.Type().Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		for _, ruleTag := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(ruleTag, "=")
+			rule, ok := rules[name]
+			if !ok {
+				return nil, fmt.Errorf("validator: unknown rule %q on field %s", name, field.Name)
+			}
+
+			code, err := rule(ctx, parent.Field(i), param, parent)
+			if err != nil {
+				return nil, err
+			}
+			if code != "" {
+				fieldErrors = append(fieldErrors, dtos.FieldError{Field: jsonName(field), Code: code})
+				break // report only the first failing rule per field
+			}
+		}
+	}
+
+	return fieldErrors, nil
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// deref returns the value a pointer points to, ok is false for nil pointers and zero values
+func deref(value reflect.Value) (reflect.Value, bool) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return value, false
+		}
+		value = value.Elem()
+	}
+	return value, !value.IsZero()
+}
+
+func required(_ context.Context, value reflect.Value, _ string, _ reflect.Value) (string, error) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return "BPB064", nil
+		}
+		return "", nil
+	}
+	if value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "" {
+		return "BPB064", nil
+	}
+	if value.Kind() == reflect.Slice && value.Len() == 0 {
+		return "BPB064", nil
+	}
+	if value.IsZero() {
+		return "BPB064", nil
+	}
+	return "", nil
+}
+
+// requiredIf makes a field required when a sibling field has one of the listed values,
+// e.g. `required_if=ActionType SPLIT BONUS`
+func requiredIf(ctx context.Context, value reflect.Value, param string, parent reflect.Value) (string, error) {
+	args := strings.Fields(param)
+	if len(args) < 2 {
+		return "", fmt.Errorf("validator: required_if needs a field and at least one value")
+	}
+	other := parent.FieldByName(args[0])
+	if !other.IsValid() {
+		return "", fmt.Errorf("validator: required_if refers to unknown field %s", args[0])
+	}
+	if !slices.Contains(args[1:], fmt.Sprint(reflect.Indirect(other).Interface())) {
+		return "", nil
+	}
+	return required(ctx, value, "", parent)
+}
+
+func positive(_ context.Context, value reflect.Value, _ string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok {
+		return "", nil
+	}
+	if value.CanFloat() && value.Float() <= 0 || value.CanInt() && value.Int() <= 0 {
+		return "BPB065", nil
+	}
+	return "", nil
+}
+
+// maxPrecision limits the number of decimal places, e.g. `maxprecision=8` for NUMERIC(20,8) columns
+func maxPrecision(_ context.Context, value reflect.Value, param string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok || !value.CanFloat() {
+		return "", nil
+	}
+	places, err := strconv.Atoi(param)
+	if err != nil {
+		return "", fmt.Errorf("validator: invalid maxprecision %q", param)
+	}
+	_, decimals, _ := strings.Cut(strconv.FormatFloat(value.Float(), 'f', -1, 64), ".")
+	if len(decimals) > places {
+		return "BPB066", nil
+	}
+	return "", nil
+}
+
+// oneOf restricts a string, or every element of a string slice, to a space separated
+// list of values, e.g. `oneof=BUY SELL`
+func oneOf(_ context.Context, value reflect.Value, param string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok {
+		return "", nil
+	}
+	for _, element := range elements(value) {
+		if !slices.Contains(strings.Fields(param), element.String()) {
+			return "BPB067", nil
+		}
+	}
+	return "", nil
+}
+
+// ipNet requires an IP address or CIDR range, or a slice of them
+func ipNet(_ context.Context, value reflect.Value, _ string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok {
+		return "", nil
+	}
+	for _, element := range elements(value) {
+		if _, err := netip.ParsePrefix(element.String()); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(element.String()); err != nil {
+			return "BPB048", nil
+		}
+	}
+	return "", nil
+}
+
+// redirectURI requires an absolute URL without fragment (RFC 6749 section 3.1.2), https except on
+// loopback hosts, or a slice of them
+func redirectURI(_ context.Context, value reflect.Value, _ string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok {
+		return "", nil
+	}
+	for _, element := range elements(value) {
+		uri, err := url.Parse(element.String())
+		if err != nil || !uri.IsAbs() || uri.Host == "" || uri.Fragment != "" {
+			return "BPB055", nil
+		}
+		loopback := uri.Hostname() == "localhost" || uri.Hostname() == "127.0.0.1" || uri.Hostname() == "::1"
+		if uri.Scheme != "https" && !(uri.Scheme == "http" && loopback) {
+			return "BPB055", nil
+		}
+	}
+	return "", nil
+}
+
+// future requires a time after now
+func future(_ context.Context, value reflect.Value, _ string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok {
+		return "", nil
+	}
+	if t, isTime := value.Interface().(time.Time); isTime && !t.After(time.Now()) {
+		return "BPB049", nil
+	}
+	return "", nil
+}
+
+// elements returns the elements of a slice, or the value itself, so rules apply to both
+func elements(value reflect.Value) []reflect.Value {
+	if value.Kind() != reflect.Slice {
+		return []reflect.Value{value}
+	}
+	values := make([]reflect.Value, value.Len())
+	for i := range values {
+		values[i] = value.Index(i)
+	}
+	return values
+}
+
+// date requires a YYYY-MM-DD date string
+func date(_ context.Context, value reflect.Value, _ string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok {
+		return "", nil
+	}
+	if _, err := time.Parse(time.DateOnly, value.String()); err != nil {
+		return "BPB025", nil
+	}
+	return "", nil
+}
+
+func email(_ context.Context, value reflect.Value, _ string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok {
+		return "", nil
+	}
+	if valid, err := IsValidEmail(value.String()); !valid || err != nil {
+		return err.Error(), nil
+	}
+	return "", nil
+}
+
+// password checks the password rules against the username held in the named sibling field,
+// e.g. `password=Email`. Without a field only the rules not involving the username are checked,
+// for requests where the handler looks the username up itself.
+func password(_ context.Context, value reflect.Value, param string, parent reflect.Value) (string, error) {
+	var username string
+	if param != "" {
+		field := parent.FieldByName(param)
+		if !field.IsValid() {
+			return "", fmt.Errorf("validator: password refers to unknown field %s", param)
+		}
+		username = field.String()
+	}
+	if valid, err := IsValidPassword(username, reflect.Indirect(value).String()); !valid || err != nil {
+		return err.Error(), nil
+	}
+	return "", nil
+}
+
+// symbol requires the symbol to be a listed instrument
+func symbol(ctx context.Context, value reflect.Value, _ string, _ reflect.Value) (string, error) {
+	value, ok := deref(value)
+	if !ok {
+		return "", nil
+	}
+	exists, err := repository.InstrumentExists(ctx, value.String())
+	if err != nil {
+		return "", fmt.Errorf("unable to look up symbol: %w", err)
+	}
+	if !exists {
+		return "BPB068", nil
+	}
+	return "", nil
+}
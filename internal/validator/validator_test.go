@@ -0,0 +1,187 @@
+package validator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prajwalbharadwajbm/broker/internal/dtos"
+)
+
+func TestStruct(t *testing.T) {
+	type order struct {
+		Side     string   `json:"side" validate:"required,oneof=BUY SELL"`
+		Quantity float64  `json:"quantity" validate:"required,positive,maxprecision=2"`
+		Price    *float64 `json:"price" validate:"positive"`
+		Date     string   `json:"date" validate:"date"`
+		Trigger  float64  `json:"trigger" validate:"required_if=Side SELL"`
+	}
+
+	t.Run("Struct_ValidRequest", func(t *testing.T) {
+		price := 10.5
+		fieldErrors, err := Struct(context.Background(), order{Side: "BUY", Quantity: 1.25, Price: &price, Date: "2025-07-01"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(fieldErrors) != 0 {
+			t.Errorf("Expected no field errors, got %+v", fieldErrors)
+		}
+	})
+
+	t.Run("Struct_FieldErrors", func(t *testing.T) {
+		price := -1.0
+		fieldErrors, err := Struct(context.Background(), &order{Side: "SELL", Quantity: 1.255, Price: &price, Date: "01/07/2025"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := map[string]string{
+			"quantity": "BPB066",
+			"price":    "BPB065",
+			"date":     "BPB025",
+			"trigger":  "BPB064",
+		}
+		if len(fieldErrors) != len(expected) {
+			t.Fatalf("Expected %d field errors, got %+v", len(expected), fieldErrors)
+		}
+		for _, fieldError := range fieldErrors {
+			if expected[fieldError.Field] != fieldError.Code {
+				t.Errorf("Expected code '%s' for field '%s', got '%s'", expected[fieldError.Field], fieldError.Field, fieldError.Code)
+			}
+		}
+	})
+
+	t.Run("Struct_RequiredAndEnum", func(t *testing.T) {
+		fieldErrors, _ := Struct(context.Background(), order{Side: "HOLD"})
+		if len(fieldErrors) != 2 || fieldErrors[0].Code != "BPB067" || fieldErrors[1].Code != "BPB064" {
+			t.Errorf("Expected enum and required errors, got %+v", fieldErrors)
+		}
+	})
+
+	t.Run("Struct_UnknownRule", func(t *testing.T) {
+		type invalid struct {
+			Name string `validate:"shiny"`
+		}
+		if _, err := Struct(context.Background(), invalid{}); err == nil {
+			t.Error("Expected error for unknown rule")
+		}
+	})
+}
+
+func TestStruct_User(t *testing.T) {
+	testCases := []struct {
+		user         dtos.User
+		expectedCode string
+	}{
+		{dtos.User{Email: "trader@example.com", Password: "password123"}, ""},
+		{dtos.User{Email: "abc.example.com", Password: "password123"}, "BPB002"},
+		{dtos.User{Email: "trader@example.com", Password: "short"}, "BPB003"},
+		{dtos.User{Email: "trader@example.com", Password: "trader@example.com"}, "BPB004"},
+		{dtos.User{Email: "trader@example.com"}, "BPB064"},
+	}
+
+	for _, tc := range testCases {
+		fieldErrors, err := Struct(context.Background(), tc.user)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if tc.expectedCode == "" {
+			if len(fieldErrors) != 0 {
+				t.Errorf("Expected user %+v to be valid, got %+v", tc.user, fieldErrors)
+			}
+			continue
+		}
+		if len(fieldErrors) != 1 || fieldErrors[0].Code != tc.expectedCode {
+			t.Errorf("Expected code '%s' for user %+v, got %+v", tc.expectedCode, tc.user, fieldErrors)
+		}
+	}
+}
+
+func TestStruct_ChangePassword(t *testing.T) {
+	testCases := []struct {
+		request      dtos.ChangePassword
+		expectedCode string
+	}{
+		{dtos.ChangePassword{OldPassword: "password123", NewPassword: "password456"}, ""},
+		{dtos.ChangePassword{OldPassword: "password123", NewPassword: "short"}, "BPB003"},
+		{dtos.ChangePassword{OldPassword: "password123"}, "BPB064"},
+	}
+
+	for _, tc := range testCases {
+		fieldErrors, err := Struct(context.Background(), tc.request)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if tc.expectedCode == "" {
+			if len(fieldErrors) != 0 {
+				t.Errorf("Expected request %+v to be valid, got %+v", tc.request, fieldErrors)
+			}
+			continue
+		}
+		if len(fieldErrors) != 1 || fieldErrors[0].Code != tc.expectedCode || fieldErrors[0].Field != "new_password" {
+			t.Errorf("Expected code '%s' on new_password for request %+v, got %+v", tc.expectedCode, tc.request, fieldErrors)
+		}
+	}
+}
+
+func TestStruct_CreateAPIKey(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		request       dtos.CreateAPIKey
+		expectedField string
+		expectedCode  string
+	}{
+		{dtos.CreateAPIKey{Name: "bot", Scopes: []string{"read", "trade"}, IPAllowlist: []string{"203.0.113.7", "198.51.100.0/24"}, ExpiresAt: &future}, "", ""},
+		{dtos.CreateAPIKey{Name: "bot", Scopes: []string{"read"}}, "", ""},
+		{dtos.CreateAPIKey{Name: "bot", Scopes: []string{}}, "scopes", "BPB064"},
+		{dtos.CreateAPIKey{Name: "bot", Scopes: []string{"read", "admin"}}, "scopes", "BPB067"},
+		{dtos.CreateAPIKey{Name: "bot", Scopes: []string{"read"}, IPAllowlist: []string{"203.0.113.7", "example.com"}}, "ip_allowlist", "BPB048"},
+		{dtos.CreateAPIKey{Name: "bot", Scopes: []string{"read"}, ExpiresAt: &past}, "expires_at", "BPB049"},
+	}
+
+	for _, tc := range testCases {
+		fieldErrors, err := Struct(context.Background(), tc.request)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if tc.expectedCode == "" {
+			if len(fieldErrors) != 0 {
+				t.Errorf("Expected request %+v to be valid, got %+v", tc.request, fieldErrors)
+			}
+			continue
+		}
+		if len(fieldErrors) != 1 || fieldErrors[0].Code != tc.expectedCode || fieldErrors[0].Field != tc.expectedField {
+			t.Errorf("Expected code '%s' on %s for request %+v, got %+v", tc.expectedCode, tc.expectedField, tc.request, fieldErrors)
+		}
+	}
+}
+
+func TestStruct_RegisterOAuthClient(t *testing.T) {
+	testCases := []struct {
+		redirectURIs []string
+		valid        bool
+	}{
+		{[]string{"https://tax.example.com/oauth/callback", "http://localhost:8080/callback"}, true},
+		{[]string{"http://127.0.0.1/callback", "http://[::1]:3000/callback"}, true},
+		{[]string{"https://tax.example.com/callback#done"}, false},
+		{[]string{"http://tax.example.com/callback"}, false},
+		{[]string{"/oauth/callback"}, false},
+		{[]string{"https://tax.example.com/callback", "com.example.app:/callback"}, false},
+	}
+
+	for _, tc := range testCases {
+		request := dtos.RegisterOAuthClient{Name: "Tax Tool", RedirectURIs: tc.redirectURIs, Scopes: []string{"holdings:read"}}
+		fieldErrors, err := Struct(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if tc.valid && len(fieldErrors) != 0 {
+			t.Errorf("Expected redirect URIs %v to be valid, got %+v", tc.redirectURIs, fieldErrors)
+		}
+		if !tc.valid && (len(fieldErrors) != 1 || fieldErrors[0].Code != "BPB055" || fieldErrors[0].Field != "redirect_uris") {
+			t.Errorf("Expected BPB055 on redirect_uris for %v, got %+v", tc.redirectURIs, fieldErrors)
+		}
+	}
+}
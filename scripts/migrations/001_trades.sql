@@ -0,0 +1,19 @@
+-- Migration 001: trades table for T+1 settlement of delivery (CNC) trades
+-- Run against an existing database created before the settlement job was added:
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/001_trades.sql
+
+CREATE TABLE IF NOT EXISTS trades (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    symbol VARCHAR(20) NOT NULL,
+    side VARCHAR(4) NOT NULL CHECK (side IN ('BUY', 'SELL')),
+    product VARCHAR(4) NOT NULL CHECK (product IN ('CNC', 'MIS')),
+    quantity NUMERIC(20,8) NOT NULL CHECK (quantity > 0),
+    price NUMERIC(20,8) NOT NULL CHECK (price > 0),
+    trade_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    settled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_trades_unsettled ON trades(trade_date) WHERE product = 'CNC' AND settled_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_trades_user_id ON trades(user_id);
@@ -0,0 +1,30 @@
+-- Migration 002: corporate actions and funds ledger
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/002_corporate_actions.sql
+
+CREATE TABLE IF NOT EXISTS corporate_actions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    symbol VARCHAR(20) NOT NULL,
+    action_type VARCHAR(10) NOT NULL CHECK (action_type IN ('SPLIT', 'BONUS', 'DIVIDEND')),
+    ratio_from NUMERIC(20,8) NOT NULL DEFAULT 0,
+    ratio_to NUMERIC(20,8) NOT NULL DEFAULT 0,
+    dividend_per_share NUMERIC(20,8) NOT NULL DEFAULT 0,
+    ex_date DATE NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'APPLIED')),
+    applied_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_corporate_actions_pending ON corporate_actions(ex_date) WHERE status = 'PENDING';
+
+-- Create funds ledger table
+CREATE TABLE IF NOT EXISTS funds_ledger (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    entry_type VARCHAR(20) NOT NULL,
+    amount NUMERIC(20,8) NOT NULL,
+    reference_id UUID,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_funds_ledger_user_id ON funds_ledger(user_id);
@@ -0,0 +1,39 @@
+-- Migration 003: one holding row per user and symbol
+-- Merges duplicate lots into the oldest row with a weighted average price before adding the constraint
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/003_holdings_unique_symbol.sql
+
+BEGIN;
+
+WITH totals AS (
+    SELECT user_id, symbol,
+           SUM(quantity) AS quantity,
+           SUM(quantity * average_price) / NULLIF(SUM(quantity), 0) AS average_price,
+           (ARRAY_AGG(current_price ORDER BY updated_at DESC))[1] AS current_price
+    FROM holdings
+    GROUP BY user_id, symbol
+    HAVING COUNT(*) > 1
+), ranked AS (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id, symbol ORDER BY created_at, id) AS rn
+    FROM holdings
+)
+UPDATE holdings h
+SET quantity = t.quantity,
+    average_price = COALESCE(t.average_price, h.average_price),
+    current_price = t.current_price,
+    updated_at = NOW()
+FROM totals t, ranked r
+WHERE r.id = h.id AND r.rn = 1 AND t.user_id = h.user_id AND t.symbol = h.symbol;
+
+DELETE FROM holdings h
+USING (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id, symbol ORDER BY created_at, id) AS rn
+    FROM holdings
+) r
+WHERE r.id = h.id AND r.rn > 1;
+
+-- total_value was previously trusted from the request body
+UPDATE holdings SET total_value = quantity * current_price;
+
+ALTER TABLE holdings ADD CONSTRAINT holdings_user_id_symbol_key UNIQUE (user_id, symbol);
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- Migration 004: instruments table used to validate symbols in requests
+-- Backfills every symbol already present so existing data stays valid
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/004_instruments.sql
+
+CREATE TABLE IF NOT EXISTS instruments (
+    symbol VARCHAR(20) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    exchange VARCHAR(10) NOT NULL DEFAULT 'NSE',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO instruments (symbol)
+SELECT symbol FROM holdings
+UNION SELECT symbol FROM positions
+UNION SELECT symbol FROM orderbook
+UNION SELECT symbol FROM trades
+UNION SELECT symbol FROM corporate_actions
+ON CONFLICT DO NOTHING;
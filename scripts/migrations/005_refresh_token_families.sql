@@ -0,0 +1,12 @@
+-- Migration 005: refresh token families for reuse detection
+-- Existing tokens each become their own family, rotated tokens are now kept as revoked until they expire
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/005_refresh_token_families.sql
+
+BEGIN;
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+COMMIT;
@@ -0,0 +1,29 @@
+-- Migration 006: store refresh tokens hashed instead of in plaintext
+-- Hashes existing tokens in place so current sessions keep working. When REFRESH_TOKEN_PEPPER is set
+-- pass the same value so the hashes match what the server computes:
+-- psql -h localhost -U postgres -d broker-platform -v pepper="$REFRESH_TOKEN_PEPPER" -f scripts/migrations/006_hash_refresh_tokens.sql
+-- Without a pepper:
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/006_hash_refresh_tokens.sql
+
+\if :{?pepper}
+\else
+\set pepper ''
+\endif
+
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+
+ALTER TABLE refresh_tokens ADD COLUMN token_hash CHAR(64);
+
+UPDATE refresh_tokens
+SET token_hash = CASE
+    WHEN :'pepper' = '' THEN encode(digest(token, 'sha256'), 'hex')
+    ELSE encode(hmac(token, :'pepper', 'sha256'), 'hex')
+END;
+
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_token_hash_key UNIQUE (token_hash);
+ALTER TABLE refresh_tokens DROP COLUMN token;
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- Migration 007: device metadata on refresh tokens for session management
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/007_session_metadata.sql
+
+BEGIN;
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS device_name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_agent VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
+
+-- existing tokens have not been refreshed since they were issued
+UPDATE refresh_tokens SET last_used_at = created_at;
+
+COMMIT;
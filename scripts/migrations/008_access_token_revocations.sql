@@ -0,0 +1,17 @@
+-- Migration 008: access token denylist shared between replicas (ACCESS_TOKEN_REVOCATION_STORE=postgres)
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/008_access_token_revocations.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_access_token_revocations (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    revoked_before TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- Migration 011: email verification
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/011_email_verification.sql
+
+BEGIN;
+
+-- accounts created before verification existed keep trading, only new signups have to verify
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ALTER COLUMN email_verified SET DEFAULT FALSE;
+
+ALTER TABLE user_tokens DROP CONSTRAINT IF EXISTS user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('PASSWORD_RESET', 'EMAIL_VERIFICATION'));
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Migration 012: failed login tracking and account lockout
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/012_login_lockout.sql
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_failed_login_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Migration 013: API keys for programmatic access
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/013_api_keys.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key_id VARCHAR(32) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    secret_hash CHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    ip_allowlist TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+COMMIT;
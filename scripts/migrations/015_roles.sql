@@ -0,0 +1,13 @@
+-- Migration 015: user roles and account freezing
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/015_roles.sql
+--
+-- ADMIN_USER_IDS is no longer read, promote the users listed there before deploying:
+-- UPDATE users SET role = 'admin' WHERE id IN ('<user id>', ...);
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'trader'
+    CHECK (role IN ('trader', 'support', 'risk', 'admin'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS frozen_at TIMESTAMPTZ;
+
+COMMIT;
@@ -0,0 +1,16 @@
+-- Migration 017: store API key secrets encrypted instead of as their SHA-256
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/017_api_key_secret_encryption.sql
+--
+-- The stored SHA-256 was the signing key itself, so anyone reading the table could sign requests.
+-- Secrets are now sealed with AES-256-GCM under API_KEY_ENCRYPTION_KEY, which is kept outside the
+-- database. The old hashes cannot be turned into ciphertexts, so existing keys are deleted and users
+-- create new ones.
+
+BEGIN;
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS secret_ciphertext BYTEA;
+DELETE FROM api_keys WHERE secret_ciphertext IS NULL;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS secret_hash;
+ALTER TABLE api_keys ALTER COLUMN secret_ciphertext SET NOT NULL;
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Migration 018: widen audit_events.request_id to the 128 characters accepted in X-Request-ID
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/018_audit_request_id_length.sql
+
+BEGIN;
+
+ALTER TABLE audit_events ALTER COLUMN request_id TYPE VARCHAR(128);
+
+COMMIT;
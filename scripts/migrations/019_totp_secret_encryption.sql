@@ -0,0 +1,16 @@
+-- Migration 019: store TOTP secrets encrypted instead of in plaintext
+-- psql -h localhost -U postgres -d broker-platform -f scripts/migrations/019_totp_secret_encryption.sql
+--
+-- Anyone reading user_totp could generate codes for every enrolled user. Secrets are now sealed with
+-- AES-256-GCM under TOTP_ENCRYPTION_KEY, which is kept outside the database, so the secrets already
+-- stored cannot be encrypted here. The server encrypts them into secret_ciphertext on startup and
+-- clears secret, set TOTP_ENCRYPTION_KEY before starting it after this migration.
+
+BEGIN;
+
+ALTER TABLE user_totp ADD COLUMN IF NOT EXISTS secret_ciphertext BYTEA;
+ALTER TABLE user_totp ALTER COLUMN secret DROP NOT NULL;
+ALTER TABLE user_totp DROP CONSTRAINT IF EXISTS user_totp_secret_check;
+ALTER TABLE user_totp ADD CONSTRAINT user_totp_secret_check CHECK (secret IS NOT NULL OR secret_ciphertext IS NOT NULL);
+
+COMMIT;
@@ -9,16 +9,134 @@ CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     email VARCHAR(255) UNIQUE NOT NULL,
     password_hash VARCHAR(255) NOT NULL,
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    failed_login_attempts INT NOT NULL DEFAULT 0,
+    last_failed_login_at TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    role VARCHAR(20) NOT NULL DEFAULT 'trader' CHECK (role IN ('trader', 'support', 'risk', 'admin')),
+    frozen_at TIMESTAMPTZ,
     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Create OAuth client table, third-party apps users grant access to their account
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id VARCHAR(32) NOT NULL UNIQUE,
+    client_secret_hash CHAR(64),
+    name VARCHAR(100) NOT NULL,
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Create refresh tokens table
 CREATE TABLE IF NOT EXISTS refresh_tokens (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    token VARCHAR(255) NOT NULL UNIQUE,
+    family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    device_name VARCHAR(100) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    client_id VARCHAR(32) REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scopes TEXT[],
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- Create access token denylist tables, used when ACCESS_TOKEN_REVOCATION_STORE=postgres
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_access_token_revocations (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    revoked_before TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Create two-factor authentication tables
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- plaintext secret of rows stored before migration 019, encrypted by the server on startup
+    secret VARCHAR(64),
+    secret_ciphertext BYTEA,
+    enabled_at TIMESTAMPTZ,
+    last_used_step BIGINT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT user_totp_secret_check CHECK (secret IS NOT NULL OR secret_ciphertext IS NOT NULL)
+);
+
+CREATE TABLE IF NOT EXISTS totp_backup_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_totp_backup_codes_user_id ON totp_backup_codes(user_id);
+
+-- Create table of single use tokens mailed to users (password reset and email verification links)
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('PASSWORD_RESET', 'EMAIL_VERIFICATION')),
+    token_hash CHAR(64) NOT NULL UNIQUE,
     expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id, purpose);
+
+-- Create API keys table, programs authenticate with HMAC signed requests
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key_id VARCHAR(32) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    secret_ciphertext BYTEA NOT NULL,
+    scopes TEXT[] NOT NULL,
+    ip_allowlist TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+-- Create OAuth consent and authorization code tables
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(32) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash CHAR(64) PRIMARY KEY,
+    client_id VARCHAR(32) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge VARCHAR(128) NOT NULL,
+    family_id UUID,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+-- Create instruments table
+-- Request validation only accepts symbols listed here
+CREATE TABLE IF NOT EXISTS instruments (
+    symbol VARCHAR(20) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    exchange VARCHAR(10) NOT NULL DEFAULT 'NSE',
     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -32,7 +150,8 @@ CREATE TABLE IF NOT EXISTS holdings (
     current_price NUMERIC(20,8) NOT NULL,
     total_value NUMERIC(20,8) NOT NULL,
     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, symbol)
 );
 
 -- Create positions table
@@ -61,6 +180,87 @@ CREATE TABLE IF NOT EXISTS orderbook (
     updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Create trades table
+-- CNC (delivery) trades are settled into holdings by the settlement job after the settlement cycle (T+1)
+CREATE TABLE IF NOT EXISTS trades (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    symbol VARCHAR(20) NOT NULL,
+    side VARCHAR(4) NOT NULL CHECK (side IN ('BUY', 'SELL')),
+    product VARCHAR(4) NOT NULL CHECK (product IN ('CNC', 'MIS')),
+    quantity NUMERIC(20,8) NOT NULL CHECK (quantity > 0),
+    price NUMERIC(20,8) NOT NULL CHECK (price > 0),
+    trade_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    settled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_trades_unsettled ON trades(trade_date) WHERE product = 'CNC' AND settled_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_trades_user_id ON trades(user_id);
+
+-- Create corporate actions table
+-- Splits and bonuses adjust holdings, positions, open orders and unsettled CNC trades as of the ex-date, dividends are credited to the funds ledger
+CREATE TABLE IF NOT EXISTS corporate_actions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    symbol VARCHAR(20) NOT NULL,
+    action_type VARCHAR(10) NOT NULL CHECK (action_type IN ('SPLIT', 'BONUS', 'DIVIDEND')),
+    ratio_from NUMERIC(20,8) NOT NULL DEFAULT 0,
+    ratio_to NUMERIC(20,8) NOT NULL DEFAULT 0,
+    dividend_per_share NUMERIC(20,8) NOT NULL DEFAULT 0,
+    ex_date DATE NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'APPLIED')),
+    applied_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_corporate_actions_pending ON corporate_actions(ex_date) WHERE status = 'PENDING';
+
+-- Create funds ledger table
+CREATE TABLE IF NOT EXISTS funds_ledger (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    entry_type VARCHAR(20) NOT NULL,
+    amount NUMERIC(20,8) NOT NULL,
+    reference_id UUID,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_funds_ledger_user_id ON funds_ledger(user_id);
+
+-- Create audit events table, each row is chained to the previous one by its hash
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    actor_id UUID,
+    user_id UUID,
+    action VARCHAR(50) NOT NULL,
+    resource VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    outcome VARCHAR(10) NOT NULL CHECK (outcome IN ('success', 'failure')),
+    before JSON,
+    after JSON,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events(user_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action, occurred_at);
+
+-- audit events are append only, rows cannot be changed or removed through the database either
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
 
 -- Insert test users
 -- use POST /api/v1/users/signup to create users
@@ -71,6 +271,22 @@ CREATE TABLE IF NOT EXISTS orderbook (
 -- curl -X POST http://localhost:8080/api/v1/users/login -H "Content-Type: application/json" -d '{"email":"trader1@example.com","password":"password"}'
 -- curl -X POST http://localhost:8080/api/v1/users/login -H "Content-Type: application/json" -d '{"email":"trader2@example.com","password":"password"}'
 
+-- Insert listed instruments
+INSERT INTO instruments (symbol, name) VALUES 
+('RELIANCE', 'Reliance Industries Ltd'),
+('TCS', 'Tata Consultancy Services Ltd'),
+('INFY', 'Infosys Ltd'),
+('HDFCBANK', 'HDFC Bank Ltd'),
+('ICICIBANK', 'ICICI Bank Ltd'),
+('SBIN', 'State Bank of India'),
+('WIPRO', 'Wipro Ltd'),
+('BHARTIARTL', 'Bharti Airtel Ltd'),
+('ADANIPORTS', 'Adani Ports and Special Economic Zone Ltd'),
+('BAJFINANCE', 'Bajaj Finance Ltd'),
+('MARUTI', 'Maruti Suzuki India Ltd'),
+('TATAMOTORS', 'Tata Motors Ltd')
+ON CONFLICT DO NOTHING;
+
 -- Insert sample holdings for Indian stocks
 INSERT INTO holdings (user_id, symbol, quantity, average_price, current_price, total_value) VALUES 
 -- User 1 holdings (Major Indian Blue Chips)
@@ -126,8 +342,16 @@ INSERT INTO orderbook (symbol, side, price, quantity) VALUES
 ('ICICIBANK', 'SELL', 985.00000000, 35.00000000)
 ON CONFLICT DO NOTHING;
 
+-- Insert sample delivery trades awaiting settlement
+INSERT INTO trades (user_id, symbol, side, product, quantity, price, trade_date) VALUES 
+((SELECT id FROM users WHERE email = 'trader1@example.com'), 'TCS', 'BUY', 'CNC', 5.00000000, 3690.00000000, CURRENT_DATE),
+((SELECT id FROM users WHERE email = 'trader1@example.com'), 'INFY', 'SELL', 'CNC', 10.00000000, 1605.00000000, CURRENT_DATE),
+((SELECT id FROM users WHERE email = 'trader2@example.com'), 'ICICIBANK', 'BUY', 'MIS', 20.00000000, 980.00000000, CURRENT_DATE)
+ON CONFLICT DO NOTHING;
+
 -- Display summary of inserted data
 SELECT 'Users created:' as info, COUNT(*) as count FROM users;
 SELECT 'Holdings created:' as info, COUNT(*) as count FROM holdings;
 SELECT 'Positions created:' as info, COUNT(*) as count FROM positions;
-SELECT 'Order book entries:' as info, COUNT(*) as count FROM orderbook; 
\ No newline at end of file
+SELECT 'Order book entries:' as info, COUNT(*) as count FROM orderbook;
+SELECT 'Trades created:' as info, COUNT(*) as count FROM trades; 
\ No newline at end of file